@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	firebaseauth "firebase.google.com/go/v4/auth"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// Providers that can vouch for an identity
+const (
+	ProviderLocal    = "local"
+	ProviderFirebase = "firebase"
+	ProviderDev      = "dev"
+)
+
+// Identity is who a request's credentials belong to
+type Identity struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Provider      string
+	SessionID     string    // Set for local tokens
+	MFAVerifiedAt time.Time // Zero unless a second factor has been checked
+}
+
+// Authenticator verifies a bearer token. token is empty when the request had
+// no Authorization header.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
+
+// Chain tries each authenticator in order and accepts the first identity.
+// A token no authenticator accepts is rejected.
+type Chain []Authenticator
+
+func (ch Chain) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	var lastErr error = ErrInvalidToken
+	if token == "" {
+		lastErr = ErrMissingToken
+	}
+	for _, a := range ch {
+		identity, err := a.Authenticate(ctx, token)
+		if err == nil {
+			return identity, nil
+		}
+		if token != "" {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// LocalAuthenticator accepts the HS256 access tokens issued by /login,
+// /register and /auth/refresh. SessionStatus, when set, rejects tokens whose
+// session has been revoked so logging out takes effect immediately, and
+// reports the session's last second-factor check.
+type LocalAuthenticator struct {
+	SessionStatus func(ctx context.Context, sessionID string) (active bool, mfaVerifiedAt time.Time)
+}
+
+func (l LocalAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	identity := &Identity{UID: claims.UserID, Provider: ProviderLocal, SessionID: claims.SessionID}
+	if l.SessionStatus != nil {
+		active, mfaVerifiedAt := l.SessionStatus(ctx, claims.SessionID)
+		if !active {
+			return nil, ErrInvalidToken
+		}
+		identity.MFAVerifiedAt = mfaVerifiedAt
+	}
+	return identity, nil
+}
+
+// FirebaseAuthenticator accepts Firebase ID tokens
+type FirebaseAuthenticator struct {
+	Client *firebaseauth.Client
+}
+
+func (f FirebaseAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	verified, err := f.Client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	identity := &Identity{UID: verified.UID, Provider: ProviderFirebase}
+	if email, ok := verified.Claims["email"].(string); ok {
+		identity.Email = email
+	}
+	if emailVerified, ok := verified.Claims["email_verified"].(bool); ok {
+		identity.EmailVerified = emailVerified
+	}
+	if name, ok := verified.Claims["name"].(string); ok {
+		identity.Name = name
+	}
+	// Firebase multi-factor sign-in records the factor used
+	if info, ok := verified.Claims["firebase"].(map[string]interface{}); ok {
+		if factor, _ := info["sign_in_second_factor"].(string); factor != "" {
+			identity.MFAVerifiedAt = time.Unix(verified.AuthTime, 0)
+		}
+	}
+	return identity, nil
+}
+
+// DevAuthenticator trusts the bearer token as a user ID ("Bearer alice") and
+// treats requests without one as "dev-user". Only for local development; it
+// is enabled with AUTH_DEV_MODE=true and must come last in a chain. Dev
+// identities count as having passed a second factor.
+type DevAuthenticator struct{}
+
+func (DevAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	uid := strings.TrimSpace(token)
+	if uid == "" {
+		uid = "dev-user"
+	}
+	return &Identity{UID: uid, Name: "Dev User", Provider: ProviderDev, MFAVerifiedAt: time.Now()}, nil
+}
@@ -1,42 +1,163 @@
 package auth
 
 import (
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var SecretKey = []byte("your-secret-key-change-in-production")
+// AccessTokenTTL is short; clients renew with their refresh token
+const AccessTokenTTL = 15 * time.Minute
+
+// MFAChallengeTTL is how long a user has to enter their second factor after
+// their password
+const MFAChallengeTTL = 5 * time.Minute
+
+const mfaChallengePurpose = "mfa"
+
+var (
+	signingKeys = map[string][]byte{}
+	activeKeyID string
+)
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// MFAChallengeClaims prove the password step of a login. They carry no
+// session, so ValidateToken never accepts them as access tokens.
+type MFAChallengeClaims struct {
+	UserID  string `json:"user_id"`
+	Purpose string `json:"purpose"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID string) (string, error) {
+// LoadSigningKeys reads HS256 keys from JWT_SIGNING_KEYS ("kid1:secret1,kid2:secret2")
+// and signs with JWT_ACTIVE_KEY_ID, or the first key. Keep a retired key in
+// the list until the tokens it signed have expired to rotate without logging
+// everyone out. Without configuration a random key is used, so tokens stop
+// working when the server restarts.
+func LoadSigningKeys() error {
+	keys := map[string][]byte{}
+	var firstID string
+	for _, entry := range strings.Split(os.Getenv("JWT_SIGNING_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || len(secret) < 32 {
+			return fmt.Errorf("JWT_SIGNING_KEYS: entries must be kid:secret with a secret of at least 32 characters")
+		}
+		keys[kid] = []byte(secret)
+		if firstID == "" {
+			firstID = kid
+		}
+	}
+
+	if len(keys) == 0 {
+		log.Println("Warning: JWT_SIGNING_KEYS not set, using a random signing key. Local tokens will not survive a restart.")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		firstID = "ephemeral"
+		keys[firstID] = secret
+	}
+
+	active := os.Getenv("JWT_ACTIVE_KEY_ID")
+	if active == "" {
+		active = firstID
+	}
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("JWT_ACTIVE_KEY_ID %q is not in JWT_SIGNING_KEYS", active)
+	}
+
+	signingKeys = keys
+	activeKeyID = active
+	return nil
+}
+
+// GenerateToken issues a short-lived access token for a session
+func GenerateToken(userID, sessionID string) (string, error) {
+	if activeKeyID == "" {
+		return "", errors.New("signing keys not loaded")
+	}
+
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	return sign(claims)
+}
+
+// GenerateMFAChallenge issues the token exchanged, together with a TOTP or
+// recovery code, for a session
+func GenerateMFAChallenge(userID string) (string, error) {
+	if activeKeyID == "" {
+		return "", errors.New("signing keys not loaded")
+	}
+
+	return sign(&MFAChallengeClaims{
+		UserID:  userID,
+		Purpose: mfaChallengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
+
+// ValidateMFAChallenge returns the user a challenge token was issued to
+func ValidateMFAChallenge(tokenString string) (string, error) {
+	claims := &MFAChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFor, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+	if err != nil {
+		return "", err
+	}
+	if !token.Valid || claims.Purpose != mfaChallengePurpose || claims.UserID == "" {
+		return "", errors.New("invalid token")
+	}
+	return claims.UserID, nil
+}
+
+func sign(claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+	token.Header["kid"] = activeKeyID
+	return token.SignedString(signingKeys[activeKeyID])
+}
+
+// keyFor picks the verification key named by a token's kid header
+func keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := signingKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyFor, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.SessionID != "" {
 		return claims, nil
 	}
 
@@ -0,0 +1,269 @@
+// Package chart lays out and renders printable family tree charts:
+// pedigree charts of a person's ancestors and descendant charts with
+// spouses side by side. Layouts render to SVG, PNG or multi-page PDF
+// without outside dependencies.
+package chart
+
+import (
+	"image"
+)
+
+// Kind is the shape of a chart
+type Kind string
+
+const (
+	Pedigree   Kind = "pedigree"   // The root person and their ancestors
+	Descendant Kind = "descendant" // The root person and their descendants
+)
+
+// Orientation is the direction generations run in
+type Orientation string
+
+const (
+	Vertical   Orientation = "vertical"   // Ancestors above, descendants below
+	Horizontal Orientation = "horizontal" // The root on the left, generations to the right
+)
+
+// Person is what a box on the chart shows
+type Person struct {
+	ID     string
+	Name   string
+	Dates  string // Already formatted, e.g. "1920 - 1994"; empty to leave out
+	Gender string
+	Photo  image.Image // Drawn when the chart has photos; nil for a placeholder
+}
+
+// Node is a person with the spouses drawn beside them and the next
+// generation outward from the root: parents in a pedigree chart, children
+// in a descendant chart
+type Node struct {
+	Person  Person
+	Spouses []Person
+	Next    []*Node
+	Hidden  int // Persons in a collapsed branch beyond this node, drawn as "+N"
+}
+
+// Options controls the layout
+type Options struct {
+	Kind        Kind
+	Orientation Orientation
+	Photos      bool // Leave room for a photo in each box
+}
+
+// Box sizes and gaps, in points
+const (
+	boxWidth      = 180
+	boxHeight     = 56
+	photoSize     = 44
+	spouseGap     = 16
+	siblingGap    = 24
+	generationGap = 56
+	margin        = 24
+)
+
+// Point is a position on the chart, in points from the top left
+type Point struct {
+	X, Y float64
+}
+
+// Box is a placed person
+type Box struct {
+	X, Y, W, H float64
+	Person     Person
+	Hidden     int
+	Root       bool
+}
+
+// Chart is a laid out chart
+type Chart struct {
+	Width, Height float64
+	Photos        bool
+	Boxes         []Box
+	Lines         [][]Point // Connectors, as polylines
+}
+
+// Layout places the tree under root. Each subtree gets a band across the
+// generations wide enough for it and its descendants in the chart, and a
+// person is centered over the band of the next generation.
+func Layout(root *Node, opts Options) *Chart {
+	l := &layout{opts: opts, chart: &Chart{Photos: opts.Photos}}
+	l.cross, l.main = boxWidth, boxHeight
+	if opts.Orientation == Horizontal {
+		l.cross, l.main = boxHeight, boxWidth
+	}
+
+	l.measure(root)
+	l.place(root, margin, 0)
+
+	// Pedigree charts drawn vertically have the root at the bottom
+	depth := l.maxGeneration + 1
+	mainSize := float64(depth)*l.main + float64(depth-1)*generationGap
+	if opts.Kind == Pedigree && opts.Orientation != Horizontal {
+		for i := range l.chart.Boxes {
+			l.chart.Boxes[i].Y = 2*margin + mainSize - l.chart.Boxes[i].Y - l.chart.Boxes[i].H
+		}
+		for _, line := range l.chart.Lines {
+			for i := range line {
+				line[i].Y = 2*margin + mainSize - line[i].Y
+			}
+		}
+	}
+
+	crossSize := l.spans[root] + 2*margin
+	if opts.Orientation == Horizontal {
+		l.chart.Width, l.chart.Height = mainSize+2*margin, crossSize
+	} else {
+		l.chart.Width, l.chart.Height = crossSize, mainSize+2*margin
+	}
+	return l.chart
+}
+
+type layout struct {
+	opts          Options
+	chart         *Chart
+	cross, main   float64 // Box size across and along the generations
+	spans         map[*Node]float64
+	maxGeneration int
+}
+
+// group is the size across the generations of a person and their spouses
+func (l *layout) group(n *Node) float64 {
+	count := float64(1 + len(n.Spouses))
+	return count*l.cross + (count-1)*spouseGap
+}
+
+// measure computes the band each subtree needs
+func (l *layout) measure(n *Node) float64 {
+	if l.spans == nil {
+		l.spans = map[*Node]float64{}
+	}
+	next := 0.0
+	for i, child := range n.Next {
+		if i > 0 {
+			next += siblingGap
+		}
+		next += l.measure(child)
+	}
+	span := max(l.group(n), next)
+	l.spans[n] = span
+	return span
+}
+
+// place puts a subtree in the band starting at start and returns the
+// position across the generations of the person's box center
+func (l *layout) place(n *Node, start float64, generation int) float64 {
+	l.maxGeneration = max(l.maxGeneration, generation)
+	span := l.spans[n]
+	along := margin + float64(generation)*(l.main+generationGap)
+
+	groupStart := start + (span-l.group(n))/2
+	people := append([]Person{n.Person}, n.Spouses...)
+	var centers []float64
+	for i, p := range people {
+		at := groupStart + float64(i)*(l.cross+spouseGap)
+		box := l.box(at, along, p)
+		if i == 0 {
+			box.Hidden, box.Root = n.Hidden, generation == 0
+		}
+		l.chart.Boxes = append(l.chart.Boxes, box)
+		centers = append(centers, at+l.cross/2)
+	}
+	// Marriage lines between the person and each spouse
+	for i := 1; i < len(centers); i++ {
+		l.line(
+			[2]float64{centers[i-1] + l.cross/2, along + l.main/2},
+			[2]float64{centers[i] - l.cross/2, along + l.main/2},
+		)
+	}
+
+	// Children hang from the box, or from the middle of the marriage line
+	// between a couple
+	anchor := (centers[0] + centers[len(centers)-1]) / 2
+	from := along + l.main
+	if len(centers) > 1 {
+		anchor = (centers[0] + centers[1]) / 2
+		from = along + l.main/2
+	}
+	if len(n.Next) == 0 {
+		return centers[0]
+	}
+	next := 0.0
+	for i, child := range n.Next {
+		if i > 0 {
+			next += siblingGap
+		}
+		next += l.spans[child]
+	}
+	childStart := start + (span-next)/2
+	for _, child := range n.Next {
+		center := l.place(child, childStart, generation+1)
+		childStart += l.spans[child] + siblingGap
+
+		to := along + l.main + generationGap
+		mid := along + l.main + generationGap/2
+		l.line(
+			[2]float64{anchor, from},
+			[2]float64{anchor, mid},
+			[2]float64{center, mid},
+			[2]float64{center, to},
+		)
+	}
+	return centers[0]
+}
+
+// box places a person with cross and main coordinates
+func (l *layout) box(cross, main float64, p Person) Box {
+	if l.opts.Orientation == Horizontal {
+		return Box{X: main, Y: cross, W: l.main, H: l.cross, Person: p}
+	}
+	return Box{X: cross, Y: main, W: l.cross, H: l.main, Person: p}
+}
+
+// line adds a connector through cross and main coordinates
+func (l *layout) line(points ...[2]float64) {
+	line := make([]Point, len(points))
+	for i, p := range points {
+		if l.opts.Orientation == Horizontal {
+			line[i] = Point{X: p[1], Y: p[0]}
+		} else {
+			line[i] = Point{X: p[0], Y: p[1]}
+		}
+	}
+	l.chart.Lines = append(l.chart.Lines, line)
+}
+
+// textBox is the area of a box the name and dates are written in
+func (c *Chart) textBox(b Box) (x, w float64) {
+	const pad = 8
+	x, w = b.X+pad, b.W-2*pad
+	if c.Photos {
+		x += photoSize + pad/2
+		w -= photoSize + pad/2
+	}
+	return x, w
+}
+
+// photoBox is where a box's photo goes
+func (c *Chart) photoBox(b Box) (x, y, size float64) {
+	return b.X + (b.H-photoSize)/2, b.Y + (b.H-photoSize)/2, photoSize
+}
+
+// genderColor is a box's fill
+func genderColor(gender string) [3]uint8 {
+	switch gender {
+	case "male":
+		return [3]uint8{0xe3, 0xee, 0xfa}
+	case "female":
+		return [3]uint8{0xfb, 0xe6, 0xee}
+	}
+	return [3]uint8{0xf1, 0xf1, 0xf1}
+}
+
+var (
+	borderColor = [3]uint8{0x55, 0x5f, 0x6d}
+	rootColor   = [3]uint8{0x1f, 0x4e, 0x79}
+	lineColor   = [3]uint8{0x88, 0x8f, 0x99}
+	textColor   = [3]uint8{0x1b, 0x1f, 0x24}
+	mutedColor  = [3]uint8{0x5c, 0x63, 0x6e}
+	photoColor  = [3]uint8{0xd5, 0xd9, 0xde}
+)
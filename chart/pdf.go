@@ -0,0 +1,266 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"strings"
+)
+
+// Paper is a sheet size in points, portrait
+type Paper struct {
+	Width, Height float64
+}
+
+var Papers = map[string]Paper{
+	"a4":     {595, 842},
+	"a3":     {842, 1191},
+	"letter": {612, 792},
+}
+
+const (
+	pageMargin = 36 // Unprinted border of each sheet
+	footer     = 14 // Room under the chart for the sheet label
+)
+
+// PDF writes the chart at full size across as many sheets as it needs, to
+// be trimmed and taped together into a poster. Sheets are landscape when
+// that takes fewer of them, and each is labeled with its row and column.
+// Names are set in Helvetica, so other scripts are romanized (see latin).
+func PDF(w io.Writer, c *Chart, paper Paper) error {
+	cols, rows, pageW, pageH := sheets(c, paper.Width, paper.Height)
+	if lc, lr, lw, lh := sheets(c, paper.Height, paper.Width); lc*lr < cols*rows {
+		cols, rows, pageW, pageH = lc, lr, lw, lh
+	}
+	printW, printH := pageW-2*pageMargin, pageH-2*pageMargin-footer
+
+	doc := &pdfWriter{}
+	doc.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	catalog, pages := doc.reserve(), doc.reserve()
+	regular := doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	bold := doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	// Each photo is stored once and drawn on every sheet it reaches
+	photos := map[image.Image]string{}
+	var xobjects []string
+	if c.Photos {
+		for _, box := range c.Boxes {
+			img := box.Person.Photo
+			if img == nil || photos[img] != "" {
+				continue
+			}
+			img = cropSquare(img)
+			var data bytes.Buffer
+			if err := jpeg.Encode(&data, img, &jpeg.Options{Quality: 85}); err != nil {
+				return err
+			}
+			b := img.Bounds()
+			id := doc.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode",
+				b.Dx(), b.Dy()), data.Bytes())
+			name := fmt.Sprintf("Im%d", len(photos)+1)
+			photos[box.Person.Photo] = name
+			xobjects = append(xobjects, fmt.Sprintf("/%s %d 0 R", name, id))
+		}
+	}
+	resources := fmt.Sprintf("<< /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject << %s >> >>", regular, bold, strings.Join(xobjects, " "))
+
+	var kids []string
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			p := &pdfPage{
+				offsetX: float64(col)*printW - pageMargin,
+				offsetY: float64(row)*printH - pageMargin,
+				height:  pageH,
+			}
+			p.draw(c, photos, pageMargin, pageMargin+footer, printW, printH)
+			if cols*rows > 1 {
+				p.label(fmt.Sprintf("Sheet %d of %d - row %d, column %d", row*cols+col+1, cols*rows, row+1, col+1), pageMargin, pageMargin)
+			}
+			content := doc.stream("", p.buf.Bytes())
+			kids = append(kids, fmt.Sprintf("%d 0 R", doc.object(fmt.Sprintf(
+				"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %g %g] /Resources %s /Contents %d 0 R >>",
+				pages, pageW, pageH, resources, content))))
+		}
+	}
+	doc.define(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	doc.define(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	doc.finish(catalog)
+
+	_, err := w.Write(doc.buf.Bytes())
+	return err
+}
+
+// sheets is how many columns and rows of pages of a size the chart needs
+func sheets(c *Chart, pageW, pageH float64) (cols, rows int, w, h float64) {
+	cols = int(math.Ceil(c.Width / (pageW - 2*pageMargin)))
+	rows = int(math.Ceil(c.Height / (pageH - 2*pageMargin - footer)))
+	return max(cols, 1), max(rows, 1), pageW, pageH
+}
+
+// cropSquare cuts the middle square out of a photo
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return img
+	}
+	x, y := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	return sub.SubImage(image.Rect(x, y, x+side, y+side))
+}
+
+// pdfPage is the content stream of one sheet. Chart points map to page
+// points shifted by the sheet's offset, with y flipped to PDF's bottom-up
+// axis.
+type pdfPage struct {
+	buf              bytes.Buffer
+	offsetX, offsetY float64
+	height           float64
+}
+
+func (p *pdfPage) x(v float64) float64 { return v - p.offsetX }
+func (p *pdfPage) y(v float64) float64 { return p.height - (v - p.offsetY) }
+
+func (p *pdfPage) op(format string, args ...interface{}) {
+	fmt.Fprintf(&p.buf, format+"\n", args...)
+}
+
+func (p *pdfPage) draw(c *Chart, photos map[image.Image]string, clipX, clipY, clipW, clipH float64) {
+	p.op("q %g %g %g %g re W n", clipX, clipY, clipW, clipH)
+
+	p.op("%s RG 1.2 w", pdfColor(lineColor))
+	for _, line := range c.Lines {
+		for i, pt := range line {
+			verb := "l"
+			if i == 0 {
+				verb = "m"
+			}
+			p.op("%.2f %.2f %s", p.x(pt.X), p.y(pt.Y), verb)
+		}
+		p.op("S")
+	}
+
+	for _, box := range c.Boxes {
+		border, width := borderColor, 1.0
+		if box.Root {
+			border, width = rootColor, 2.5
+		}
+		p.op("%s rg %s RG %g w", pdfColor(genderColor(box.Person.Gender)), pdfColor(border), width)
+		p.op("%.2f %.2f %.2f %.2f re B", p.x(box.X), p.y(box.Y+box.H), box.W, box.H)
+
+		if c.Photos {
+			x, y, size := c.photoBox(box)
+			if name := photos[box.Person.Photo]; name != "" {
+				p.op("q %g 0 0 %g %.2f %.2f cm /%s Do Q", size, size, p.x(x), p.y(y+size), name)
+			} else {
+				p.op("%s rg %.2f %.2f %g %g re f", pdfColor(photoColor), p.x(x), p.y(y+size), size, size)
+			}
+		}
+
+		x, w := c.textBox(box)
+		nameY := box.Y + box.H/2 + 4
+		if box.Person.Dates != "" {
+			nameY = box.Y + box.H/2 - 2
+		}
+		measure := func(size float64) func(string) float64 {
+			return func(s string) float64 { return textWidth(s, size) }
+		}
+		name := fit(latin(box.Person.Name), w, measure(nameSize))
+		p.text("F2", nameSize, textColor, p.x(x), p.y(nameY), name)
+		if box.Person.Dates != "" {
+			dates := fit(latin(box.Person.Dates), w, measure(datesSize))
+			p.text("F1", datesSize, mutedColor, p.x(x), p.y(box.Y+box.H/2+13), dates)
+		}
+
+		if box.Hidden > 0 {
+			bx, by := badgePosition(box)
+			p.circle(p.x(bx), p.y(by), 11, rootColor)
+			label := fmt.Sprintf("+%d", box.Hidden)
+			p.text("F1", badgeSize, [3]uint8{0xff, 0xff, 0xff}, p.x(bx)-textWidth(label, badgeSize)/2, p.y(by+3), label)
+		}
+	}
+	p.op("Q")
+}
+
+// label writes the sheet's position under its printed area
+func (p *pdfPage) label(s string, x, y float64) {
+	p.text("F1", 8, mutedColor, x, y, s)
+}
+
+func (p *pdfPage) text(font string, size float64, c [3]uint8, x, y float64, s string) {
+	p.op("BT /%s %g Tf %s rg %.2f %.2f Td (%s) Tj ET", font, size, pdfColor(c), x, y, pdfEscape(s))
+}
+
+// circle fills a circle drawn with four Bézier curves
+func (p *pdfPage) circle(cx, cy, r float64, c [3]uint8) {
+	k := r * 0.5523
+	p.op("%s rg", pdfColor(c))
+	p.op("%.2f %.2f m", cx+r, cy)
+	p.op("%.2f %.2f %.2f %.2f %.2f %.2f c", cx+r, cy+k, cx+k, cy+r, cx, cy+r)
+	p.op("%.2f %.2f %.2f %.2f %.2f %.2f c", cx-k, cy+r, cx-r, cy+k, cx-r, cy)
+	p.op("%.2f %.2f %.2f %.2f %.2f %.2f c", cx-r, cy-k, cx-k, cy-r, cx, cy-r)
+	p.op("%.2f %.2f %.2f %.2f %.2f %.2f c f", cx+k, cy-r, cx+r, cy-k, cx+r, cy)
+}
+
+func pdfColor(c [3]uint8) string {
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(c[0])/255, float64(c[1])/255, float64(c[2])/255)
+}
+
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+
+func pdfEscape(s string) string {
+	return pdfEscaper.Replace(s)
+}
+
+// pdfWriter assembles numbered objects and the cross-reference table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int // By object number - 1; 0 until written
+}
+
+func (d *pdfWriter) write(s string) {
+	d.buf.WriteString(s)
+}
+
+// reserve allocates an object number to define later
+func (d *pdfWriter) reserve() int {
+	d.offsets = append(d.offsets, 0)
+	return len(d.offsets)
+}
+
+func (d *pdfWriter) define(id int, body string) {
+	d.offsets[id-1] = d.buf.Len()
+	fmt.Fprintf(&d.buf, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (d *pdfWriter) object(body string) int {
+	id := d.reserve()
+	d.define(id, body)
+	return id
+}
+
+func (d *pdfWriter) stream(dict string, data []byte) int {
+	id := d.reserve()
+	d.offsets[id-1] = d.buf.Len()
+	if dict != "" {
+		dict += " "
+	}
+	fmt.Fprintf(&d.buf, "%d 0 obj\n<< %s/Length %d >>\nstream\n", id, dict, len(data))
+	d.buf.Write(data)
+	d.buf.WriteString("\nendstream\nendobj\n")
+	return id
+}
+
+func (d *pdfWriter) finish(root int) {
+	xref := d.buf.Len()
+	fmt.Fprintf(&d.buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.offsets)+1)
+	for _, offset := range d.offsets {
+		fmt.Fprintf(&d.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&d.buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.offsets)+1, root, xref)
+}
@@ -0,0 +1,169 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// PNGScale is the default pixels per point, 144 dpi
+const PNGScale = 2
+
+// maxPNGPixels keeps a deep chart from allocating gigabytes
+const maxPNGPixels = 64 << 20
+
+var ErrTooLarge = errors.New("chart is too large for PNG; lower the depth, collapse branches or use SVG or PDF")
+
+// PNG rasterizes the chart at scale pixels per point. Names are written in
+// a built-in ASCII font, so other scripts are romanized (see latin).
+func PNG(w io.Writer, c *Chart, scale float64) error {
+	if scale <= 0 {
+		scale = PNGScale
+	}
+	width, height := int(math.Ceil(c.Width*scale)), int(math.Ceil(c.Height*scale))
+	if width*height > maxPNGPixels {
+		return fmt.Errorf("%w (%dx%d pixels)", ErrTooLarge, width, height)
+	}
+	r := &raster{img: image.NewRGBA(image.Rect(0, 0, width, height)), scale: scale}
+	draw.Draw(r.img, r.img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, line := range c.Lines {
+		for i := 1; i < len(line); i++ {
+			r.segment(line[i-1], line[i], 1.2, lineColor)
+		}
+	}
+
+	for _, box := range c.Boxes {
+		border, width := borderColor, 1.0
+		if box.Root {
+			border, width = rootColor, 2.5
+		}
+		r.rect(box.X, box.Y, box.W, box.H, border)
+		r.rect(box.X+width, box.Y+width, box.W-2*width, box.H-2*width, genderColor(box.Person.Gender))
+
+		if c.Photos {
+			x, y, size := c.photoBox(box)
+			if box.Person.Photo != nil {
+				r.photo(x, y, size, box.Person.Photo)
+			} else {
+				r.rect(x, y, size, size, photoColor)
+			}
+		}
+
+		x, w := c.textBox(box)
+		nameY, datesY := box.Y+box.H/2-4, 0.0
+		if box.Person.Dates != "" {
+			nameY, datesY = box.Y+box.H/2-12, box.Y+box.H/2+5
+		}
+		r.text(x, nameY, w, latin(box.Person.Name), nameSize, textColor, true)
+		if box.Person.Dates != "" {
+			r.text(x, datesY, w, latin(box.Person.Dates), datesSize, mutedColor, false)
+		}
+
+		if box.Hidden > 0 {
+			bx, by := badgePosition(box)
+			r.circle(bx, by, 11, rootColor)
+			label := fmt.Sprintf("+%d", box.Hidden)
+			lw := r.textWidth(label, badgeSize)
+			r.text(bx-lw/2, by-r.textHeight(badgeSize)/2, lw, label, badgeSize, [3]uint8{0xff, 0xff, 0xff}, false)
+		}
+	}
+	return png.Encode(w, r.img)
+}
+
+type raster struct {
+	img   *image.RGBA
+	scale float64
+}
+
+func rgba(c [3]uint8) color.RGBA {
+	return color.RGBA{c[0], c[1], c[2], 0xff}
+}
+
+// px converts points to pixels
+func (r *raster) px(v float64) int {
+	return int(math.Round(v * r.scale))
+}
+
+func (r *raster) rect(x, y, w, h float64, c [3]uint8) {
+	rect := image.Rect(r.px(x), r.px(y), r.px(x+w), r.px(y+h))
+	draw.Draw(r.img, rect, image.NewUniform(rgba(c)), image.Point{}, draw.Src)
+}
+
+// segment draws a horizontal or vertical line
+func (r *raster) segment(a, b Point, width float64, c [3]uint8) {
+	half := width / 2
+	r.rect(math.Min(a.X, b.X)-half, math.Min(a.Y, b.Y)-half, math.Abs(b.X-a.X)+width, math.Abs(b.Y-a.Y)+width, c)
+}
+
+func (r *raster) circle(cx, cy, radius float64, c [3]uint8) {
+	x0, y0, rad := r.px(cx), r.px(cy), r.px(radius)
+	fill := rgba(c)
+	for y := -rad; y <= rad; y++ {
+		for x := -rad; x <= rad; x++ {
+			if x*x+y*y <= rad*rad {
+				r.img.SetRGBA(x0+x, y0+y, fill)
+			}
+		}
+	}
+}
+
+// photo draws img cropped to a square and scaled to size
+func (r *raster) photo(x, y, size float64, img image.Image) {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	ox, oy := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	x0, y0, n := r.px(x), r.px(y), r.px(size)
+	for py := 0; py < n; py++ {
+		for px := 0; px < n; px++ {
+			r.img.Set(x0+px, y0+py, img.At(ox+px*side/n, oy+py*side/n))
+		}
+	}
+}
+
+// dot is the pixel size of one font cell at a font size
+func (r *raster) dot(size float64) int {
+	return max(1, int(math.Round(size*r.scale/10)))
+}
+
+// textWidth and textHeight are in points
+func (r *raster) textWidth(s string, size float64) float64 {
+	return float64(len(s)*6*r.dot(size)) / r.scale
+}
+
+func (r *raster) textHeight(size float64) float64 {
+	return float64(7*r.dot(size)) / r.scale
+}
+
+// text writes ASCII s from its top left corner, cut to fit in w points.
+// Bold text thickens each stroke by a pixel.
+func (r *raster) text(x, y, w float64, s string, size float64, c [3]uint8, bold bool) {
+	s = fit(s, w, func(s string) float64 { return r.textWidth(s, size) })
+	dot, fill := r.dot(size), image.NewUniform(rgba(c))
+	thick := dot
+	if bold {
+		thick++
+	}
+	left, top := r.px(x), r.px(y)
+	for i, ch := range s {
+		if ch < ' ' || ch > '~' {
+			ch = '?'
+		}
+		glyph := glyphs[ch-' ']
+		for col, bits := range glyph {
+			for row := 0; row < 7; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				px := left + (i*6+col)*dot
+				py := top + row*dot
+				draw.Draw(r.img, image.Rect(px, py, px+thick, py+dot), fill, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image/jpeg"
+	"io"
+	"strings"
+)
+
+// SVG writes the chart as a standalone SVG document. Photos are embedded,
+// so the file prints the same away from the server.
+func SVG(w io.Writer, c *Chart) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g" font-family="Helvetica, Arial, sans-serif">`+"\n",
+		c.Width, c.Height, c.Width, c.Height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	for _, line := range c.Lines {
+		points := make([]string, len(line))
+		for i, p := range line {
+			points[i] = fmt.Sprintf("%g,%g", p.X, p.Y)
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.2"/>`+"\n", strings.Join(points, " "), hexColor(lineColor))
+	}
+
+	for _, box := range c.Boxes {
+		border, width := borderColor, 1.0
+		if box.Root {
+			border, width = rootColor, 2.5
+		}
+		fmt.Fprintf(&b, `<g id="person-%s">`+"\n", html.EscapeString(box.Person.ID))
+		fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" rx="6" fill="%s" stroke="%s" stroke-width="%g"/>`+"\n",
+			box.X, box.Y, box.W, box.H, hexColor(genderColor(box.Person.Gender)), hexColor(border), width)
+
+		if c.Photos {
+			x, y, size := c.photoBox(box)
+			if box.Person.Photo != nil {
+				var photo bytes.Buffer
+				if err := jpeg.Encode(&photo, box.Person.Photo, &jpeg.Options{Quality: 85}); err != nil {
+					return err
+				}
+				fmt.Fprintf(&b, `<image x="%g" y="%g" width="%g" height="%g" preserveAspectRatio="xMidYMid slice" href="data:image/jpeg;base64,%s"/>`+"\n",
+					x, y, size, size, base64.StdEncoding.EncodeToString(photo.Bytes()))
+			} else {
+				fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g" rx="4" fill="%s"/>`+"\n", x, y, size, size, hexColor(photoColor))
+			}
+		}
+
+		x, w := c.textBox(box)
+		nameY, datesY := box.Y+box.H/2+4, 0.0
+		if box.Person.Dates != "" {
+			nameY, datesY = box.Y+box.H/2-2, box.Y+box.H/2+13
+		}
+		name := fit(box.Person.Name, w, func(s string) float64 { return textWidth(s, nameSize) })
+		fmt.Fprintf(&b, `<text x="%g" y="%g" font-size="%d" font-weight="bold" fill="%s">%s</text>`+"\n",
+			x, nameY, nameSize, hexColor(textColor), html.EscapeString(name))
+		if box.Person.Dates != "" {
+			dates := fit(box.Person.Dates, w, func(s string) float64 { return textWidth(s, datesSize) })
+			fmt.Fprintf(&b, `<text x="%g" y="%g" font-size="%d" fill="%s">%s</text>`+"\n",
+				x, datesY, datesSize, hexColor(mutedColor), html.EscapeString(dates))
+		}
+
+		if box.Hidden > 0 {
+			bx, by := badgePosition(box)
+			fmt.Fprintf(&b, `<circle cx="%g" cy="%g" r="11" fill="%s"/>`+"\n", bx, by, hexColor(rootColor))
+			fmt.Fprintf(&b, `<text x="%g" y="%g" font-size="%d" fill="#ffffff" text-anchor="middle">+%d</text>`+"\n",
+				bx, by+3, badgeSize, box.Hidden)
+		}
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// badgePosition is the center of a collapsed branch's "+N" marker, on the
+// top right corner of the box
+func badgePosition(b Box) (x, y float64) {
+	return b.X + b.W - 4, b.Y + 4
+}
+
+func hexColor(c [3]uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
@@ -0,0 +1,85 @@
+package chart
+
+import (
+	"strings"
+	"unicode"
+
+	"family-tree-backend/names"
+)
+
+// Font sizes, in points
+const (
+	nameSize  = 11
+	datesSize = 9
+	badgeSize = 9
+)
+
+// helveticaWidths are the advance widths of Helvetica for ' ' through '~',
+// in thousandths of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth is the width of s set in Helvetica at size. Letters outside
+// ASCII, such as Arabic in SVG charts, are counted as an average letter.
+func textWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			total += helveticaWidths[r-' ']
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// fit shortens s with an ellipsis until width says it fits in w
+func fit(s string, w float64, width func(string) float64) string {
+	if width(s) <= w {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		short := strings.TrimSpace(string(runes)) + "..."
+		if width(short) <= w {
+			return short
+		}
+	}
+	return ""
+}
+
+// latin rewrites text for the built-in fonts of PNG and PDF charts, which
+// only cover ASCII: accents are dropped and other scripts, such as Arabic,
+// romanized word by word
+func latin(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		if isASCII(word) {
+			continue
+		}
+		romanized := strings.ReplaceAll(names.Normalize(word), " ", "")
+		if romanized == "" {
+			romanized = "?"
+		}
+		r := []rune(romanized)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"family-tree-backend/gedcom"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	treeID := flag.String("tree", "", "family tree to import into (required)")
+	dryRun := flag.Bool("dry-run", false, "print the report without saving anything")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: import_gedcom -tree ID [-dry-run] file.ged")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *treeID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal("Failed to open file:", err)
+	}
+	defer file.Close()
+
+	doc, err := gedcom.Parse(file)
+	if err != nil {
+		log.Fatal("Failed to parse GEDCOM:", err)
+	}
+
+	result, err := gedcom.Import(doc, *treeID)
+	if err != nil {
+		log.Fatal("Failed to import GEDCOM:", err)
+	}
+	result.Report.DryRun = *dryRun
+
+	if !*dryRun {
+		// Get database URL from environment or use default
+		dbURL := os.Getenv("DATABASE_URL")
+		if dbURL == "" {
+			dbURL = "host=127.0.0.1 user=postgres password=postgres dbname=family_tree port=5432 sslmode=disable"
+		}
+
+		db, err := gorm.Open(postgres.Open(dbURL), &gorm.Config{})
+		if err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+
+		var tree models.FamilyTree
+		if err := db.First(&tree, "id = ?", *treeID).Error; err != nil {
+			log.Fatal("Failed to find family tree:", err)
+		}
+
+		// Imports from the command line have no acting user
+		if err := services.SaveGedcomImport(db, result, ""); err != nil {
+			log.Fatal("Failed to save import:", err)
+		}
+	}
+
+	report, _ := json.MarshalIndent(result.Report, "", "  ")
+	fmt.Println(string(report))
+
+	if *dryRun {
+		fmt.Printf("Dry run: %d persons and %d relationships would be imported\n", result.Report.Persons, result.Report.Relationships)
+	} else {
+		fmt.Printf("✅ Imported %d persons and %d relationships into %s\n", result.Report.Persons, result.Report.Relationships, *treeID)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	treeID := flag.String("tree", "", "family tree to check")
+	all := flag.Bool("all", false, "check every family tree")
+	asJSON := flag.Bool("json", false, "print the issues as JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: validate_tree (-tree ID | -all) [-json]")
+		fmt.Fprintln(os.Stderr, "exits with status 1 if any tree has errors")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (*treeID == "") == !*all {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Get database URL from environment or use default
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		dbURL = "host=127.0.0.1 user=postgres password=postgres dbname=family_tree port=5432 sslmode=disable"
+	}
+
+	db, err := gorm.Open(postgres.Open(dbURL), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	var trees []models.FamilyTree
+	query := db.Order("created_at")
+	if *treeID != "" {
+		query = query.Where("id = ?", *treeID)
+	}
+	if err := query.Find(&trees).Error; err != nil {
+		log.Fatal("Failed to load family trees:", err)
+	}
+	if len(trees) == 0 {
+		log.Fatal("No family tree found")
+	}
+
+	report := map[string][]services.Issue{}
+	errors := 0
+	for _, tree := range trees {
+		issues, err := services.ValidateTree(db, tree.ID)
+		if err != nil {
+			log.Fatalf("Failed to check %s: %v", tree.ID, err)
+		}
+		report[tree.ID] = issues
+		for _, issue := range issues {
+			if issue.Severity == services.SeverityError {
+				errors++
+			}
+		}
+
+		if !*asJSON {
+			fmt.Printf("%s (%s): %d issues\n", tree.Name, tree.ID, len(issues))
+			for _, issue := range issues {
+				fmt.Printf("  %-7s %-28s %s\n", issue.Severity, issue.Rule, issue.Message)
+			}
+		}
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else if errors == 0 {
+		fmt.Println("✅ No errors found")
+	}
+
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,161 @@
+package gedcom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"family-tree-backend/gendate"
+)
+
+var months = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var qualifiers = map[string]gendate.Qualifier{
+	"ABT": gendate.About, "CAL": gendate.About, "EST": gendate.About,
+	"BEF": gendate.Before, "TO": gendate.Before,
+	"AFT": gendate.After, "FROM": gendate.After,
+	"BET": gendate.Between, "INT": gendate.Exact,
+}
+
+// ParseDate converts a GEDCOM date value. Qualifiers map to gendate's: ABT,
+// CAL and EST are about; BEF and TO before; AFT and FROM after; BET ... AND
+// and FROM ... TO between. A date phrase that reads as a date, such as the
+// "(1330-01-02 AH)" FormatDate writes for Hijri dates, takes precedence.
+func ParseDate(value string) (*gendate.Date, error) {
+	text, phrase := strings.TrimSpace(value), ""
+	if i := strings.Index(text, "("); i >= 0 {
+		phrase = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text[i+1:]), ")"))
+		text = strings.TrimSpace(text[:i])
+	}
+	if phrase != "" {
+		if d, err := gendate.Parse(phrase); err == nil {
+			return d, nil
+		}
+	}
+
+	fields := strings.Fields(strings.ToUpper(text))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty date")
+	}
+
+	// Calendar escapes: 5.5.1 "@#DGREGORIAN@", 7.0 "GREGORIAN"
+	switch fields[0] {
+	case "@#DGREGORIAN@", "GREGORIAN":
+		fields = fields[1:]
+	case "@#DJULIAN@", "JULIAN", "@#DHEBREW@", "HEBREW", "@#DFRENCH", "FRENCH_R", "@#DROMAN@", "@#DUNKNOWN@":
+		return nil, fmt.Errorf("unsupported calendar in %q", value)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty date")
+	}
+
+	d := &gendate.Date{Qualifier: gendate.Exact, Calendar: gendate.Gregorian}
+	if q, ok := qualifiers[fields[0]]; ok {
+		d.Qualifier = q
+		fields = fields[1:]
+	}
+
+	var end []string
+	for i, f := range fields {
+		if (f == "AND" && d.Qualifier == gendate.Between) || (f == "TO" && d.Qualifier == gendate.After) {
+			fields, end = fields[:i], fields[i+1:]
+			d.Qualifier = gendate.Between
+			break
+		}
+	}
+	if d.Qualifier == gendate.Between && len(end) == 0 {
+		return nil, fmt.Errorf("range without an end in %q", value)
+	}
+
+	var err error
+	if d.Start, err = parsePart(fields); err != nil {
+		return nil, fmt.Errorf("%v in %q", err, value)
+	}
+	if len(end) > 0 {
+		if d.End, err = parsePart(end); err != nil {
+			return nil, fmt.Errorf("%v in %q", err, value)
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return nil, fmt.Errorf("%v in %q", err, value)
+	}
+	return d, nil
+}
+
+// parsePart reads "1890", "MAR 1890" or "12 MAR 1890"
+func parsePart(fields []string) (gendate.Part, error) {
+	var p gendate.Part
+	var err error
+	switch len(fields) {
+	case 1:
+		p.Year, err = parseYear(fields[0])
+	case 2:
+		p.Month = months[fields[0]]
+		p.Year, err = parseYear(fields[1])
+	case 3:
+		if p.Day, err = strconv.Atoi(fields[0]); err != nil {
+			return p, fmt.Errorf("invalid day")
+		}
+		p.Month = months[fields[1]]
+		p.Year, err = parseYear(fields[2])
+	default:
+		return p, fmt.Errorf("unrecognized date")
+	}
+	if len(fields) > 1 && p.Month == 0 {
+		return p, fmt.Errorf("unknown month")
+	}
+	if err != nil {
+		return p, fmt.Errorf("invalid year")
+	}
+	return p, nil
+}
+
+// parseYear accepts "1890" and dual years like "1699/00"
+func parseYear(s string) (int, error) {
+	if i := strings.Index(s, "/"); i > 0 {
+		s = s[:i]
+	}
+	return strconv.Atoi(s)
+}
+
+var monthNames = []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+// FormatDate renders a date in GEDCOM form, e.g. "2 JAN 1990", "ABT 1890" or
+// "BET 1850 AND 1855". GEDCOM has no Hijri calendar, so Hijri dates are
+// written in Gregorian; a single day keeps its Hijri form as the phrase of an
+// interpreted date, "INT 22 DEC 1911 (1330-01-02 AH)", which ParseDate reads
+// back.
+func FormatDate(d *gendate.Date) string {
+	if d.Calendar == gendate.Hijri {
+		gregorian := FormatDate(d.InCalendar(gendate.Gregorian))
+		if d.Qualifier == gendate.Exact && d.Precision() == gendate.PrecisionDay {
+			return "INT " + gregorian + " (" + d.String() + ")"
+		}
+		return gregorian
+	}
+
+	switch d.Qualifier {
+	case gendate.About:
+		return "ABT " + formatPart(d.Start)
+	case gendate.Before:
+		return "BEF " + formatPart(d.Start)
+	case gendate.After:
+		return "AFT " + formatPart(d.Start)
+	case gendate.Between:
+		return "BET " + formatPart(d.Start) + " AND " + formatPart(d.End)
+	}
+	return formatPart(d.Start)
+}
+
+func formatPart(p gendate.Part) string {
+	switch p.Precision() {
+	case gendate.PrecisionDay:
+		return fmt.Sprintf("%d %s %04d", p.Day, monthNames[p.Month], p.Year)
+	case gendate.PrecisionMonth:
+		return fmt.Sprintf("%s %04d", monthNames[p.Month], p.Year)
+	}
+	return fmt.Sprintf("%04d", p.Year)
+}
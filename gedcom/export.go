@@ -0,0 +1,664 @@
+package gedcom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+)
+
+// Longest value written on one line before it is continued with CONC
+const maxLineValue = 200
+
+// Life event titles written back as their GEDCOM tags. Anything else is
+// written as EVEN with a TYPE.
+var individualEventTags = map[string]string{}
+
+func init() {
+	for tag, title := range individualEvents {
+		if tag != "EVEN" && tag != "FACT" {
+			individualEventTags[title] = tag
+		}
+	}
+}
+
+// Tags whose value is the attribute itself rather than "Y"
+var attributeTags = map[string]bool{
+	"OCCU": true, "EDUC": true, "RELI": true, "TITL": true, "NATI": true, "PROP": true, "DSCR": true,
+}
+
+// family is one FAM record: up to two partners and their children
+type family struct {
+	xref     string
+	partners []string
+	spouse   *models.Relationship
+	children []*models.Relationship // parent_child edges from a partner, or nil for sibling-only families
+	childIDs []string
+}
+
+type exporter struct {
+	w           *bufio.Writer
+	byID        map[string]*models.Person
+	xrefs       map[string]string
+	families    []*family
+	famc        map[string][]*family
+	fams        map[string][]*family
+	consumed    map[string]bool // life event IDs written on a FAM record
+	sources     []models.Source
+	sourceXrefs map[string]string
+	citations   map[string][]models.Citation // by citationKey
+}
+
+// citationKey identifies the fact a citation supports
+func citationKey(fact models.CitationFact, id string) string {
+	return string(fact) + ":" + id
+}
+
+// Export writes persons and the edges between them as a GEDCOM 5.5.1 file,
+// the version most desktop genealogy software reads. Sources become SOUR
+// records, cited from the facts their citations support.
+func Export(w io.Writer, persons []models.Person, edges []models.Relationship, sources []models.Source, citations []models.Citation) error {
+	exp := &exporter{
+		w:           bufio.NewWriter(w),
+		byID:        map[string]*models.Person{},
+		xrefs:       map[string]string{},
+		famc:        map[string][]*family{},
+		fams:        map[string][]*family{},
+		consumed:    map[string]bool{},
+		sources:     sources,
+		sourceXrefs: map[string]string{},
+		citations:   map[string][]models.Citation{},
+	}
+	for i := range persons {
+		exp.byID[persons[i].ID] = &persons[i]
+		exp.xrefs[persons[i].ID] = fmt.Sprintf("@I%d@", i+1)
+	}
+	for i, source := range sources {
+		exp.sourceXrefs[source.ID] = fmt.Sprintf("@S%d@", i+1)
+	}
+	for _, c := range citations {
+		id := c.PersonID
+		switch c.Fact {
+		case models.CitationLifeEvent:
+			id = c.LifeEventID
+		case models.CitationRelationship:
+			id = c.RelationshipID
+		}
+		key := citationKey(c.Fact, id)
+		exp.citations[key] = append(exp.citations[key], c)
+	}
+	exp.buildFamilies(edges)
+
+	exp.header()
+	for i := range persons {
+		exp.individual(&persons[i])
+	}
+	for _, fam := range exp.families {
+		exp.family(fam)
+	}
+	exp.sourceRecords()
+	exp.line(0, "@SUBM1@ SUBM", "")
+	exp.line(1, "NAME", "Family Tree")
+	exp.line(0, "TRLR", "")
+	return exp.w.Flush()
+}
+
+// buildFamilies groups edges into FAM records. Each spouse edge is a family;
+// children join the family of their two parents, and parents without a
+// recorded partnership get a family of their own.
+func (exp *exporter) buildFamilies(edges []models.Relationship) {
+	byPair := map[string]*family{}
+	pairKey := func(a, b string) string {
+		if b != "" && b < a {
+			a, b = b, a
+		}
+		return a + "|" + b
+	}
+	newFamily := func(partners ...string) *family {
+		fam := &family{xref: fmt.Sprintf("@F%d@", len(exp.families)+1), partners: partners}
+		exp.families = append(exp.families, fam)
+		for _, id := range partners {
+			exp.fams[id] = append(exp.fams[id], fam)
+		}
+		return fam
+	}
+
+	parents := map[string][]*models.Relationship{}
+	var childOrder []string
+	var siblings []*models.Relationship
+
+	for i := range edges {
+		e := &edges[i]
+		if exp.byID[e.PersonID] == nil || exp.byID[e.RelatedPersonID] == nil {
+			continue
+		}
+		switch e.Type {
+		case models.RelationshipSpouse:
+			key := pairKey(e.PersonID, e.RelatedPersonID)
+			if byPair[key] == nil {
+				byPair[key] = newFamily(e.PersonID, e.RelatedPersonID)
+				byPair[key].spouse = e
+			}
+		case models.RelationshipParentChild:
+			if _, seen := parents[e.RelatedPersonID]; !seen {
+				childOrder = append(childOrder, e.RelatedPersonID)
+			}
+			parents[e.RelatedPersonID] = append(parents[e.RelatedPersonID], e)
+		case models.RelationshipSibling:
+			siblings = append(siblings, e)
+		}
+	}
+
+	addChild := func(fam *family, childID string, links ...*models.Relationship) {
+		fam.childIDs = append(fam.childIDs, childID)
+		fam.children = append(fam.children, links...)
+		exp.famc[childID] = append(exp.famc[childID], fam)
+	}
+
+	for _, childID := range childOrder {
+		links := parents[childID]
+		used := make([]bool, len(links))
+
+		// Parents who are partners share their existing family
+		for i := range links {
+			for j := i + 1; j < len(links); j++ {
+				if used[i] || used[j] {
+					continue
+				}
+				if fam := byPair[pairKey(links[i].PersonID, links[j].PersonID)]; fam != nil {
+					addChild(fam, childID, links[i], links[j])
+					used[i], used[j] = true, true
+				}
+			}
+		}
+
+		var rest []*models.Relationship
+		for i, link := range links {
+			if !used[i] {
+				rest = append(rest, link)
+			}
+		}
+		if len(rest) == 2 {
+			key := pairKey(rest[0].PersonID, rest[1].PersonID)
+			if byPair[key] == nil {
+				byPair[key] = newFamily(rest[0].PersonID, rest[1].PersonID)
+			}
+			addChild(byPair[key], childID, rest...)
+			continue
+		}
+		for _, link := range rest {
+			key := pairKey(link.PersonID, "")
+			if byPair[key] == nil {
+				byPair[key] = newFamily(link.PersonID)
+			}
+			addChild(byPair[key], childID, link)
+		}
+	}
+
+	// Siblings with no known parents share a family without partners
+	groups := map[string]*family{}
+	for _, e := range siblings {
+		a, b := groups[e.PersonID], groups[e.RelatedPersonID]
+		switch {
+		case a == nil && b == nil:
+			fam := newFamily()
+			addChild(fam, e.PersonID)
+			addChild(fam, e.RelatedPersonID)
+			groups[e.PersonID], groups[e.RelatedPersonID] = fam, fam
+		case a == nil:
+			addChild(b, e.PersonID)
+			groups[e.PersonID] = b
+		case b == nil:
+			addChild(a, e.RelatedPersonID)
+			groups[e.RelatedPersonID] = a
+		}
+	}
+}
+
+func (exp *exporter) header() {
+	exp.line(0, "HEAD", "")
+	exp.line(1, "SOUR", "FAMILY_TREE_BACKEND")
+	exp.line(2, "NAME", "Family Tree Backend")
+	exp.line(1, "DATE", FormatDate(gendate.FromTime(time.Now())))
+	exp.pointer(1, "SUBM", "@SUBM1@")
+	exp.line(1, "GEDC", "")
+	exp.line(2, "VERS", "5.5.1")
+	exp.line(2, "FORM", "LINEAGE-LINKED")
+	exp.line(1, "CHAR", "UTF-8")
+}
+
+func (exp *exporter) individual(p *models.Person) {
+	exp.line(0, exp.xrefs[p.ID]+" INDI", "")
+	exp.line(1, "NAME", strings.TrimSpace(fmt.Sprintf("%s /%s/", p.FirstName, p.LastName)))
+	if p.FirstName != "" {
+		exp.line(2, "GIVN", p.FirstName)
+	}
+	if p.LastName != "" {
+		exp.line(2, "SURN", p.LastName)
+	}
+
+	switch p.Gender {
+	case "male":
+		exp.line(1, "SEX", "M")
+	case "female":
+		exp.line(1, "SEX", "F")
+	default:
+		exp.line(1, "SEX", "U")
+	}
+	exp.cite(1, map[string]bool{}, citationKey(models.CitationPerson, p.ID))
+
+	// Family events are written once on the FAM record instead
+	for _, fam := range exp.fams[p.ID] {
+		exp.claimFamilyEvents(fam)
+	}
+
+	wroteBirth, wroteDeath := false, false
+	for _, event := range p.LifeEvents {
+		if exp.consumed[event.ID] {
+			continue
+		}
+		tag := individualEventTags[event.Title]
+		keys := []string{citationKey(models.CitationLifeEvent, event.ID)}
+		switch tag {
+		case "BIRT":
+			if wroteBirth {
+				tag = ""
+			} else {
+				wroteBirth = true
+				if p.BirthDate != nil {
+					event.Date = p.BirthDate
+				}
+				keys = append(keys, citationKey(models.CitationBirthDate, p.ID))
+			}
+		case "DEAT":
+			if wroteDeath {
+				tag = ""
+			} else {
+				wroteDeath = true
+				if p.DeathDate != nil {
+					event.Date = p.DeathDate
+				}
+				keys = append(keys, citationKey(models.CitationDeathDate, p.ID))
+			}
+		}
+		exp.event(1, tag, event)
+		exp.cite(2, map[string]bool{}, keys...)
+	}
+	if !wroteBirth && p.BirthDate != nil {
+		exp.event(1, "BIRT", models.LifeEvent{Date: p.BirthDate})
+		exp.cite(2, map[string]bool{}, citationKey(models.CitationBirthDate, p.ID))
+	}
+	if !wroteDeath && p.DeathDate != nil {
+		exp.event(1, "DEAT", models.LifeEvent{Date: p.DeathDate})
+		exp.cite(2, map[string]bool{}, citationKey(models.CitationDeathDate, p.ID))
+	}
+
+	if p.Bio != "" {
+		exp.line(1, "NOTE", p.Bio)
+	}
+
+	photos := []string{}
+	if p.ProfilePhotoURL != "" {
+		photos = append(photos, p.ProfilePhotoURL)
+	}
+	for _, photo := range p.Photos {
+		if photo != p.ProfilePhotoURL {
+			photos = append(photos, photo)
+		}
+	}
+	for _, photo := range photos {
+		exp.object(1, photo)
+	}
+
+	for _, fam := range exp.famc[p.ID] {
+		exp.pointer(1, "FAMC", fam.xref)
+		if pedi := exp.pedigree(fam, p.ID); pedi != "" {
+			exp.line(2, "PEDI", pedi)
+		}
+	}
+	for _, fam := range exp.fams[p.ID] {
+		exp.pointer(1, "FAMS", fam.xref)
+	}
+}
+
+// pedigree returns the PEDI value for a child in a family when both parents
+// agree on it. GEDCOM 5.5.1 has no value for step-children; those are carried
+// by _FREL/_MREL on the FAM record.
+func (exp *exporter) pedigree(fam *family, childID string) string {
+	qualifier := ""
+	for _, link := range fam.children {
+		if link.RelatedPersonID != childID {
+			continue
+		}
+		if qualifier != "" && qualifier != link.Qualifier {
+			return ""
+		}
+		qualifier = link.Qualifier
+	}
+	switch qualifier {
+	case models.ParentAdoptive:
+		return "adopted"
+	case models.ParentFoster:
+		return "foster"
+	case models.ParentBiological:
+		return "birth"
+	}
+	return ""
+}
+
+// claimFamilyEvents matches the partners' Marriage/Divorce life events to the
+// spouse edge so they are written on the FAM record and not repeated on
+// each INDI
+func (exp *exporter) claimFamilyEvents(fam *family) {
+	if fam.spouse == nil {
+		return
+	}
+	for _, id := range fam.partners {
+		for _, event := range exp.byID[id].LifeEvents {
+			var date *time.Time
+			switch event.Title {
+			case familyEvents["MARR"]:
+				date = fam.spouse.StartDate
+			case familyEvents["DIV"]:
+				date = fam.spouse.EndDate
+			default:
+				continue
+			}
+			if date == nil || event.Date.Time().Equal(*date) {
+				exp.consumed[event.ID] = true
+			}
+		}
+	}
+}
+
+// familyEvent finds the partners' life event backing a FAM event, for its place
+func (exp *exporter) familyEvent(fam *family, title string) models.LifeEvent {
+	for _, id := range fam.partners {
+		for _, event := range exp.byID[id].LifeEvents {
+			if event.Title == title && exp.consumed[event.ID] {
+				return event
+			}
+		}
+	}
+	return models.LifeEvent{Title: title}
+}
+
+// familyEventKeys are the citation keys of every partner's copy of a FAM event
+func (exp *exporter) familyEventKeys(fam *family, title string) []string {
+	var keys []string
+	for _, id := range fam.partners {
+		for _, event := range exp.byID[id].LifeEvents {
+			if event.Title == title && exp.consumed[event.ID] {
+				keys = append(keys, citationKey(models.CitationLifeEvent, event.ID))
+			}
+		}
+	}
+	return keys
+}
+
+func (exp *exporter) family(fam *family) {
+	exp.line(0, fam.xref+" FAM", "")
+
+	husband, wife := exp.partnerRoles(fam.partners)
+	if husband != "" {
+		exp.pointer(1, "HUSB", exp.xrefs[husband])
+	}
+	if wife != "" {
+		exp.pointer(1, "WIFE", exp.xrefs[wife])
+	}
+
+	// Sources cited for an event aren't repeated on the family itself
+	cited := map[string]bool{}
+	if fam.spouse != nil {
+		marriage := exp.familyEvent(fam, familyEvents["MARR"])
+		if fam.spouse.StartDate != nil && !marriage.Date.Time().Equal(*fam.spouse.StartDate) {
+			marriage.Date = gendate.FromTime(*fam.spouse.StartDate)
+		}
+		if !marriage.Date.IsZero() || marriage.ID != "" || fam.spouse.Qualifier != models.SpousePartner {
+			exp.event(1, "MARR", marriage)
+			exp.cite(2, cited, exp.familyEventKeys(fam, familyEvents["MARR"])...)
+		}
+
+		divorce := exp.familyEvent(fam, familyEvents["DIV"])
+		if fam.spouse.EndDate != nil && !divorce.Date.Time().Equal(*fam.spouse.EndDate) {
+			divorce.Date = gendate.FromTime(*fam.spouse.EndDate)
+		}
+		if fam.spouse.Qualifier == models.SpouseDivorced || divorce.ID != "" {
+			exp.event(1, "DIV", divorce)
+			exp.cite(2, cited, exp.familyEventKeys(fam, familyEvents["DIV"])...)
+		}
+	}
+
+	var edgeKeys []string
+	if fam.spouse != nil {
+		edgeKeys = append(edgeKeys, citationKey(models.CitationRelationship, fam.spouse.ID))
+	}
+	for _, link := range fam.children {
+		edgeKeys = append(edgeKeys, citationKey(models.CitationRelationship, link.ID))
+	}
+	exp.cite(1, cited, edgeKeys...)
+
+	for _, childID := range fam.childIDs {
+		exp.pointer(1, "CHIL", exp.xrefs[childID])
+		for _, link := range fam.children {
+			if link.RelatedPersonID != childID || link.Qualifier == models.ParentBiological {
+				continue
+			}
+			if link.PersonID == husband {
+				exp.line(2, "_FREL", relationValue(link.Qualifier))
+			} else if link.PersonID == wife {
+				exp.line(2, "_MREL", relationValue(link.Qualifier))
+			}
+		}
+	}
+}
+
+// sourceRecords writes a SOUR record per source, with a REPO record per
+// distinct repository
+func (exp *exporter) sourceRecords() {
+	repositories := map[string]string{}
+	var names []string
+	for _, source := range exp.sources {
+		if source.Repository != "" && repositories[source.Repository] == "" {
+			repositories[source.Repository] = fmt.Sprintf("@R%d@", len(names)+1)
+			names = append(names, source.Repository)
+		}
+	}
+
+	for _, source := range exp.sources {
+		exp.line(0, exp.sourceXrefs[source.ID]+" SOUR", "")
+		exp.line(1, "TITL", source.Title)
+		if source.Author != "" {
+			exp.line(1, "AUTH", source.Author)
+		}
+		if source.Repository != "" {
+			exp.pointer(1, "REPO", repositories[source.Repository])
+		}
+		if source.URL != "" {
+			exp.line(1, "_URL", source.URL)
+		}
+		if source.DocumentURL != "" {
+			exp.object(1, source.DocumentURL)
+		}
+	}
+	for _, name := range names {
+		exp.line(0, repositories[name]+" REPO", "")
+		exp.line(1, "NAME", name)
+	}
+}
+
+// cite writes the source citations stored under the given keys. The same
+// source, page, confidence and note is written once per seen set, since an
+// import records one citation line against each fact it covers.
+func (exp *exporter) cite(level int, seen map[string]bool, keys ...string) {
+	for _, key := range keys {
+		for _, c := range exp.citations[key] {
+			xref, ok := exp.sourceXrefs[c.SourceID]
+			signature := strings.Join([]string{c.SourceID, c.Page, string(c.Confidence), c.Note}, "\x00")
+			if !ok || seen[signature] {
+				continue
+			}
+			seen[signature] = true
+
+			exp.pointer(level, "SOUR", xref)
+			if c.Page != "" {
+				exp.line(level+1, "PAGE", c.Page)
+			}
+			if quay := confidenceQuay(c.Confidence); quay != "" {
+				exp.line(level+1, "QUAY", quay)
+			}
+			if c.Note != "" {
+				exp.line(level+1, "NOTE", c.Note)
+			}
+		}
+	}
+}
+
+// confidenceQuay is the QUAY value for a confidence, the reverse of
+// quayConfidence
+func confidenceQuay(confidence models.CitationConfidence) string {
+	switch confidence {
+	case models.ConfidenceUnreliable:
+		return "0"
+	case models.ConfidenceQuestionable:
+		return "1"
+	case models.ConfidenceSecondary:
+		return "2"
+	case models.ConfidencePrimary:
+		return "3"
+	}
+	return ""
+}
+
+// partnerRoles assigns HUSB and WIFE, by gender where it is known
+func (exp *exporter) partnerRoles(partners []string) (husband, wife string) {
+	ids := append([]string{}, partners...)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return exp.byID[ids[i]].Gender != "female" && exp.byID[ids[j]].Gender == "female"
+	})
+	switch len(ids) {
+	case 1:
+		if exp.byID[ids[0]].Gender == "female" {
+			return "", ids[0]
+		}
+		return ids[0], ""
+	case 2:
+		return ids[0], ids[1]
+	}
+	return "", ""
+}
+
+// relationValue is the Ancestry-style _FREL/_MREL value for a qualifier
+func relationValue(qualifier string) string {
+	switch qualifier {
+	case models.ParentAdoptive:
+		return "Adopted"
+	case models.ParentStep:
+		return "Step"
+	case models.ParentFoster:
+		return "Foster"
+	}
+	return "Natural"
+}
+
+// event writes a life event. An empty tag writes EVEN with the title as TYPE.
+func (exp *exporter) event(level int, tag string, event models.LifeEvent) {
+	description := event.Description
+	if tag == "" {
+		exp.line(level, "EVEN", "")
+		exp.line(level+1, "TYPE", event.Title)
+	} else if attributeTags[tag] && description != "" && !strings.Contains(description, "\n") {
+		// Attributes carry their value on the tag line, e.g. "1 OCCU Farmer"
+		exp.line(level, tag, description)
+		description = ""
+	} else if event.Date.IsZero() && event.Location == "" && event.Description == "" {
+		// "Y" asserts an event happened when nothing else is known
+		exp.line(level, tag, "Y")
+	} else {
+		exp.line(level, tag, "")
+	}
+	if !event.Date.IsZero() {
+		exp.line(level+1, "DATE", FormatDate(event.Date))
+	}
+	if event.Location != "" {
+		exp.line(level+1, "PLAC", event.Location)
+	}
+	if description != "" {
+		exp.line(level+1, "NOTE", description)
+	}
+	for _, photo := range event.Photos {
+		exp.object(level+1, photo)
+	}
+}
+
+// object writes a media link
+func (exp *exporter) object(level int, file string) {
+	exp.line(level, "OBJE", "")
+	exp.line(level+1, "FILE", file)
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(file)), "."); ext != "" && len(ext) <= 4 {
+		exp.line(level+2, "FORM", ext)
+	}
+}
+
+// pointer writes a line whose value is a cross-reference
+func (exp *exporter) pointer(level int, tag, xref string) {
+	fmt.Fprintf(exp.w, "%d %s %s\n", level, tag, xref)
+}
+
+// line writes one GEDCOM line, escaping "@" in the value and splitting long
+// or multi-line values into CONC and CONT lines. A record's own xref is
+// passed as part of the tag (e.g. "@I1@ INDI").
+func (exp *exporter) line(level int, tag, value string) {
+	if value == "" {
+		fmt.Fprintf(exp.w, "%d %s\n", level, tag)
+		return
+	}
+	value = strings.ReplaceAll(value, "@", "@@")
+
+	for i, text := range strings.Split(value, "\n") {
+		lineTag := tag
+		lineLevel := level
+		if i > 0 {
+			lineTag, lineLevel = "CONT", level+1
+		}
+		for {
+			chunk, rest := splitValue(text)
+			if chunk == "" {
+				fmt.Fprintf(exp.w, "%d %s\n", lineLevel, lineTag)
+			} else {
+				fmt.Fprintf(exp.w, "%d %s %s\n", lineLevel, lineTag, chunk)
+			}
+			if rest == "" {
+				break
+			}
+			text = rest
+			lineTag, lineLevel = "CONC", level+1
+		}
+	}
+}
+
+// splitValue cuts a value at maxLineValue bytes on a rune boundary, avoiding
+// a split next to a space since some readers trim line ends
+func splitValue(text string) (string, string) {
+	if len(text) <= maxLineValue {
+		return text, ""
+	}
+	cut := maxLineValue
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	for end := cut; end > maxLineValue/2; end-- {
+		if utf8.RuneStart(text[end]) && text[end] != ' ' && text[end-1] != ' ' {
+			cut = end
+			break
+		}
+	}
+	return text[:cut], text[cut:]
+}
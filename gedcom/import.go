@@ -0,0 +1,702 @@
+package gedcom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// ImportReport summarizes what an import did, or would do on a dry run
+type ImportReport struct {
+	Version       string         `json:"version"`
+	DryRun        bool           `json:"dryRun"`
+	Persons       int            `json:"persons"`
+	Families      int            `json:"families"`
+	Relationships int            `json:"relationships"`
+	LifeEvents    int            `json:"lifeEvents"`
+	Sources       int            `json:"sources"`
+	Citations     int            `json:"citations"`
+	Warnings      []string       `json:"warnings"`
+	UnmappedTags  map[string]int `json:"unmappedTags"` // tag path, e.g. "INDI.BIRT.SOUR", to occurrences
+}
+
+// ImportResult holds the records mapped from a GEDCOM document. Nothing is
+// written to the database by this package.
+type ImportResult struct {
+	Persons       []models.Person
+	Relationships []models.Relationship
+	Sources       []models.Source
+	Citations     []models.Citation
+	PersonIDs     map[string]string // GEDCOM xref -> person ID
+	Report        ImportReport
+}
+
+// Individual events and attributes that become life events
+var individualEvents = map[string]string{
+	"BIRT": "Birth", "DEAT": "Death", "BURI": "Burial", "CREM": "Cremation",
+	"BAPM": "Baptism", "CHR": "Christening", "ADOP": "Adoption", "CONF": "Confirmation",
+	"BARM": "Bar Mitzvah", "BASM": "Bat Mitzvah", "FCOM": "First Communion", "ORDN": "Ordination",
+	"GRAD": "Graduation", "EMIG": "Emigration", "IMMI": "Immigration", "NATU": "Naturalization",
+	"CENS": "Census", "RETI": "Retirement", "PROB": "Probate", "WILL": "Will",
+	"OCCU": "Occupation", "EDUC": "Education", "RESI": "Residence", "RELI": "Religion",
+	"TITL": "Title", "NATI": "Nationality", "PROP": "Property", "DSCR": "Description",
+	"EVEN": "Event", "FACT": "Fact",
+}
+
+// Family events that become life events on both spouses
+var familyEvents = map[string]string{
+	"MARR": "Marriage", "DIV": "Divorce", "ENGA": "Engagement", "ANUL": "Annulment",
+	"MARB": "Marriage Banns", "MARC": "Marriage Contract", "MARL": "Marriage License",
+	"DIVF": "Divorce Filed", "EVEN": "Event", "RESI": "Residence",
+}
+
+// Tags consumed while mapping that are not worth reporting
+var handledIndividualTags = map[string]bool{
+	"NAME": true, "SEX": true, "NOTE": true, "SNOTE": true, "OBJE": true,
+	"FAMS": true, "FAMC": true, "CHAN": true, "UID": true, "_UID": true, "SOUR": true,
+}
+
+var handledEventTags = map[string]bool{
+	"DATE": true, "PLAC": true, "ADDR": true, "TYPE": true, "NOTE": true, "AGE": true, "CAUS": true, "OBJE": true,
+	"SOUR": true,
+}
+
+type importer struct {
+	doc          *Document
+	familyTreeID string
+	result       *ImportResult
+	persons      map[string]*models.Person
+	notes        map[string]string
+	objects      map[string]string
+	edges        map[string]int    // type:from:to -> index in result.Relationships
+	pedigrees    map[string]string // INDI xref:FAM xref -> FAMC.PEDI
+	repositories map[string]string // REPO xref -> name
+	sources      map[string]string // SOUR xref, or inline source text -> source ID
+}
+
+// Import maps GEDCOM individuals and families to persons and relationship
+// edges in the given family tree. Files in which someone is their own
+// ancestor are rejected.
+func Import(doc *Document, familyTreeID string) (*ImportResult, error) {
+	imp := &importer{
+		doc:          doc,
+		familyTreeID: familyTreeID,
+		result: &ImportResult{
+			PersonIDs: map[string]string{},
+			Report: ImportReport{
+				Version:      doc.Version,
+				Warnings:     []string{},
+				UnmappedTags: map[string]int{},
+			},
+		},
+		persons:      map[string]*models.Person{},
+		notes:        map[string]string{},
+		objects:      map[string]string{},
+		edges:        map[string]int{},
+		pedigrees:    map[string]string{},
+		repositories: map[string]string{},
+		sources:      map[string]string{},
+	}
+
+	if cs := strings.ToUpper(doc.CharSet); cs != "" && cs != "UTF-8" && cs != "ASCII" && cs != "UNICODE" {
+		imp.warn("file declares character set %s; text was read as UTF-8 and accented letters may be wrong", doc.CharSet)
+	}
+
+	// Shared notes and media are referenced by pointer from individuals
+	for _, rec := range doc.Records {
+		switch rec.Tag {
+		case "NOTE", "SNOTE":
+			imp.notes[rec.XRef] = rec.Value
+		case "OBJE":
+			imp.objects[rec.XRef] = rec.ChildValue("FILE")
+		case "REPO":
+			imp.repositories[rec.XRef] = rec.ChildValue("NAME")
+		}
+	}
+	for _, rec := range doc.RecordsByTag("SOUR") {
+		imp.source(rec)
+	}
+
+	for _, rec := range doc.RecordsByTag("INDI") {
+		imp.individual(rec)
+		for _, famc := range rec.ChildrenByTag("FAMC") {
+			imp.pedigrees[rec.XRef+":"+famc.Value] = famc.ChildValue("PEDI")
+		}
+	}
+	for _, rec := range doc.RecordsByTag("FAM") {
+		imp.family(rec)
+	}
+
+	for _, rec := range doc.Records {
+		switch rec.Tag {
+		case "INDI", "FAM", "NOTE", "SNOTE", "OBJE", "SUBM", "SOUR", "REPO":
+		default:
+			imp.unmapped(rec.Tag)
+		}
+	}
+
+	// Keep the file's order so persons are created predictably
+	for _, rec := range doc.RecordsByTag("INDI") {
+		if p, ok := imp.persons[rec.XRef]; ok {
+			imp.result.Persons = append(imp.result.Persons, *p)
+			imp.result.Report.LifeEvents += len(p.LifeEvents)
+		}
+	}
+	imp.result.Report.Persons = len(imp.result.Persons)
+	imp.result.Report.Relationships = len(imp.result.Relationships)
+	imp.result.Report.Sources = len(imp.result.Sources)
+	imp.result.Report.Citations = len(imp.result.Citations)
+	if err := imp.checkAncestry(); err != nil {
+		return nil, err
+	}
+	return imp.result, nil
+}
+
+// checkAncestry rejects parent edges that loop back to an ancestor. Every
+// imported person is new, so the file's own edges are all there is to check.
+func (imp *importer) checkAncestry() error {
+	children := map[string][]string{}
+	for _, rel := range imp.result.Relationships {
+		if rel.Type == models.RelationshipParentChild {
+			children[rel.PersonID] = append(children[rel.PersonID], rel.RelatedPersonID)
+		}
+	}
+
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = onPath
+		path = append(path, id)
+		for _, child := range children[id] {
+			switch state[child] {
+			case onPath:
+				for i := range path {
+					if path[i] == child {
+						return append(path[i:], child)
+					}
+				}
+			case unvisited:
+				if loop := visit(child); loop != nil {
+					return loop
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+		return nil
+	}
+
+	xrefs := make(map[string]string, len(imp.result.PersonIDs))
+	for xref, id := range imp.result.PersonIDs {
+		xrefs[id] = xref
+	}
+	for _, rel := range imp.result.Relationships {
+		if rel.Type != models.RelationshipParentChild || state[rel.PersonID] != unvisited {
+			continue
+		}
+		if loop := visit(rel.PersonID); loop != nil {
+			for i, id := range loop {
+				loop[i] = xrefs[id]
+			}
+			return fmt.Errorf("individuals are their own ancestors: %s", strings.Join(loop, " -> "))
+		}
+	}
+	return nil
+}
+
+func (imp *importer) warn(format string, args ...interface{}) {
+	imp.result.Report.Warnings = append(imp.result.Report.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (imp *importer) unmapped(path string) {
+	imp.result.Report.UnmappedTags[path]++
+}
+
+func (imp *importer) individual(rec *Record) {
+	if rec.XRef == "" {
+		imp.warn("line %d: INDI record without an identifier was skipped", rec.Line)
+		return
+	}
+
+	person := &models.Person{
+		ID:           uuid.New().String(),
+		FamilyTreeID: imp.familyTreeID,
+		Photos:       models.JSONStringArray{},
+		LifeEvents:   models.LifeEvents{},
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	imp.persons[rec.XRef] = person
+	imp.result.PersonIDs[rec.XRef] = person.ID
+
+	names := rec.ChildrenByTag("NAME")
+	if len(names) > 0 {
+		person.FirstName, person.LastName = splitName(names[0])
+		if len(names) > 1 {
+			imp.warn("%s: only the first of %d names was imported", rec.XRef, len(names))
+		}
+	}
+
+	switch strings.ToUpper(rec.ChildValue("SEX")) {
+	case "M":
+		person.Gender = "male"
+	case "F":
+		person.Gender = "female"
+	}
+
+	var bio []string
+	for _, child := range rec.Children {
+		if label, ok := individualEvents[child.Tag]; ok {
+			event := imp.lifeEvent(rec.XRef, "INDI", child, label)
+			dateFact := models.CitationFact("")
+			switch child.Tag {
+			case "BIRT":
+				if person.BirthDate == nil && !event.Date.IsZero() {
+					person.BirthDate = event.Date
+					dateFact = models.CitationBirthDate
+				}
+			case "DEAT":
+				if person.DeathDate == nil && !event.Date.IsZero() {
+					person.DeathDate = event.Date
+					dateFact = models.CitationDeathDate
+				}
+			}
+			person.LifeEvents = append(person.LifeEvents, event)
+			for _, sour := range child.ChildrenByTag("SOUR") {
+				imp.cite(rec.XRef, sour, models.Citation{Fact: models.CitationLifeEvent, PersonID: person.ID, LifeEventID: event.ID})
+				if dateFact != "" {
+					imp.cite(rec.XRef, sour, models.Citation{Fact: dateFact, PersonID: person.ID})
+				}
+			}
+			continue
+		}
+
+		switch child.Tag {
+		case "NOTE", "SNOTE":
+			if note := imp.noteText(child); note != "" {
+				bio = append(bio, note)
+			}
+		case "SOUR":
+			imp.cite(rec.XRef, child, models.Citation{Fact: models.CitationPerson, PersonID: person.ID})
+		case "OBJE":
+			if file := imp.objectFile(child); file != "" {
+				person.Photos = append(person.Photos, file)
+				if person.ProfilePhotoURL == "" {
+					person.ProfilePhotoURL = file
+				}
+			}
+		default:
+			if !handledIndividualTags[child.Tag] {
+				imp.unmapped("INDI." + child.Tag)
+			}
+		}
+	}
+	person.Bio = strings.Join(bio, "\n\n")
+}
+
+// splitName reads "Given /Surname/ Suffix" with GIVN/SURN overriding
+func splitName(name *Record) (first, last string) {
+	value := name.Value
+	if start := strings.Index(value, "/"); start >= 0 {
+		rest := value[start+1:]
+		end := strings.Index(rest, "/")
+		if end < 0 {
+			end = len(rest)
+		}
+		first = strings.TrimSpace(value[:start])
+		last = strings.TrimSpace(rest[:end])
+	} else {
+		first = strings.TrimSpace(value)
+	}
+	if givn := name.ChildValue("GIVN"); givn != "" {
+		first = givn
+	}
+	if surn := name.ChildValue("SURN"); surn != "" {
+		last = surn
+	}
+	return first, last
+}
+
+func (imp *importer) noteText(rec *Record) string {
+	if strings.HasPrefix(rec.Value, "@") {
+		note, ok := imp.notes[rec.Value]
+		if !ok {
+			imp.warn("line %d: reference to unknown note %s", rec.Line, rec.Value)
+		}
+		return note
+	}
+	return rec.Value
+}
+
+func (imp *importer) objectFile(rec *Record) string {
+	if strings.HasPrefix(rec.Value, "@") {
+		file, ok := imp.objects[rec.Value]
+		if !ok {
+			imp.warn("line %d: reference to unknown media object %s", rec.Line, rec.Value)
+		}
+		return file
+	}
+	return rec.ChildValue("FILE")
+}
+
+// lifeEvent maps an event or attribute structure. Attribute values (e.g. an
+// occupation) become the description.
+func (imp *importer) lifeEvent(owner, recordTag string, rec *Record, label string) models.LifeEvent {
+	event := models.LifeEvent{
+		ID:     uuid.New().String(),
+		Title:  label,
+		Photos: []string{},
+	}
+
+	if eventType := rec.ChildValue("TYPE"); eventType != "" && (rec.Tag == "EVEN" || rec.Tag == "FACT") {
+		event.Title = eventType
+	}
+
+	var description []string
+	if value := strings.TrimSpace(rec.Value); value != "" && value != "Y" {
+		description = append(description, value)
+	}
+	if cause := rec.ChildValue("CAUS"); cause != "" {
+		description = append(description, "Cause: "+cause)
+	}
+
+	for _, child := range rec.Children {
+		switch child.Tag {
+		case "DATE":
+			date, err := ParseDate(child.Value)
+			if err != nil {
+				imp.warn("%s: %s date %q could not be read: %v", owner, strings.ToLower(label), child.Value, err)
+				description = append(description, "Date: "+child.Value)
+			} else {
+				event.Date = date
+			}
+		case "PLAC":
+			event.Location = child.Value
+		case "ADDR":
+			if event.Location == "" {
+				event.Location = child.Value
+			}
+		case "NOTE", "SNOTE":
+			if note := imp.noteText(child); note != "" {
+				description = append(description, note)
+			}
+		case "OBJE":
+			if file := imp.objectFile(child); file != "" {
+				event.Photos = append(event.Photos, file)
+			}
+		default:
+			if !handledEventTags[child.Tag] {
+				imp.unmapped(recordTag + "." + rec.Tag + "." + child.Tag)
+			}
+		}
+	}
+	event.Description = strings.Join(description, "\n")
+	return event
+}
+
+// pedigreeQualifier maps FAMC.PEDI and Ancestry's _FREL/_MREL values
+func pedigreeQualifier(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "adopted":
+		return models.ParentAdoptive
+	case "foster":
+		return models.ParentFoster
+	case "step", "stepchild":
+		return models.ParentStep
+	default:
+		return models.ParentBiological
+	}
+}
+
+func (imp *importer) family(rec *Record) {
+	imp.result.Report.Families++
+
+	lookup := func(tag string) (string, *models.Person) {
+		xref := rec.ChildValue(tag)
+		if xref == "" || xref == "@VOID@" {
+			return "", nil
+		}
+		p, ok := imp.persons[xref]
+		if !ok {
+			imp.warn("%s: %s refers to unknown individual %s", rec.XRef, tag, xref)
+			return "", nil
+		}
+		return xref, p
+	}
+	_, husband := lookup("HUSB")
+	_, wife := lookup("WIFE")
+
+	var spouses []*models.Person
+	for _, p := range []*models.Person{husband, wife} {
+		if p != nil {
+			spouses = append(spouses, p)
+		}
+	}
+
+	// The marriage is kept by index, as CHIL lines after it grow the slice
+	spouseIndex := -1
+	if husband != nil && wife != nil {
+		spouseIndex = imp.addEdge(husband.ID, wife.ID, models.RelationshipSpouse, models.SpouseMarried)
+	}
+
+	// Edges of the family, which family-level sources support
+	var edgeIDs []string
+	if spouseIndex >= 0 {
+		edgeIDs = append(edgeIDs, imp.edgeID(spouseIndex))
+	}
+
+	var firstChild *models.Person
+	var sources []*Record
+	for _, child := range rec.Children {
+		if label, ok := familyEvents[child.Tag]; ok {
+			event := imp.lifeEvent(rec.XRef, "FAM", child, label)
+			for _, p := range spouses {
+				e := event
+				e.ID = uuid.New().String()
+				p.LifeEvents = append(p.LifeEvents, e)
+				for _, sour := range child.ChildrenByTag("SOUR") {
+					imp.cite(rec.XRef, sour, models.Citation{Fact: models.CitationLifeEvent, PersonID: p.ID, LifeEventID: e.ID})
+				}
+			}
+			if spouseIndex < 0 {
+				continue
+			}
+			spouseEdge := &imp.result.Relationships[spouseIndex]
+			if child.Tag == "MARR" || child.Tag == "DIV" || child.Tag == "ANUL" {
+				for _, sour := range child.ChildrenByTag("SOUR") {
+					imp.cite(rec.XRef, sour, models.Citation{Fact: models.CitationRelationship, RelationshipID: spouseEdge.ID})
+				}
+			}
+			if !event.Date.IsZero() {
+				// Edges hold plain days; the life events keep the full date
+				d := event.Date.Time()
+				switch child.Tag {
+				case "MARR":
+					spouseEdge.StartDate = &d
+				case "DIV", "ANUL":
+					spouseEdge.EndDate = &d
+				}
+			}
+			if child.Tag == "DIV" || child.Tag == "ANUL" {
+				spouseEdge.Qualifier = models.SpouseDivorced
+			}
+			continue
+		}
+
+		switch child.Tag {
+		case "HUSB", "WIFE", "CHAN", "NCHI", "UID", "_UID":
+		case "SOUR":
+			sources = append(sources, child)
+		case "CHIL":
+			childPerson, ok := imp.persons[child.Value]
+			if !ok {
+				imp.warn("%s: CHIL refers to unknown individual %s", rec.XRef, child.Value)
+				continue
+			}
+			// A family without partners only records that its children are siblings
+			if husband == nil && wife == nil {
+				if firstChild == nil {
+					firstChild = childPerson
+				} else {
+					edgeIDs = append(edgeIDs, imp.edgeID(imp.addEdge(firstChild.ID, childPerson.ID, models.RelationshipSibling, "")))
+				}
+				continue
+			}
+			fatherQualifier, motherQualifier := imp.childQualifiers(rec.XRef, child)
+			if husband != nil {
+				edgeIDs = append(edgeIDs, imp.edgeID(imp.addEdge(husband.ID, childPerson.ID, models.RelationshipParentChild, fatherQualifier)))
+			}
+			if wife != nil {
+				edgeIDs = append(edgeIDs, imp.edgeID(imp.addEdge(wife.ID, childPerson.ID, models.RelationshipParentChild, motherQualifier)))
+			}
+		default:
+			imp.unmapped("FAM." + child.Tag)
+		}
+	}
+
+	// Sources on the family itself are cited for the marriage, or for the
+	// links among the members of a family without one
+	if spouseIndex >= 0 {
+		edgeIDs = edgeIDs[:1]
+	}
+	for _, sour := range sources {
+		for _, id := range edgeIDs {
+			imp.cite(rec.XRef, sour, models.Citation{Fact: models.CitationRelationship, RelationshipID: id})
+		}
+	}
+}
+
+// childQualifiers finds how a child relates to each parent of a family,
+// from _FREL/_MREL on the CHIL line or PEDI on the child's FAMC link
+func (imp *importer) childQualifiers(famXRef string, chil *Record) (father, mother string) {
+	if frel := chil.ChildValue("_FREL"); frel != "" {
+		father = pedigreeQualifier(frel)
+	}
+	if mrel := chil.ChildValue("_MREL"); mrel != "" {
+		mother = pedigreeQualifier(mrel)
+	}
+	if father != "" && mother != "" {
+		return father, mother
+	}
+
+	pedigree := pedigreeQualifier(imp.pedigrees[chil.Value+":"+famXRef])
+	if father == "" {
+		father = pedigree
+	}
+	if mother == "" {
+		mother = pedigree
+	}
+	return father, mother
+}
+
+// addEdge adds an edge once and returns its index in the result
+func (imp *importer) addEdge(from, to string, relType models.RelationshipType, qualifier string) int {
+	key := string(relType) + ":" + from + ":" + to
+	if i, ok := imp.edges[key]; ok {
+		return i
+	}
+	imp.edges[key] = len(imp.result.Relationships)
+	imp.result.Relationships = append(imp.result.Relationships, models.Relationship{
+		ID:              uuid.New().String(),
+		FamilyTreeID:    imp.familyTreeID,
+		PersonID:        from,
+		RelatedPersonID: to,
+		Type:            relType,
+		Qualifier:       qualifier,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	})
+	return len(imp.result.Relationships) - 1
+}
+
+func (imp *importer) edgeID(i int) string {
+	return imp.result.Relationships[i].ID
+}
+
+// source maps a SOUR record. The repository comes from a REPO pointer or an
+// inline REPO name; the scan from the first OBJE.
+func (imp *importer) source(rec *Record) {
+	if rec.XRef == "" {
+		imp.warn("line %d: SOUR record without an identifier was skipped", rec.Line)
+		return
+	}
+
+	source := models.Source{
+		ID:           uuid.New().String(),
+		FamilyTreeID: imp.familyTreeID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	for _, child := range rec.Children {
+		switch child.Tag {
+		case "TITL":
+			source.Title = child.Value
+		case "ABBR":
+			if source.Title == "" {
+				source.Title = child.Value
+			}
+		case "AUTH":
+			source.Author = child.Value
+		case "REPO":
+			if strings.HasPrefix(child.Value, "@") {
+				name, ok := imp.repositories[child.Value]
+				if !ok {
+					imp.warn("line %d: reference to unknown repository %s", child.Line, child.Value)
+				}
+				source.Repository = name
+			} else if name := child.ChildValue("NAME"); name != "" {
+				source.Repository = name
+			} else {
+				source.Repository = child.Value
+			}
+		case "WWW", "_URL", "_LINK":
+			if source.URL == "" {
+				source.URL = child.Value
+			}
+		case "OBJE":
+			if source.DocumentURL == "" {
+				source.DocumentURL = imp.objectFile(child)
+			}
+		case "CHAN", "UID", "_UID", "REFN":
+		default:
+			imp.unmapped("SOUR." + child.Tag)
+		}
+	}
+	if source.Title == "" {
+		source.Title = rec.XRef
+	}
+
+	imp.sources[rec.XRef] = source.ID
+	imp.result.Sources = append(imp.result.Sources, source)
+}
+
+// cite maps a source citation, "n SOUR @S1@" or 5.5.1's inline "n SOUR
+// text", onto the given fact. Inline sources with the same text share one
+// source.
+func (imp *importer) cite(owner string, sour *Record, citation models.Citation) {
+	sourceID, ok := imp.sources[sour.Value]
+	switch {
+	case strings.HasPrefix(sour.Value, "@") && !ok:
+		imp.warn("%s: citation of unknown source %s was skipped", owner, sour.Value)
+		return
+	case !ok:
+		title := strings.TrimSpace(sour.Value)
+		if title == "" {
+			imp.warn("%s: citation without a source was skipped", owner)
+			return
+		}
+		source := models.Source{
+			ID:           uuid.New().String(),
+			FamilyTreeID: imp.familyTreeID,
+			Title:        title,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		sourceID = source.ID
+		imp.sources[sour.Value] = sourceID
+		imp.result.Sources = append(imp.result.Sources, source)
+	}
+
+	citation.ID = uuid.New().String()
+	citation.FamilyTreeID = imp.familyTreeID
+	citation.SourceID = sourceID
+	citation.Page = sour.ChildValue("PAGE")
+	citation.Confidence = quayConfidence(sour.ChildValue("QUAY"))
+	var notes []string
+	for _, child := range sour.Children {
+		if child.Tag == "NOTE" || child.Tag == "SNOTE" {
+			if note := imp.noteText(child); note != "" {
+				notes = append(notes, note)
+			}
+		}
+	}
+	citation.Note = strings.Join(notes, "\n")
+	citation.CreatedAt = time.Now()
+	citation.UpdatedAt = time.Now()
+	imp.result.Citations = append(imp.result.Citations, citation)
+}
+
+// quayConfidence maps the 0-3 QUAY certainty assessment
+func quayConfidence(quay string) models.CitationConfidence {
+	switch strings.TrimSpace(quay) {
+	case "0":
+		return models.ConfidenceUnreliable
+	case "1":
+		return models.ConfidenceQuestionable
+	case "2":
+		return models.ConfidenceSecondary
+	case "3":
+		return models.ConfidencePrimary
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package gedcom
+
+import (
+	"strings"
+	"testing"
+
+	"family-tree-backend/models"
+)
+
+func TestImportFamilyEventsAfterChildren(t *testing.T) {
+	src := `0 HEAD
+1 GEDC
+2 VERS 5.5.1
+0 @I1@ INDI
+1 NAME John /Doe/
+0 @I2@ INDI
+1 NAME Jane /Roe/
+0 @I3@ INDI
+1 NAME Ann /Doe/
+1 FAMC @F1@
+2 PEDI adopted
+0 @I4@ INDI
+1 NAME Tom /Doe/
+0 @F1@ FAM
+1 HUSB @I1@
+1 WIFE @I2@
+1 CHIL @I3@
+1 CHIL @I4@
+1 MARR
+2 DATE 1 JAN 1950
+1 DIV
+2 DATE 1960
+0 TRLR
+`
+	doc, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Import(doc, "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spouse *models.Relationship
+	qualifiers := map[string]int{}
+	for i, r := range result.Relationships {
+		if r.Type == models.RelationshipSpouse {
+			spouse = &result.Relationships[i]
+		} else {
+			qualifiers[r.Qualifier]++
+		}
+	}
+	if spouse == nil {
+		t.Fatal("no spouse edge")
+	}
+	if spouse.Qualifier != models.SpouseDivorced {
+		t.Errorf("qualifier = %q, want %q", spouse.Qualifier, models.SpouseDivorced)
+	}
+	if spouse.StartDate == nil || spouse.StartDate.Year() != 1950 {
+		t.Errorf("start date = %v, want 1950", spouse.StartDate)
+	}
+	if spouse.EndDate == nil || spouse.EndDate.Year() != 1960 {
+		t.Errorf("end date = %v, want 1960", spouse.EndDate)
+	}
+	if qualifiers[models.ParentAdoptive] != 2 || qualifiers[models.ParentBiological] != 2 {
+		t.Errorf("parent qualifiers = %v, want 2 adoptive and 2 biological", qualifiers)
+	}
+}
+
+func TestImportRejectsAncestryLoops(t *testing.T) {
+	const individuals = `0 HEAD
+1 GEDC
+2 VERS 5.5.1
+0 @I1@ INDI
+0 @I2@ INDI
+0 @I3@ INDI
+`
+	tests := []struct {
+		name     string
+		families string
+		want     string // Error text, "" for a file that imports
+	}{
+		{"no loop", "0 @F1@ FAM\n1 HUSB @I1@\n1 CHIL @I2@\n0 @F2@ FAM\n1 HUSB @I2@\n1 CHIL @I3@\n", ""},
+		{"own parent", "0 @F1@ FAM\n1 HUSB @I1@\n1 CHIL @I1@\n", "@I1@ -> @I1@"},
+		{"grandchild is grandparent", "0 @F1@ FAM\n1 HUSB @I1@\n1 CHIL @I2@\n0 @F2@ FAM\n1 WIFE @I2@\n1 CHIL @I3@\n0 @F3@ FAM\n1 HUSB @I3@\n1 CHIL @I1@\n",
+			"@I1@ -> @I2@ -> @I3@ -> @I1@"},
+	}
+	for _, tt := range tests {
+		doc, err := Parse(strings.NewReader(individuals + tt.families + "0 TRLR\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Import(doc, "tree")
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error = %v, want one naming %s", tt.name, err, tt.want)
+		case tt.want != "" && result != nil:
+			t.Errorf("%s: a result came with the error", tt.name)
+		}
+	}
+}
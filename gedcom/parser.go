@@ -0,0 +1,176 @@
+// Package gedcom reads and writes GEDCOM 5.5.1 and 7.0 files and maps them
+// to the family tree models.
+package gedcom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Record is one GEDCOM structure with its substructures
+type Record struct {
+	Level    int
+	XRef     string // e.g. "@I1@", only on level 0 records
+	Tag      string
+	Value    string
+	Line     int
+	Children []*Record
+}
+
+// Child returns the first substructure with the given tag
+func (r *Record) Child(tag string) *Record {
+	for _, c := range r.Children {
+		if c.Tag == tag {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChildValue returns the value of the first substructure with the given tag
+func (r *Record) ChildValue(tag string) string {
+	if c := r.Child(tag); c != nil {
+		return c.Value
+	}
+	return ""
+}
+
+// ChildrenByTag returns every substructure with the given tag
+func (r *Record) ChildrenByTag(tag string) []*Record {
+	var out []*Record
+	for _, c := range r.Children {
+		if c.Tag == tag {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Document is a parsed GEDCOM file
+type Document struct {
+	Header  *Record
+	Records []*Record
+	Version string // from HEAD.GEDC.VERS, e.g. "5.5.1" or "7.0"
+	CharSet string // from HEAD.CHAR (5.5.1 only; 7.0 is always UTF-8)
+}
+
+// Records of a given level-0 tag, e.g. "INDI" or "FAM"
+func (d *Document) RecordsByTag(tag string) []*Record {
+	var out []*Record
+	for _, r := range d.Records {
+		if r.Tag == tag {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Parse reads a GEDCOM stream into a record tree. CONT and CONC lines are
+// folded into their parent's value.
+func Parse(r io.Reader) (*Document, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	doc := &Document{}
+	var stack []*Record
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		if lineNo == 1 {
+			raw = strings.TrimPrefix(raw, "\uFEFF")
+		}
+		raw = strings.TrimRight(raw, "\r")
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		rec, err := parseLine(strings.TrimLeft(raw, " \t"), lineNo)
+		if err != nil {
+			return nil, err
+		}
+
+		if rec.Level > len(stack) {
+			return nil, fmt.Errorf("line %d: level %d skips a level", lineNo, rec.Level)
+		}
+		stack = stack[:rec.Level]
+
+		if rec.Tag == "CONT" || rec.Tag == "CONC" {
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: %s without a parent", lineNo, rec.Tag)
+			}
+			parent := stack[len(stack)-1]
+			if rec.Tag == "CONT" {
+				parent.Value += "\n" + rec.Value
+			} else {
+				parent.Value += rec.Value
+			}
+			continue
+		}
+
+		if rec.Level == 0 {
+			if rec.Tag == "TRLR" {
+				break
+			}
+			if rec.Tag == "HEAD" {
+				doc.Header = rec
+			} else {
+				doc.Records = append(doc.Records, rec)
+			}
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, rec)
+		}
+		stack = append(stack, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if doc.Header == nil {
+		return nil, fmt.Errorf("not a GEDCOM file: missing HEAD record")
+	}
+
+	if gedc := doc.Header.Child("GEDC"); gedc != nil {
+		doc.Version = gedc.ChildValue("VERS")
+	}
+	doc.CharSet = doc.Header.ChildValue("CHAR")
+	return doc, nil
+}
+
+// parseLine splits "level [@xref@] TAG [value]"
+func parseLine(line string, lineNo int) (*Record, error) {
+	parts := strings.SplitN(line, " ", 2)
+	level, err := strconv.Atoi(parts[0])
+	if err != nil || level < 0 {
+		return nil, fmt.Errorf("line %d: invalid level %q", lineNo, parts[0])
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("line %d: missing tag", lineNo)
+	}
+
+	rec := &Record{Level: level, Line: lineNo}
+	rest := parts[1]
+	if strings.HasPrefix(rest, "@") {
+		end := strings.Index(rest[1:], "@")
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated cross-reference", lineNo)
+		}
+		rec.XRef = rest[:end+2]
+		rest = strings.TrimLeft(rest[end+2:], " ")
+	}
+
+	tagAndValue := strings.SplitN(rest, " ", 2)
+	rec.Tag = strings.ToUpper(tagAndValue[0])
+	if rec.Tag == "" {
+		return nil, fmt.Errorf("line %d: missing tag", lineNo)
+	}
+	if len(tagAndValue) == 2 {
+		// "@@" escapes a literal "@" in line values
+		rec.Value = strings.ReplaceAll(tagAndValue[1], "@@", "@")
+	}
+	return rec, nil
+}
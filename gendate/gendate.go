@@ -0,0 +1,431 @@
+// Package gendate handles genealogical dates: dates that are often partial
+// ("1890", "March 1890"), uncertain ("about 1890", "before 1920",
+// "between 1850 and 1855") or recorded in the Hijri calendar.
+package gendate
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Qualifier says how a date relates to the real one
+type Qualifier string
+
+const (
+	Exact   Qualifier = "exact"
+	About   Qualifier = "about"
+	Before  Qualifier = "before"
+	After   Qualifier = "after"
+	Between Qualifier = "between"
+)
+
+// Precision is the smallest unit a date gives
+type Precision string
+
+const (
+	PrecisionYear  Precision = "year"
+	PrecisionMonth Precision = "month"
+	PrecisionDay   Precision = "day"
+)
+
+// Calendar is the calendar a date was recorded in
+type Calendar string
+
+const (
+	Gregorian Calendar = "gregorian"
+	Hijri     Calendar = "hijri" // Tabular Islamic calendar; may differ from a sighted month by a day or two
+)
+
+// AboutYears is how far either side of an "about" date the real date may be
+const AboutYears = 2
+
+var ErrInvalid = errors.New("invalid date")
+
+// Part is a possibly partial date in a calendar. Month and Day are 0 when
+// unknown.
+type Part struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// Precision reports the smallest unit the part gives
+func (p Part) Precision() Precision {
+	switch {
+	case p.Day != 0:
+		return PrecisionDay
+	case p.Month != 0:
+		return PrecisionMonth
+	default:
+		return PrecisionYear
+	}
+}
+
+func (p Part) String() string {
+	switch p.Precision() {
+	case PrecisionDay:
+		return fmt.Sprintf("%04d-%02d-%02d", p.Year, p.Month, p.Day)
+	case PrecisionMonth:
+		return fmt.Sprintf("%04d-%02d", p.Year, p.Month)
+	default:
+		return fmt.Sprintf("%04d", p.Year)
+	}
+}
+
+// Date is a genealogical date. End is only used with Between.
+type Date struct {
+	Qualifier Qualifier
+	Calendar  Calendar
+	Start     Part
+	End       Part
+}
+
+// FromTime is the exact Gregorian day of t
+func FromTime(t time.Time) *Date {
+	return &Date{
+		Qualifier: Exact,
+		Calendar:  Gregorian,
+		Start:     Part{Year: t.Year(), Month: int(t.Month()), Day: t.Day()},
+	}
+}
+
+// IsZero reports whether the date is unset
+func (d *Date) IsZero() bool {
+	return d == nil || d.Start.Year == 0
+}
+
+// Precision is the precision of the (first) date
+func (d *Date) Precision() Precision {
+	return d.Start.Precision()
+}
+
+// String renders the canonical form Parse reads back, e.g. "about 1890",
+// "between 1850-03 and 1855", "1330-01-02 AH"
+func (d *Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	var s string
+	switch d.Qualifier {
+	case About, Before, After:
+		s = string(d.Qualifier) + " " + d.Start.String()
+	case Between:
+		s = "between " + d.Start.String() + " and " + d.End.String()
+	default:
+		s = d.Start.String()
+	}
+	if d.Calendar == Hijri {
+		s += " AH"
+	}
+	return s
+}
+
+// bounds returns the first and last Gregorian day a part covers
+func (d *Date) bounds(p Part) (time.Time, time.Time) {
+	if d.Calendar == Hijri {
+		first := Part{Year: p.Year, Month: max(p.Month, 1), Day: max(p.Day, 1)}
+		var next Part
+		switch p.Precision() {
+		case PrecisionDay:
+			return fromJDN(hijriToJDN(first)), fromJDN(hijriToJDN(first))
+		case PrecisionMonth:
+			next = Part{Year: p.Year, Month: p.Month + 1, Day: 1}
+			if p.Month == 12 {
+				next = Part{Year: p.Year + 1, Month: 1, Day: 1}
+			}
+		default:
+			next = Part{Year: p.Year + 1, Month: 1, Day: 1}
+		}
+		return fromJDN(hijriToJDN(first)), fromJDN(hijriToJDN(next) - 1)
+	}
+
+	first := time.Date(p.Year, time.Month(max(p.Month, 1)), max(p.Day, 1), 0, 0, 0, 0, time.UTC)
+	switch p.Precision() {
+	case PrecisionDay:
+		return first, first
+	case PrecisionMonth:
+		return first, first.AddDate(0, 1, -1)
+	default:
+		return first, first.AddDate(1, 0, -1)
+	}
+}
+
+// Earliest is the first Gregorian day the date could be. ok is false for
+// "before" dates, which have no lower bound.
+func (d *Date) Earliest() (t time.Time, ok bool) {
+	if d.IsZero() || d.Qualifier == Before {
+		return time.Time{}, false
+	}
+	first, last := d.bounds(d.Start)
+	switch d.Qualifier {
+	case About:
+		return first.AddDate(-AboutYears, 0, 0), true
+	case After:
+		return last.AddDate(0, 0, 1), true
+	}
+	return first, true
+}
+
+// Latest is the last Gregorian day the date could be. ok is false for
+// "after" dates, which have no upper bound.
+func (d *Date) Latest() (t time.Time, ok bool) {
+	if d.IsZero() || d.Qualifier == After {
+		return time.Time{}, false
+	}
+	first, last := d.bounds(d.Start)
+	switch d.Qualifier {
+	case About:
+		return last.AddDate(AboutYears, 0, 0), true
+	case Before:
+		return first.AddDate(0, 0, -1), true
+	case Between:
+		_, last = d.bounds(d.End)
+	}
+	return last, true
+}
+
+// Time is the Gregorian day the date sorts by: the start of what it gives,
+// or for "before" dates the day before
+func (d *Date) Time() time.Time {
+	if d.IsZero() {
+		return time.Time{}
+	}
+	if d.Qualifier == Before {
+		t, _ := d.Latest()
+		return t
+	}
+	first, _ := d.bounds(d.Start)
+	if d.Qualifier == After {
+		t, _ := d.Earliest()
+		return t
+	}
+	return first
+}
+
+// Compare orders dates by Time. Unset dates sort first.
+func Compare(a, b *Date) int {
+	return a.Time().Compare(b.Time())
+}
+
+// CertainlyBefore reports whether every day d could be is before every day
+// o could be. Unset or open-ended dates are never certainly before.
+func (d *Date) CertainlyBefore(o *Date) bool {
+	latest, ok := d.Latest()
+	if !ok {
+		return false
+	}
+	earliest, ok := o.Earliest()
+	return ok && latest.Before(earliest)
+}
+
+// Age is the range of whole years between birth and at. ok is false when
+// either date is unset or open-ended on the side that matters.
+func Age(birth, at *Date) (lowest, highest int, ok bool) {
+	bornLatest, ok1 := birth.Latest()
+	bornEarliest, ok2 := birth.Earliest()
+	atEarliest, ok3 := at.Earliest()
+	atLatest, ok4 := at.Latest()
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return 0, 0, false
+	}
+	return yearsBetween(bornLatest, atEarliest), yearsBetween(bornEarliest, atLatest), true
+}
+
+func yearsBetween(from, to time.Time) int {
+	years := to.Year() - from.Year()
+	if to.Month() < from.Month() || (to.Month() == from.Month() && to.Day() < from.Day()) {
+		years--
+	}
+	return years
+}
+
+// InCalendar converts a date to another calendar. Day-precision dates convert
+// exactly; coarser ones become the range of days they cover.
+func (d *Date) InCalendar(cal Calendar) *Date {
+	if d.IsZero() || d.Calendar == cal {
+		return d
+	}
+	convert := func(p Part) (Part, Part, bool) {
+		first, last := d.bounds(p)
+		a, b := partOf(first, cal), partOf(last, cal)
+		return a, b, p.Precision() == PrecisionDay
+	}
+
+	out := &Date{Qualifier: d.Qualifier, Calendar: cal}
+	start, startLast, exact := convert(d.Start)
+	switch {
+	case d.Qualifier == Between:
+		out.Start = start
+		_, out.End, _ = convert(d.End)
+	case exact:
+		out.Start = start
+	case d.Qualifier == Before:
+		out.Start = start
+	case d.Qualifier == After:
+		out.Start = startLast
+	case d.Qualifier == About:
+		// About a year keeps its rough position
+		out.Start = Part{Year: start.Year}
+	default:
+		out.Qualifier = Between
+		out.Start, out.End = start, startLast
+	}
+	return out
+}
+
+func partOf(t time.Time, cal Calendar) Part {
+	if cal == Hijri {
+		return jdnToHijri(toJDN(t))
+	}
+	return Part{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+// Validate checks the parts exist in the date's calendar and a range is in order
+func (d *Date) Validate() error {
+	parts := []Part{d.Start}
+	if d.Qualifier == Between {
+		parts = append(parts, d.End)
+	}
+	for _, p := range parts {
+		if p.Year < 1 || p.Year > 9999 {
+			return fmt.Errorf("%w: year %d", ErrInvalid, p.Year)
+		}
+		if p.Month < 0 || p.Month > 12 || (p.Month == 0 && p.Day != 0) {
+			return fmt.Errorf("%w: month %d", ErrInvalid, p.Month)
+		}
+		if p.Day != 0 && (p.Day < 1 || p.Day > d.daysIn(p.Year, p.Month)) {
+			return fmt.Errorf("%w: day %d", ErrInvalid, p.Day)
+		}
+	}
+	if d.Qualifier == Between {
+		first, _ := d.bounds(d.Start)
+		_, last := d.bounds(d.End)
+		if !first.Before(last) {
+			return fmt.Errorf("%w: range ends before it starts", ErrInvalid)
+		}
+	}
+	return nil
+}
+
+func (d *Date) daysIn(year, month int) int {
+	if d.Calendar == Hijri {
+		next := Part{Year: year, Month: month + 1, Day: 1}
+		if month == 12 {
+			next = Part{Year: year + 1, Month: 1, Day: 1}
+		}
+		return hijriToJDN(next) - hijriToJDN(Part{Year: year, Month: month, Day: 1})
+	}
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// jsonDate is the JSON form. Clients send either a string or an object with
+// "value"; the other fields are derived.
+type jsonDate struct {
+	Value     string    `json:"value"`
+	Qualifier Qualifier `json:"qualifier"`
+	Calendar  Calendar  `json:"calendar"`
+	Precision Precision `json:"precision"`
+	Earliest  string    `json:"earliest,omitempty"` // Gregorian, YYYY-MM-DD
+	Latest    string    `json:"latest,omitempty"`
+	Gregorian string    `json:"gregorian,omitempty"` // The date converted, for Hijri dates
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	out := jsonDate{
+		Value:     d.String(),
+		Qualifier: d.Qualifier,
+		Calendar:  d.Calendar,
+		Precision: d.Precision(),
+	}
+	if t, ok := d.Earliest(); ok {
+		out.Earliest = t.Format(time.DateOnly)
+	}
+	if t, ok := d.Latest(); ok {
+		out.Latest = t.Format(time.DateOnly)
+	}
+	if d.Calendar == Hijri {
+		out.Gregorian = d.InCalendar(Gregorian).String()
+	}
+	return json.Marshal(out)
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	var value string
+	if strings.HasPrefix(s, "{") {
+		var in jsonDate
+		if err := json.Unmarshal(data, &in); err != nil {
+			return err
+		}
+		value = in.Value
+	} else if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	// Older life events wrote an unset date as the zero time
+	if t, err := time.Parse(time.RFC3339, value); strings.TrimSpace(value) == "" || (err == nil && t.IsZero()) {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+// Value stores the Gregorian sort day followed by the canonical form, e.g.
+// "1888-01-01 about 1890", so ordering the text column orders by date
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.Time().Format(time.DateOnly) + " " + d.String(), nil
+}
+
+func (d *Date) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = *FromTime(v.UTC())
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return errors.New("type assertion failed for gendate.Date")
+	}
+
+	// The sort prefix is a plain date; anything else is an older value
+	if len(s) > 11 && s[10] == ' ' {
+		if _, err := time.Parse(time.DateOnly, s[:10]); err == nil {
+			if parsed, err := Parse(s[11:]); err == nil {
+				*d = *parsed
+				return nil
+			}
+		}
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
@@ -0,0 +1,209 @@
+package gendate
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Date
+	}{
+		{"year zero", Date{Exact, Gregorian, Part{0, 0, 0}, Part{}}},
+		{"year too large", Date{Exact, Gregorian, Part{10000, 0, 0}, Part{}}},
+		{"month 13", Date{Exact, Gregorian, Part{1890, 13, 0}, Part{}}},
+		{"day without month", Date{Exact, Gregorian, Part{1890, 0, 5}, Part{}}},
+		{"day 31 in April", Date{Exact, Gregorian, Part{1890, 4, 31}, Part{}}},
+		{"29 February in a common year", Date{Exact, Gregorian, Part{1900, 2, 29}, Part{}}},
+		{"day 30 of a short Hijri month", Date{Exact, Hijri, Part{1330, 2, 30}, Part{}}},
+		{"invalid range end", Date{Between, Gregorian, Part{1850, 0, 0}, Part{1855, 14, 0}}},
+		{"range ends before it starts", Date{Between, Gregorian, Part{1855, 0, 0}, Part{1850, 0, 0}}},
+		{"range of one day", Date{Between, Gregorian, Part{1850, 1, 1}, Part{1850, 1, 1}}},
+	}
+	for _, tt := range tests {
+		if err := tt.d.Validate(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalid", tt.name, err)
+		}
+	}
+
+	valid := []Date{
+		{Exact, Gregorian, Part{1, 1, 1}, Part{}},
+		{Exact, Gregorian, Part{2000, 2, 29}, Part{}},
+		{Exact, Hijri, Part{1330, 1, 30}, Part{}},
+		{Between, Gregorian, Part{1850, 0, 0}, Part{1850, 6, 0}},
+		{Before, Gregorian, Part{1920, 0, 0}, Part{1850, 14, 0}}, // End only counts for ranges
+	}
+	for _, d := range valid {
+		if err := d.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", d, err)
+		}
+	}
+}
+
+// Stored values start with a sort day, so ordering the column orders the
+// dates: "before" dates go before the year they name and "about" dates at
+// its start
+func TestValueSortsByDate(t *testing.T) {
+	want := []string{
+		"about 1840",
+		"1849-12",
+		"before 1850",
+		"1850",
+		"about 1850", // Same sort day as 1850
+		"between 1850-03 and 1851",
+		"1850-06-01",
+		"after 1850",
+		"1329 AH", // Begins 3 January 1911
+		"1911-02",
+		"1330-01-02 AH", // 23 December 1911
+	}
+	values := make([]string, len(want))
+	byValue := map[string]string{}
+	for i, s := range want {
+		d, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		v, err := d.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[i] = v.(string)
+		byValue[values[i]] = s
+	}
+
+	sort.Strings(values)
+	for i, v := range values {
+		if byValue[v] != want[i] {
+			t.Errorf("position %d: %q (stored %q), want %q", i, byValue[v], v, want[i])
+		}
+	}
+}
+
+func TestValueScanRoundTrip(t *testing.T) {
+	for _, s := range []string{"1890", "1890-03-12", "about 1890", "before 1920", "after 1850-06", "between 1850 and 1855", "1330-01-02 AH", "about 1330 AH"} {
+		d, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		v, err := d.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, stored := range []interface{}{v, []byte(v.(string))} {
+			var got Date
+			if err := got.Scan(stored); err != nil {
+				t.Errorf("Scan(%q): %v", stored, err)
+				continue
+			}
+			if got != *d {
+				t.Errorf("Scan(%q) = %+v, want %+v", stored, got, *d)
+			}
+		}
+	}
+
+	var unset Date
+	if v, err := unset.Value(); v != nil || err != nil {
+		t.Errorf("Value() of an unset date = %v, %v; want nil", v, err)
+	}
+	if err := unset.Scan(nil); err != nil || !unset.IsZero() {
+		t.Errorf("Scan(nil) = %+v, %v; want an unset date", unset, err)
+	}
+}
+
+// Values from before dates were stored as text: timestamp columns and the
+// text MigratePersonDates writes from them
+func TestScanLegacyValues(t *testing.T) {
+	want := Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}
+	tests := []interface{}{
+		time.Date(1890, 3, 12, 0, 0, 0, 0, time.UTC),
+		time.Date(1890, 3, 12, 1, 0, 0, 0, time.FixedZone("CET", 3600)), // Midnight UTC
+		"1890-03-12 1890-03-12",
+		"1890-03-12T00:00:00Z",
+		"1890-03-12 00:00:00+00",
+		[]byte("1890-03-12 00:00:00"),
+	}
+	for _, stored := range tests {
+		var got Date
+		if err := got.Scan(stored); err != nil {
+			t.Errorf("Scan(%v): %v", stored, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Scan(%v) = %+v, want %+v", stored, got, want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	type event struct {
+		Date *Date `json:"date"`
+	}
+	tests := []struct {
+		in   string
+		want Date
+	}{
+		{`{"date":"about 1890"}`, Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{`{"date":{"value":"1330 AH","calendar":"gregorian"}}`, Date{Exact, Hijri, Part{1330, 0, 0}, Part{}}},
+
+		// Life events saved before dates were genealogical held timestamps,
+		// with the zero time for no date
+		{`{"date":"1890-03-12T00:00:00Z"}`, Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+		{`{"date":"0001-01-01T00:00:00Z"}`, Date{}},
+		{`{"date":""}`, Date{}},
+	}
+	for _, tt := range tests {
+		var e event
+		if err := json.Unmarshal([]byte(tt.in), &e); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if e.Date == nil || *e.Date != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.in, e.Date, tt.want)
+		}
+		if tt.want.IsZero() && !e.Date.IsZero() {
+			t.Errorf("Unmarshal(%s) is set, want unset", tt.in)
+		}
+	}
+
+	var e event
+	if err := json.Unmarshal([]byte(`{"date":"someday"}`), &e); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Unmarshal of an invalid date = %v, want ErrInvalid", err)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	d, err := Parse("about 1330-01 AH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out jsonDate
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonDate{
+		Value:     "about 1330-01 AH",
+		Qualifier: About,
+		Calendar:  Hijri,
+		Precision: PrecisionMonth,
+		Earliest:  "1909-12-22",
+		Latest:    "1914-01-20",
+		Gregorian: "about 1911",
+	}
+	if out != want {
+		t.Errorf("Marshal = %+v, want %+v", out, want)
+	}
+
+	var back Date
+	if err := json.Unmarshal(data, &back); err != nil || back != *d {
+		t.Errorf("Unmarshal(%s) = %+v, %v; want %+v", data, back, err, *d)
+	}
+}
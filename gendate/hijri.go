@@ -0,0 +1,35 @@
+package gendate
+
+import (
+	"math"
+	"time"
+)
+
+// Julian day number of 1 Muharram 1 AH (16 July 622, Julian calendar)
+const hijriEpoch = 1948440
+
+// Julian day number of 1 January 1970
+const unixEpochJDN = 2440588
+
+// hijriToJDN converts a tabular Islamic date (leap years 2, 5, 7, 10, 13,
+// 16, 18, 21, 24, 26 and 29 of each 30-year cycle) to a Julian day number
+func hijriToJDN(p Part) int {
+	return p.Day + (59*(p.Month-1)+1)/2 + (p.Year-1)*354 + (3+11*p.Year)/30 + hijriEpoch - 1
+}
+
+func jdnToHijri(jdn int) Part {
+	year := (30*(jdn-hijriEpoch) + 10646) / 10631
+	month := int(math.Ceil(float64(jdn-29-hijriToJDN(Part{Year: year, Month: 1, Day: 1}))/29.5)) + 1
+	month = min(max(month, 1), 12)
+	day := jdn - hijriToJDN(Part{Year: year, Month: month, Day: 1}) + 1
+	return Part{Year: year, Month: month, Day: day}
+}
+
+func toJDN(t time.Time) int {
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	return int(days) + unixEpochJDN
+}
+
+func fromJDN(jdn int) time.Time {
+	return time.Unix(int64(jdn-unixEpochJDN)*86400, 0).UTC()
+}
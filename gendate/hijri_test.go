@@ -0,0 +1,66 @@
+package gendate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHijriToGregorian(t *testing.T) {
+	tests := []struct {
+		hijri string
+		want  string
+	}{
+		{"0001-01-01 AH", "0622-07-19"}, // 16 July 622 in the Julian calendar
+		{"1330-01-01 AH", "1911-12-22"},
+		{"1330-01-02 AH", "1911-12-23"},
+		{"1444-09-01 AH", "2023-03-23"},
+		{"1445-01-01 AH", "2023-07-19"},
+		{"1445-12-30 AH", "2024-07-07"},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.hijri)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.hijri, err)
+		}
+		if got := d.InCalendar(Gregorian).String(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.hijri, got, tt.want)
+		}
+
+		back, err := Parse(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := back.InCalendar(Hijri).String(); got != tt.hijri {
+			t.Errorf("%s = %s, want %s", tt.want, got, tt.hijri)
+		}
+	}
+}
+
+func TestHijriRoundTrip(t *testing.T) {
+	start := time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := jdnToHijri(toJDN(start) - 1)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		jdn := toJDN(day)
+		p := jdnToHijri(jdn)
+		if got := hijriToJDN(p); got != jdn {
+			t.Fatalf("%s: hijriToJDN(%s) = %d, want %d", day.Format(time.DateOnly), p, got, jdn)
+		}
+		if !fromJDN(jdn).Equal(day) {
+			t.Fatalf("fromJDN(%d) = %s, want %s", jdn, fromJDN(jdn), day)
+		}
+
+		// Each day follows the one before
+		next := Part{Year: prev.Year, Month: prev.Month, Day: prev.Day + 1}
+		if p.Day == 1 {
+			next = Part{Year: prev.Year, Month: prev.Month + 1, Day: 1}
+			if prev.Month == 12 {
+				next = Part{Year: prev.Year + 1, Month: 1, Day: 1}
+			}
+		}
+		if p != next || p.Day > 30 {
+			t.Fatalf("%s is %s, after %s", day.Format(time.DateOnly), p, prev)
+		}
+		prev = p
+	}
+}
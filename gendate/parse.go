@@ -0,0 +1,182 @@
+package gendate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var qualifierWords = map[string]Qualifier{
+	"about": About, "abt": About, "abt.": About, "circa": About, "ca": About, "ca.": About,
+	"c.": About, "c": About, "approx": About, "approx.": About, "approximately": About,
+	"est": About, "est.": About, "estimated": About, "cal": About, "calculated": About,
+	"before": Before, "bef": Before, "bef.": Before, "until": Before, "to": Before,
+	"after": After, "aft": After, "aft.": After, "since": After, "from": After,
+	"between": Between, "bet": Between, "bet.": Between,
+}
+
+var calendarWords = map[string]Calendar{
+	"ah": Hijri, "a.h.": Hijri, "a.h": Hijri, "هـ": Hijri, "ه": Hijri, "hijri": Hijri,
+	"ad": Gregorian, "a.d.": Gregorian, "ce": Gregorian, "gregorian": Gregorian,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "january": 1, "feb": 2, "february": 2, "mar": 3, "march": 3,
+	"apr": 4, "april": 4, "may": 5, "jun": 6, "june": 6, "jul": 7, "july": 7,
+	"aug": 8, "august": 8, "sep": 9, "sept": 9, "september": 9, "oct": 10, "october": 10,
+	"nov": 11, "november": 11, "dec": 12, "december": 12,
+}
+
+// Timestamps older clients send and legacy timestamp columns hold
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05",
+}
+
+// Parse reads a date such as "1890-03-12", "March 1890", "about 1890",
+// "bef. 1920", "between 1850 and 1855", "from 1850 to 1855" or "1330 AH".
+// Full timestamps are read as exact days.
+func Parse(s string) (*Date, error) {
+	text := strings.TrimSpace(asciiDigits(s))
+	if text == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalid)
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return FromTime(t), nil
+		}
+	}
+	text = strings.ToLower(text)
+
+	d := &Date{Qualifier: Exact, Calendar: Gregorian}
+	var words []string
+	for _, w := range strings.Fields(strings.ReplaceAll(text, ",", " ")) {
+		if cal, ok := calendarWords[w]; ok {
+			d.Calendar = cal
+			continue
+		}
+		words = append(words, w)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	if strings.HasPrefix(words[0], "~") {
+		d.Qualifier = About
+		words[0] = strings.TrimPrefix(words[0], "~")
+		if words[0] == "" {
+			words = words[1:]
+		}
+	} else if q, ok := qualifierWords[words[0]]; ok && len(words) > 1 {
+		d.Qualifier = q
+		words = words[1:]
+	}
+
+	// A range: "between X and Y", "from X to Y" or "X/Y"
+	var end []string
+	for i, w := range words {
+		if (w == "and" && d.Qualifier == Between) || (w == "to" && d.Qualifier == After) {
+			words, end = words[:i], words[i+1:]
+			d.Qualifier = Between
+			break
+		}
+	}
+	if d.Qualifier == Exact && len(words) == 1 {
+		if from, to, ok := strings.Cut(words[0], "/"); ok {
+			words, end = []string{from}, []string{to}
+			d.Qualifier = Between
+		}
+	}
+	if d.Qualifier == Between && len(end) == 0 {
+		return nil, fmt.Errorf("%w: %q has no end", ErrInvalid, s)
+	}
+
+	var err error
+	if d.Start, err = parsePart(words); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	if len(end) > 0 {
+		if d.End, err = parsePart(end); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parsePart reads "1890", "1890-03", "1890-03-12", "Mar 1890",
+// "12 Mar 1890" or "Mar 12 1890"
+func parsePart(words []string) (Part, error) {
+	var p Part
+	var err error
+	switch len(words) {
+	case 1:
+		fields := strings.Split(words[0], "-")
+		if len(fields) > 3 {
+			return p, ErrInvalid
+		}
+		nums := make([]int, len(fields))
+		for i, f := range fields {
+			if nums[i], err = number(f); err != nil {
+				return p, err
+			}
+		}
+		p.Year = nums[0]
+		if len(nums) > 1 {
+			p.Month = nums[1]
+		}
+		if len(nums) > 2 {
+			p.Day = nums[2]
+		}
+	case 2:
+		p.Month = monthNames[strings.TrimSuffix(words[0], ".")]
+		p.Year, err = number(words[1])
+	case 3:
+		p.Month = monthNames[strings.TrimSuffix(words[1], ".")]
+		p.Day, err = number(words[0])
+		if p.Month == 0 {
+			p.Month = monthNames[strings.TrimSuffix(words[0], ".")]
+			p.Day, err = number(words[1])
+		}
+		if err == nil {
+			p.Year, err = number(words[2])
+		}
+	default:
+		return p, ErrInvalid
+	}
+	if err != nil || (len(words) > 1 && p.Month == 0) {
+		return p, ErrInvalid
+	}
+	return p, nil
+}
+
+func number(s string) (int, error) {
+	if s == "" || len(s) > 4 {
+		return 0, ErrInvalid
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalid
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+// asciiDigits replaces Arabic-Indic and Persian digits
+func asciiDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '٠' && r <= '٩':
+			return '0' + (r - '٠')
+		case r >= '۰' && r <= '۹':
+			return '0' + (r - '۰')
+		}
+		return r
+	}, s)
+}
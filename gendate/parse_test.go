@@ -0,0 +1,99 @@
+package gendate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Date
+	}{
+		// Precision
+		{"1890", Date{Exact, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"1890-03", Date{Exact, Gregorian, Part{1890, 3, 0}, Part{}}},
+		{"1890-03-12", Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+		{"March 1890", Date{Exact, Gregorian, Part{1890, 3, 0}, Part{}}},
+		{"12 Mar 1890", Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+		{"Mar. 12, 1890", Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+		{"2000-02-29", Date{Exact, Gregorian, Part{2000, 2, 29}, Part{}}},
+
+		// Qualifiers
+		{"about 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"abt. 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"ABT 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"~1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"circa 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"est 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"cal 1890", Date{About, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"before 1920", Date{Before, Gregorian, Part{1920, 0, 0}, Part{}}},
+		{"bef. 1920", Date{Before, Gregorian, Part{1920, 0, 0}, Part{}}},
+		{"until 1920", Date{Before, Gregorian, Part{1920, 0, 0}, Part{}}},
+		{"after 1850", Date{After, Gregorian, Part{1850, 0, 0}, Part{}}},
+		{"aft 1850-06", Date{After, Gregorian, Part{1850, 6, 0}, Part{}}},
+		{"since 1850", Date{After, Gregorian, Part{1850, 0, 0}, Part{}}},
+		{"from 1850", Date{After, Gregorian, Part{1850, 0, 0}, Part{}}},
+
+		// Ranges
+		{"between 1850 and 1855", Date{Between, Gregorian, Part{1850, 0, 0}, Part{1855, 0, 0}}},
+		{"bet 1850-03 and 1855", Date{Between, Gregorian, Part{1850, 3, 0}, Part{1855, 0, 0}}},
+		{"from 1850 to 1855", Date{Between, Gregorian, Part{1850, 0, 0}, Part{1855, 0, 0}}},
+		{"1850/1855", Date{Between, Gregorian, Part{1850, 0, 0}, Part{1855, 0, 0}}},
+
+		// Calendars
+		{"1890 AD", Date{Exact, Gregorian, Part{1890, 0, 0}, Part{}}},
+		{"1330 AH", Date{Exact, Hijri, Part{1330, 0, 0}, Part{}}},
+		{"1330-01-02 AH", Date{Exact, Hijri, Part{1330, 1, 2}, Part{}}},
+		{"about 1330 A.H.", Date{About, Hijri, Part{1330, 0, 0}, Part{}}},
+		{"between 1330 and 1335 AH", Date{Between, Hijri, Part{1330, 0, 0}, Part{1335, 0, 0}}},
+		{"١٣٣٠ هـ", Date{Exact, Hijri, Part{1330, 0, 0}, Part{}}},
+		{"1445-12-30 AH", Date{Exact, Hijri, Part{1445, 12, 30}, Part{}}}, // 1445 is a leap year
+
+		// Timestamps from older clients
+		{"1890-03-12T10:00:00Z", Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+		{"1890-03-12 10:00:00", Date{Exact, Gregorian, Part{1890, 3, 12}, Part{}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+		// The canonical form reads back the same
+		again, err := Parse(got.String())
+		if err != nil || *again != *got {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v", got.String(), again, err, *got)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"abc",
+		"about",
+		"1890-13",
+		"1890-03-00x",
+		"1890-02-30",
+		"1900-02-29", // Not a leap year
+		"10000",
+		"0",
+		"Foo 1890",
+		"1 2 3 4",
+		"between 1850",
+		"between 1855 and 1850",
+		"between 1850-06 and 1850-05",
+		"1444-12-30 AH", // 1444 is not a leap year
+		"1330-13 AH",
+	}
+	for _, in := range tests {
+		if d, err := Parse(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrInvalid", in, d, err)
+		}
+	}
+}
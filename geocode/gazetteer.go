@@ -0,0 +1,193 @@
+package geocode
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Gazetteer is an offline Geocoder over a CSV file with the header
+//
+//	id,name,kind,parent,latitude,longitude,alternate_names
+//
+// parent is the id of the enclosing place and alternate_names are separated
+// by "|". Rows may come in any order.
+type Gazetteer struct {
+	places map[string]*entry
+	byKey  map[string][]*entry
+}
+
+type entry struct {
+	Place
+	parent string
+}
+
+var gazetteerColumns = []string{"id", "name", "kind", "parent", "latitude", "longitude", "alternate_names"}
+
+// LoadGazetteer reads a gazetteer file
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGazetteer(f)
+}
+
+// ReadGazetteer reads gazetteer CSV
+func ReadGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(gazetteerColumns)
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("gazetteer header: %w", err)
+	}
+	for i, column := range gazetteerColumns {
+		if strings.TrimSpace(header[i]) != column {
+			return nil, fmt.Errorf("gazetteer column %d is %q, want %q", i+1, header[i], column)
+		}
+	}
+
+	g := &Gazetteer{places: map[string]*entry{}, byKey: map[string][]*entry{}}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		e := &entry{
+			Place:  Place{ID: row[0], Name: row[1], Kind: row[2]},
+			parent: row[3],
+		}
+		if e.ID == "" || e.Name == "" {
+			return nil, fmt.Errorf("gazetteer line %d: id and name are required", line)
+		}
+		if _, ok := g.places[e.ID]; ok {
+			return nil, fmt.Errorf("gazetteer line %d: duplicate id %q", line, e.ID)
+		}
+		if e.Latitude, err = strconv.ParseFloat(row[4], 64); err != nil {
+			return nil, fmt.Errorf("gazetteer line %d: latitude: %w", line, err)
+		}
+		if e.Longitude, err = strconv.ParseFloat(row[5], 64); err != nil {
+			return nil, fmt.Errorf("gazetteer line %d: longitude: %w", line, err)
+		}
+		for _, name := range strings.Split(row[6], "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				e.AlternateNames = append(e.AlternateNames, name)
+			}
+		}
+
+		g.places[e.ID] = e
+		seen := map[string]bool{}
+		for _, name := range append([]string{e.Name}, e.AlternateNames...) {
+			if key := Key(name); key != "" && !seen[key] {
+				seen[key] = true
+				g.byKey[key] = append(g.byKey[key], e)
+			}
+		}
+	}
+
+	for _, e := range g.places {
+		if e.parent != "" && g.places[e.parent] == nil {
+			return nil, fmt.Errorf("gazetteer place %q has unknown parent %q", e.ID, e.parent)
+		}
+	}
+	return g, nil
+}
+
+// Len is the number of places in the gazetteer
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+// Geocode matches the first part of the query against place names and the
+// rest against the enclosing places, so "Alexandria, Egypt" and
+// "Alexandria, Virginia" find different cities. Exact names rank before
+// alternate ones and cities before regions and countries.
+func (g *Gazetteer) Geocode(ctx context.Context, query string) ([]Result, error) {
+	parts := SplitQuery(query)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		result    Result
+		alternate bool
+		kind      int
+	}
+	var matches []match
+	for _, e := range g.byKey[Key(parts[0])] {
+		hierarchy := g.hierarchy(e)
+		if !containsAll(hierarchy[1:], parts[1:]) {
+			continue
+		}
+		matches = append(matches, match{
+			result:    Result{Hierarchy: hierarchy},
+			alternate: Key(e.Name) != Key(parts[0]),
+			kind:      kindRank(e.Kind),
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].alternate != matches[j].alternate {
+			return !matches[i].alternate
+		}
+		return matches[i].kind < matches[j].kind
+	})
+	results := make([]Result, len(matches))
+	for i, m := range matches {
+		results[i] = m.result
+	}
+	return results, nil
+}
+
+// hierarchy is e followed by its enclosing places
+func (g *Gazetteer) hierarchy(e *entry) []Place {
+	var places []Place
+	for seen := map[string]bool{}; e != nil && !seen[e.ID]; e = g.places[e.parent] {
+		seen[e.ID] = true
+		places = append(places, e.Place)
+	}
+	return places
+}
+
+// containsAll reports whether every part names one of the places
+func containsAll(places []Place, parts []string) bool {
+	for _, part := range parts {
+		key, found := Key(part), false
+		for _, p := range places {
+			for _, name := range append([]string{p.Name}, p.AlternateNames...) {
+				if Key(name) == key {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func kindRank(kind string) int {
+	switch kind {
+	case KindCity:
+		return 0
+	case KindRegion:
+		return 1
+	case KindCountry:
+		return 2
+	}
+	return 3
+}
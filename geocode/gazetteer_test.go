@@ -0,0 +1,116 @@
+package geocode
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const header = "id,name,kind,parent,latitude,longitude,alternate_names\n"
+
+func TestReadGazetteer(t *testing.T) {
+	g, err := ReadGazetteer(strings.NewReader(
+		"# Comments and rows in any order are fine\n" + header +
+			"eg-cairo,Cairo,city,eg,30.0444,31.2357,القاهرة| Al Qahirah |\n" +
+			"eg,Egypt,country,,26.8206,30.8025,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", g.Len())
+	}
+	cairo := g.places["eg-cairo"]
+	if cairo == nil || cairo.Latitude != 30.0444 || cairo.Longitude != 31.2357 {
+		t.Fatalf("Cairo = %+v", cairo)
+	}
+	if got := strings.Join(cairo.AlternateNames, "|"); got != "القاهرة|Al Qahirah" {
+		t.Errorf("alternate names = %q", got)
+	}
+}
+
+func TestReadGazetteerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want string
+	}{
+		{"empty", "", "gazetteer header"},
+		{"wrong column", "id,name,type,parent,latitude,longitude,alternate_names\n", `column 3 is "type"`},
+		{"missing column", "id,name,kind,parent,latitude,longitude\n", "wrong number of fields"},
+		{"short row", header + "eg,Egypt,country,,26.8,30.8\n", "wrong number of fields"},
+		{"no id", header + ",Egypt,country,,26.8,30.8,\n", "line 2: id and name are required"},
+		{"no name", header + "eg,,country,,26.8,30.8,\n", "line 2: id and name are required"},
+		{"duplicate id", header + "eg,Egypt,country,,26.8,30.8,\neg,Misr,country,,26.8,30.8,\n", `line 3: duplicate id "eg"`},
+		{"bad latitude", header + "eg,Egypt,country,,north,30.8,\n", "line 2: latitude"},
+		{"bad longitude", header + "eg,Egypt,country,,26.8,,\n", "line 2: longitude"},
+		{"unknown parent", header + "eg-cairo,Cairo,city,eg,30.0,31.2,\n", `"eg-cairo" has unknown parent "eg"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadGazetteer(strings.NewReader(tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeocode(t *testing.T) {
+	g, err := LoadGazetteer("gazetteer.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []string // IDs of each result's most specific place, best first
+	}{
+		// The enclosing places tell places with one name apart
+		{"Alexandria", []string{"eg-alexandria", "us-alexandria"}},
+		{"Alexandria, Egypt", []string{"eg-alexandria"}},
+		{"Alexandria, Virginia", []string{"us-alexandria"}},
+		{"Alexandria, VA, USA", []string{"us-alexandria"}},
+		{"Alexandria, Alexandria Governorate", []string{"eg-alexandria"}},
+		{"Alexandria, Jordan", nil},
+
+		// Alternate spellings, scripts and punctuation
+		{"الإسكندرية", []string{"eg-alexandria"}},
+		{"Al-Iskandariyah, Misr", []string{"eg-alexandria"}},
+		{"الإسكندرية, مصر", []string{"eg-alexandria"}},
+		{"al quds", []string{"ps-jerusalem"}},
+		{"القدس، فلسطين", []string{"ps-jerusalem"}},
+		{"El Qahira", []string{"eg-cairo"}},
+		{"Le Caire, Egypt", []string{"eg-cairo"}},
+		{"  damascus , SYRIA ", []string{"sy-damascus"}},
+
+		// Exact names rank before alternate ones
+		{"Kuwait", []string{"kw", "kw-kuwait"}},
+
+		{"Atlantis", nil},
+		{"", nil},
+		{" , ", nil},
+	}
+	for _, tt := range tests {
+		results, err := g.Geocode(context.Background(), tt.query)
+		if err != nil {
+			t.Errorf("Geocode(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Hierarchy[0].ID)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Geocode(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Results carry the hierarchy up to the country
+	results, _ := g.Geocode(context.Background(), "Alexandria, Virginia")
+	var path []string
+	for _, p := range results[0].Hierarchy {
+		path = append(path, p.Name)
+	}
+	if got := strings.Join(path, ", "); got != "Alexandria, Virginia, United States" {
+		t.Errorf("hierarchy = %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+// Package geocode turns place names such as "Cairo, Egypt" into coordinates
+// and a country/region/city hierarchy.
+package geocode
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"family-tree-backend/names"
+)
+
+// Kinds of place, from largest to smallest
+const (
+	KindCountry = "country"
+	KindRegion  = "region"
+	KindCity    = "city"
+)
+
+// Place is one level of a geocoded location
+type Place struct {
+	ID             string // Stable ID in the geocoder's data
+	Name           string
+	Kind           string
+	AlternateNames []string
+	Latitude       float64
+	Longitude      float64
+}
+
+// Result is one match, most specific place first: city, region, country
+type Result struct {
+	Hierarchy []Place
+}
+
+// Geocoder finds the places a free-text name may refer to, best match first
+type Geocoder interface {
+	Geocode(ctx context.Context, query string) ([]Result, error)
+}
+
+// NewGeocoderFromEnv loads the gazetteer at GAZETTEER_FILE. It returns nil
+// when none is configured, and places are then only matched by name.
+func NewGeocoderFromEnv() Geocoder {
+	path := os.Getenv("GAZETTEER_FILE")
+	if path == "" {
+		log.Println("Warning: GAZETTEER_FILE not set. Places will not be geocoded.")
+		return nil
+	}
+	g, err := LoadGazetteer(path)
+	if err != nil {
+		log.Printf("Warning: Failed to load gazetteer: %v", err)
+		return nil
+	}
+	log.Printf("Loaded gazetteer with %d places", g.Len())
+	return g
+}
+
+// Key reduces a place name to the form names are matched on, so spellings
+// and scripts of one name agree: "Al-Qahira", "al Qahirah" and "القاهرة"
+func Key(name string) string {
+	return strings.Join(names.Words(name), "")
+}
+
+// SplitQuery splits "Nablus, Palestine" into its parts, most specific first.
+// Arabic commas ("نابلس، فلسطين") separate parts too.
+func SplitQuery(query string) []string {
+	var parts []string
+	for _, part := range strings.FieldsFunc(query, isPartSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func isPartSeparator(r rune) bool {
+	return r == ',' || r == '،'
+}
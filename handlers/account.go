@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"family-tree-backend/mail"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// accountErrorStatus maps email token service errors to HTTP status codes
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTokenInvalid):
+		return http.StatusGone
+	case errors.Is(err, services.ErrTokenTooRecent):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// accountLink builds the app link for an emailed token. APP_BASE_URL is the
+// web app, e.g. https://family.example.com; without it the email carries the
+// bare token to paste into the app.
+func accountLink(path, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		return token
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail issues a verification token and mails it
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := services.IssueUserToken(h.DB, user, models.TokenVerifyEmail, services.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address for Family Tree:\n\n%s\n\n"+
+			"The link works once and expires in 48 hours. If you didn't create an account, you can ignore this email.\n",
+			user.Name, accountLink("/verify-email", token)),
+	})
+}
+
+// RequestEmailVerification sends a new verification link to the current user
+func (h *AuthHandler) RequestEmailVerification(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	if user.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified"})
+		return
+	}
+	if user.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No email address on this account"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		status := accountErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+			c.JSON(status, gin.H{"error": "Failed to send email"})
+			return
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// VerifyEmail consumes a verification token from an emailed link
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := services.VerifyEmail(h.DB, req.Token)
+	if err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", "user": user})
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or
+// not the address has an account, so it can't be used to look up members.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if result := h.DB.Where("email = ?", strings.TrimSpace(req.Email)).First(&user); result.Error == nil {
+		token, err := services.IssueUserToken(h.DB, &user, models.TokenResetPassword, services.ResetPasswordTTL)
+		if err == nil {
+			err = h.Mailer.Send(c.Request.Context(), mail.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset the password for your Family Tree account. "+
+					"To choose a new password, open:\n\n%s\n\nThe link works once and expires in 1 hour. "+
+					"If you didn't ask for this, you can ignore this email; your password has not changed.\n",
+					user.Name, accountLink("/reset-password", token)),
+			})
+		}
+		if err != nil && !errors.Is(err, services.ErrTokenTooRecent) {
+			log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses that email, a reset link is on its way"})
+}
+
+// ResetPassword sets a new password from an emailed link and signs the user
+// out on every device
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	if _, err := services.ResetPassword(h.DB, req.Token, string(hashedPassword)); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed. Please log in with your new password."})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"family-tree-backend/auth"
+	"family-tree-backend/mail"
+	"family-tree-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens an empty in-memory database with the given tables
+func testDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// accountTest is an AuthHandler mailing through a LogSender into a
+// temporary directory
+type accountTest struct {
+	t       *testing.T
+	db      *gorm.DB
+	mailDir string
+	router  *gin.Engine
+	user    models.User
+}
+
+func newAccountTest(t *testing.T) *accountTest {
+	gin.SetMode(gin.TestMode)
+	a := &accountTest{
+		t:       t,
+		db:      testDB(t, &models.User{}, &models.UserToken{}, &models.Session{}),
+		mailDir: t.TempDir(),
+		router:  gin.New(),
+	}
+	h := &AuthHandler{DB: a.db, Mailer: mail.LogSender{Dir: a.mailDir}}
+	a.router.POST("/auth/verify-email", h.VerifyEmail)
+	a.router.POST("/auth/password/forgot", h.ForgotPassword)
+	a.router.POST("/auth/password/reset", h.ResetPassword)
+	a.router.POST("/me/verify-email", func(c *gin.Context) {
+		c.Set("user", a.user)
+		h.RequestEmailVerification(c)
+	})
+
+	a.user = models.User{ID: "user-1", Email: "ada@example.com", Name: "Ada", Role: models.RoleMember}
+	if err := a.db.Create(&a.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *accountTest) post(path string, body interface{}) int {
+	a.t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	a.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+var mailedToken = regexp.MustCompile(`(?m)^[A-Za-z0-9_-]{43}\r?$`)
+
+// lastToken reads the token out of the newest email in the mail directory
+func (a *accountTest) lastToken() string {
+	a.t.Helper()
+	files, err := filepath.Glob(filepath.Join(a.mailDir, "*.eml"))
+	if err != nil || len(files) == 0 {
+		a.t.Fatalf("no email was sent (%v)", err)
+	}
+	sort.Strings(files)
+	data, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	token := strings.TrimSpace(mailedToken.FindString(string(data)))
+	if token == "" {
+		a.t.Fatalf("no token in email:\n%s", data)
+	}
+	return token
+}
+
+// accountFlows are the two emailed-token flows: what sends the email and
+// what redeems its token
+var accountFlows = []struct {
+	name    string
+	purpose models.UserTokenPurpose
+	request func(a *accountTest) int
+	redeem  func(a *accountTest, token string) int
+}{
+	{
+		name:    "verify email",
+		purpose: models.TokenVerifyEmail,
+		request: func(a *accountTest) int { return a.post("/me/verify-email", nil) },
+		redeem: func(a *accountTest, token string) int {
+			return a.post("/auth/verify-email", VerifyEmailRequest{Token: token})
+		},
+	},
+	{
+		name:    "reset password",
+		purpose: models.TokenResetPassword,
+		request: func(a *accountTest) int {
+			return a.post("/auth/password/forgot", ForgotPasswordRequest{Email: "ada@example.com"})
+		},
+		redeem: func(a *accountTest, token string) int {
+			return a.post("/auth/password/reset", ResetPasswordRequest{Token: token, Password: "correct horse"})
+		},
+	},
+}
+
+func TestAccountTokensAreSingleUse(t *testing.T) {
+	for _, flow := range accountFlows {
+		t.Run(flow.name, func(t *testing.T) {
+			a := newAccountTest(t)
+			if code := flow.request(a); code != http.StatusOK {
+				t.Fatalf("request: status %d", code)
+			}
+			token := a.lastToken()
+
+			if code := flow.redeem(a, token); code != http.StatusOK {
+				t.Fatalf("first use: status %d, want 200", code)
+			}
+			if code := flow.redeem(a, token); code != http.StatusGone {
+				t.Errorf("second use: status %d, want 410", code)
+			}
+		})
+	}
+}
+
+func TestAccountTokensExpire(t *testing.T) {
+	for _, flow := range accountFlows {
+		t.Run(flow.name, func(t *testing.T) {
+			a := newAccountTest(t)
+			if code := flow.request(a); code != http.StatusOK {
+				t.Fatalf("request: status %d", code)
+			}
+			token := a.lastToken()
+
+			if err := a.db.Model(&models.UserToken{}).Where("purpose = ?", flow.purpose).
+				Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+				t.Fatal(err)
+			}
+			if code := flow.redeem(a, token); code != http.StatusGone {
+				t.Errorf("expired token: status %d, want 410", code)
+			}
+		})
+	}
+}
+
+func TestAccountTokensAreHashedAtRest(t *testing.T) {
+	for _, flow := range accountFlows {
+		t.Run(flow.name, func(t *testing.T) {
+			a := newAccountTest(t)
+			if code := flow.request(a); code != http.StatusOK {
+				t.Fatalf("request: status %d", code)
+			}
+			token := a.lastToken()
+
+			var rows []map[string]interface{}
+			if err := a.db.Model(&models.UserToken{}).Find(&rows).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("%d tokens stored, want 1", len(rows))
+			}
+			for column, value := range rows[0] {
+				if s, ok := value.(string); ok && strings.Contains(s, token) {
+					t.Errorf("column %s holds the emailed token", column)
+				}
+			}
+			if rows[0]["token_hash"] != auth.HashToken(token) {
+				t.Errorf("token_hash = %v, want the token's hash", rows[0]["token_hash"])
+			}
+		})
+	}
+}
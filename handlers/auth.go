@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"family-tree-backend/auth"
+	"family-tree-backend/mail"
 	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"log"
 	"net/http"
 	"time"
 
@@ -13,18 +17,44 @@ import (
 )
 
 type AuthHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Mailer mail.Sender
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Name     string `json:"name" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6"`
+	Name       string `json:"name" binding:"required"`
+	InviteCode string `json:"inviteCode"` // Optional; joins the invitation's tree
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"deviceName"` // Shown in the session list, e.g. "Ahmed's iPhone"
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// deviceInfo records where a session is being used from
+func deviceInfo(c *gin.Context, deviceName string) services.DeviceInfo {
+	return services.DeviceInfo{
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+	}
+}
+
+// sessionErrorStatus maps session service errors to HTTP status codes
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSessionInvalid), errors.Is(err, services.ErrSessionReuse):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -48,33 +78,54 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Create user
+	// Create user. New users have no tree until they create one, are added
+	// to one, or register with an invite code.
 	user := models.User{
-		ID:           uuid.New().String(),
-		Email:        req.Email,
-		Password:     string(hashedPassword),
-		Name:         req.Name,
-		FamilyTreeID: "default-tree-id", // TODO: Make this dynamic or configurable
-		IsVerified:   false,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		ID:         uuid.New().String(),
+		Email:      req.Email,
+		Password:   string(hashedPassword),
+		Name:       req.Name,
+		IsVerified: false,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
 
-	if result := h.DB.Create(&user); result.Error != nil {
+	// A bad invite code fails the whole registration so the user can retry
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if req.InviteCode == "" {
+			return nil
+		}
+		_, err := services.RedeemInvitation(tx, req.InviteCode, &user)
+		return err
+	})
+	if err != nil {
+		if status := invitationErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID)
+	// The account works without it; the user can ask for another email
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
+	tokens, err := services.CreateSession(h.DB, user.ID, deviceInfo(c, ""))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user":  user,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"user":         user,
 	})
 }
 
@@ -98,15 +149,109 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID)
+	// With two-factor authentication on, the password only earns a short-lived
+	// challenge to exchange at /auth/mfa/verify
+	if user.MFAEnabled {
+		mfaToken, err := auth.GenerateMFAChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfaRequired": true,
+			"mfaToken":    mfaToken,
+		})
+		return
+	}
+
+	tokens, err := services.CreateSession(h.DB, user.ID, deviceInfo(c, req.DeviceName))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"user":         user,
 	})
 }
+
+// Refresh exchanges a refresh token for a new access token. The refresh
+// token is rotated, so clients must store the one in the response.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := services.RefreshSession(h.DB, req.RefreshToken, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the session a refresh token belongs to
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Logging out twice is not an error
+	if err := services.RevokeSessionByToken(h.DB, req.RefreshToken); err != nil && !errors.Is(err, services.ErrSessionInvalid) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// SessionView is a session with a flag for the one making the request
+type SessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// GetSessions lists the devices the current user is signed in on
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	sessions, err := services.ActiveSessions(h.DB, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := c.GetString("sessionID")
+	views := make([]SessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, SessionView{Session: s, Current: s.ID == current})
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// RevokeSession signs out one of the current user's devices
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	if err := services.RevokeSession(h.DB, c.GetString("userID"), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrSessionInvalid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// LogoutAll signs the current user out on every device, including this one
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	count, err := services.RevokeAllSessions(h.DB, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "revoked": count})
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EditProposalHandler lets any member suggest changes to a person's profile
+// for the person's reviewers to accept or reject field by field
+type EditProposalHandler struct {
+	DB                  *gorm.DB
+	NotificationService *services.NotificationService
+}
+
+type ReviewProposalRequest struct {
+	Decisions []services.ReviewDecision `json:"decisions" binding:"required,min=1,dive"`
+	Overwrite bool                      `json:"overwrite"` // Apply accepted fields even if the person changed since
+}
+
+// EditProposalView is a proposal next to the person's current values
+type EditProposalView struct {
+	models.EditProposal
+	Current   map[string]json.RawMessage `json:"current"`
+	CanReview bool                       `json:"canReview"`
+}
+
+// proposalErrorStatus maps edit proposal service errors to HTTP status codes
+func proposalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProposalNotFound), errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrProposalClosed), errors.Is(err, services.ErrProposalConflict),
+		errors.Is(err, services.ErrRelationshipExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrProposalEmpty), errors.Is(err, services.ErrUnknownField),
+		errors.Is(err, services.ErrInvalidValue), errors.Is(err, services.ErrInvalidRelationship),
+		errors.Is(err, services.ErrRelationshipCycle):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// canReview allows editors and the user linked to the person, except on
+// proposals they made themselves
+func canReview(c *gin.Context, person *models.Person, proposal *models.EditProposal) bool {
+	if proposal.ProposedBy == c.GetString("userID") {
+		return false
+	}
+	return middleware.HasPermission(c, models.PermPersonEdit) ||
+		(person.AuthUserID != "" && person.AuthUserID == c.GetString("userID"))
+}
+
+// canReviewRelationships is needed on top of canReview for relationship
+// changes: they decide who is family, so being linked to the person is not
+// enough
+func canReviewRelationships(c *gin.Context) bool {
+	return middleware.HasPermission(c, models.PermRelationshipManage) ||
+		middleware.HasPermission(c, models.PermPersonEdit)
+}
+
+// notify sends a notification in the background if notifications are set up
+func (h *EditProposalHandler) notify(userID string, proposal *models.EditProposal, title, body string) {
+	if h.NotificationService == nil || userID == "" {
+		return
+	}
+	go h.NotificationService.SendNotification(
+		userID,
+		models.NotificationEditProposal,
+		"edit_proposal",
+		proposal.ID,
+		title,
+		body,
+		map[string]string{"personId": proposal.PersonID},
+	)
+}
+
+// CreateProposal suggests changes to a person. Any member of the tree can
+// propose; nothing changes until a reviewer accepts.
+func (h *EditProposalHandler) CreateProposal(c *gin.Context) {
+	var person models.Person
+	if err := h.DB.First(&person, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+
+	var req services.ProposalInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	viewer := personViewer(c, h.DB)
+	proposal, err := services.CreateEditProposal(h.DB, viewer, &person, req)
+	if err != nil {
+		c.JSON(proposalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// The linked user hears about suggestions to their own profile
+	if person.AuthUserID != proposal.ProposedBy {
+		h.notify(person.AuthUserID, proposal, "Suggested edit to your profile",
+			"Someone suggested changes to "+person.FirstName+" "+person.LastName)
+	}
+
+	c.JSON(http.StatusCreated, redactProposal(viewer, &person, *proposal))
+}
+
+// GetPersonProposals lists the proposals for one person, newest first
+func (h *EditProposalHandler) GetPersonProposals(c *gin.Context) {
+	query := h.DB.Where("person_id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var proposals []models.EditProposal
+	if err := query.Order("created_at DESC").Find(&proposals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proposals"})
+		return
+	}
+	proposals, err := h.redactProposals(c, proposals)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proposals"})
+		return
+	}
+	c.JSON(http.StatusOK, proposals)
+}
+
+// GetProposals lists the proposals the caller can review: every proposal in
+// the tree for editors, otherwise those for persons linked to the caller.
+// ?mine=true lists the caller's own proposals instead. Defaults to pending.
+func (h *EditProposalHandler) GetProposals(c *gin.Context) {
+	userID := c.GetString("userID")
+	query := h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c))
+
+	status := c.DefaultQuery("status", string(models.ProposalPending))
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	switch {
+	case c.Query("mine") == "true":
+		query = query.Where("proposed_by = ?", userID)
+	case !middleware.HasPermission(c, models.PermPersonEdit):
+		linked := h.DB.Model(&models.Person{}).Select("id").Where("auth_user_id = ?", userID)
+		query = query.Where("person_id IN (?)", linked)
+	}
+
+	var proposals []models.EditProposal
+	if err := query.Order("created_at DESC").Find(&proposals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proposals"})
+		return
+	}
+	proposals, err := h.redactProposals(c, proposals)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proposals"})
+		return
+	}
+	c.JSON(http.StatusOK, proposals)
+}
+
+// GetProposal returns a proposal with the person's current values so the
+// changes can be shown side by side
+func (h *EditProposalHandler) GetProposal(c *gin.Context) {
+	var proposal models.EditProposal
+	if err := h.DB.First(&proposal, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+
+	var person models.Person
+	if err := h.DB.First(&person, "id = ?", proposal.PersonID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+
+	// Proposals carry old and new values, so they are as private as the person
+	viewer := personViewer(c, h.DB)
+	visible := services.RedactProposals(viewer, &person, []models.EditProposal{proposal})
+	if len(visible) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+	proposal = visible[0]
+
+	review := canReview(c, &person, &proposal)
+	services.RedactPerson(viewer, &person)
+	c.JSON(http.StatusOK, EditProposalView{
+		EditProposal: proposal,
+		Current:      services.CurrentValues(&person, &proposal),
+		CanReview:    review,
+	})
+}
+
+// ReviewProposal accepts or rejects changes of a proposal. Accepted changes
+// are applied together; if one fails, none are.
+func (h *EditProposalHandler) ReviewProposal(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+
+	var proposal models.EditProposal
+	if err := h.DB.First(&proposal, "id = ? AND family_tree_id = ?", c.Param("id"), familyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+
+	var person models.Person
+	if err := h.DB.First(&person, "id = ?", proposal.PersonID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+	if proposal.ProposedBy == c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't review your own proposal"})
+		return
+	}
+	if !canReview(c, &person, &proposal) {
+		middleware.Forbid(c, models.PermPersonEdit, "Only editors or the linked person can review this proposal")
+		return
+	}
+
+	var req ReviewProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReviewRelationships(c) {
+		edges := map[string]bool{}
+		for _, change := range proposal.Changes {
+			edges[change.ID] = change.Field == models.ProposalFieldRelationship
+		}
+		for _, d := range req.Decisions {
+			if edges[d.ChangeID] {
+				middleware.Forbid(c, models.PermRelationshipManage, "Only editors can review relationship changes")
+				return
+			}
+		}
+	}
+
+	reviewed, err := services.ReviewEditProposal(h.DB, proposal.ID, familyTreeID, c.GetString("userID"), req.Decisions, req.Overwrite)
+	if err != nil {
+		c.JSON(proposalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+
+	if reviewed.Status != models.ProposalPending {
+		h.notify(reviewed.ProposedBy, reviewed, "Your suggested edit was reviewed",
+			"Your changes to "+person.FirstName+" "+person.LastName+" were "+string(reviewed.Status))
+	}
+
+	c.JSON(http.StatusOK, redactProposal(personViewer(c, h.DB), &person, *reviewed))
+}
+
+// redactProposal applies services.RedactProposals to one proposal. A
+// proposal hidden altogether keeps no changes.
+func redactProposal(viewer services.Viewer, person *models.Person, proposal models.EditProposal) models.EditProposal {
+	visible := services.RedactProposals(viewer, person, []models.EditProposal{proposal})
+	if len(visible) == 0 {
+		proposal.Changes = models.ProposalChanges{}
+		return proposal
+	}
+	return visible[0]
+}
+
+// redactProposals applies services.RedactProposals to proposals for any
+// number of persons
+func (h *EditProposalHandler) redactProposals(c *gin.Context, proposals []models.EditProposal) ([]models.EditProposal, error) {
+	ids := make([]string, 0, len(proposals))
+	for _, proposal := range proposals {
+		ids = append(ids, proposal.PersonID)
+	}
+	var persons []models.Person
+	if len(ids) > 0 {
+		if err := h.DB.Unscoped().Where("id IN ?", ids).Find(&persons).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[string]*models.Person, len(persons))
+	for i := range persons {
+		byID[persons[i].ID] = &persons[i]
+	}
+
+	viewer := personViewer(c, h.DB)
+	visible := []models.EditProposal{}
+	for _, proposal := range proposals {
+		if person := byID[proposal.PersonID]; person != nil {
+			visible = append(visible, services.RedactProposals(viewer, person, []models.EditProposal{proposal})...)
+		}
+	}
+	return visible, nil
+}
+
+// WithdrawProposal lets the proposer take back a pending proposal
+func (h *EditProposalHandler) WithdrawProposal(c *gin.Context) {
+	var proposal models.EditProposal
+	if err := h.DB.First(&proposal, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+	if proposal.ProposedBy != c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the proposer can withdraw a proposal"})
+		return
+	}
+
+	if err := services.WithdrawEditProposal(h.DB, &proposal); err != nil {
+		c.JSON(proposalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, proposal)
+}
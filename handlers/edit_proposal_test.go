@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The user linked to a person reviews field changes to it, but neither
+// relationship changes nor their own proposals
+func TestLinkedUserReview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testDB(t, &models.Person{}, &models.PersonRevision{}, &models.Relationship{}, &models.EditProposal{})
+	for _, p := range []models.Person{
+		{ID: "p1", FamilyTreeID: "tree-1", FirstName: "Ada", AuthUserID: "u1"},
+		{ID: "p2", FamilyTreeID: "tree-1", FirstName: "Zaid"},
+	} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	proposal := func(id, by string, changes ...models.ProposalChange) {
+		if err := db.Create(&models.EditProposal{ID: id, FamilyTreeID: "tree-1", PersonID: "p1", ProposedBy: by,
+			Changes: changes, Status: models.ProposalPending}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	bio := func(id string) models.ProposalChange {
+		return models.ProposalChange{ID: id, Field: "bio", Old: json.RawMessage(`""`), New: json.RawMessage(`"Poet"`), Status: models.ChangePending}
+	}
+	proposal("by-other", "u2", bio("bio-1"), models.ProposalChange{
+		ID: "edge-1", Field: models.ProposalFieldRelationship, Status: models.ChangePending,
+		Relationship: &models.ProposedRelationship{Action: "add", PersonID: "p1", RelatedPersonID: "p2", Type: models.RelationshipParentChild},
+	})
+	proposal("by-self", "u1", bio("bio-2"))
+
+	h := &EditProposalHandler{DB: db}
+	router := gin.New()
+	router.POST("/proposals/:id/review", func(c *gin.Context) {
+		c.Set("userID", "u1")
+		c.Set("familyTreeID", "tree-1")
+		h.ReviewProposal(c)
+	})
+	review := func(proposalID, changeID string) int {
+		data, _ := json.Marshal(ReviewProposalRequest{Decisions: []services.ReviewDecision{{ChangeID: changeID, Accept: true}}})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/proposals/"+proposalID+"/review", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name     string
+		proposal string
+		change   string
+		want     int
+	}{
+		{"own proposal", "by-self", "bio-2", http.StatusForbidden},
+		{"relationship change", "by-other", "edge-1", http.StatusForbidden},
+		{"field change", "by-other", "bio-1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := review(tt.proposal, tt.change); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	var edges int64
+	db.Model(&models.Relationship{}).Count(&edges)
+	if edges != 0 {
+		t.Errorf("%d relationships added, want none", edges)
+	}
+}
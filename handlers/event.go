@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
 	"family-tree-backend/services"
 	"net/http"
 	"time"
@@ -16,13 +18,34 @@ type EventHandler struct {
 	NotificationService *services.NotificationService
 }
 
+// canModify lets creators change their own events and event:manage holders
+// change any event
+func (h *EventHandler) canModify(c *gin.Context, event *models.Event) bool {
+	return event.CreatedBy == c.GetString("userID") || middleware.HasPermission(c, models.PermEventManage)
+}
+
+// eventListSpec filters since and until on when events happen, so
+// since=<now> lists upcoming events
+var eventListSpec = pagination.Spec{
+	Sorts:       map[string]string{"dateTime": "date_time", "createdAt": "created_at"},
+	DefaultSort: "dateTime",
+	TimeColumn:  "date_time",
+	Filters:     map[string]string{"createdBy": "created_by", "placeId": "place_id"},
+}
+
 func (h *EventHandler) GetEvents(c *gin.Context) {
-	var events []models.Event
-	if result := h.DB.Order("date_time asc").Find(&events); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	params, err := pagination.Parse(c, eventListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, events)
+	page, err := pagination.Find(h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c)), params,
+		func(e models.Event) string { return e.ID })
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *EventHandler) CreateEvent(c *gin.Context) {
@@ -33,9 +56,16 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 	}
 
 	event.ID = uuid.New().String()
+	event.FamilyTreeID = middleware.FamilyTreeID(c)
+	event.CreatedBy = c.GetString("userID")
 	event.CreatedAt = time.Now()
 	event.UpdatedAt = time.Now()
 
+	if err := services.ApplyEventPlace(h.DB, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if result := h.DB.Create(&event); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -58,18 +88,28 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 	}
 
 	var event models.Event
-	if result := h.DB.First(&event, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&event, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 		return
 	}
+	if !h.canModify(c, &event) {
+		middleware.Forbid(c, models.PermEventManage, "Not authorized to edit this event")
+		return
+	}
 
 	event.Title = req.Title
 	event.Description = req.Description
 	event.Location = req.Location
 	event.MapLink = req.MapLink
+	event.PlaceID = req.PlaceID
 	event.DateTime = req.DateTime
 	event.UpdatedAt = time.Now()
 
+	if err := services.ApplyEventPlace(h.DB, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if result := h.DB.Save(&event); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -92,10 +132,20 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 func (h *EventHandler) DeleteEvent(c *gin.Context) {
 	id := c.Param("id")
 
+	var event models.Event
+	if result := h.DB.First(&event, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if !h.canModify(c, &event) {
+		middleware.Forbid(c, models.PermEventManage, "Not authorized to delete this event")
+		return
+	}
+
 	// Delete associated reminders first
 	h.DB.Where("entity_id = ? AND entity_type = ?", id, "event").Delete(&models.Reminder{})
 
-	if result := h.DB.Delete(&models.Event{}, "id = ?", id); result.Error != nil {
+	if result := h.DB.Delete(&event); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
@@ -107,7 +157,7 @@ func (h *EventHandler) ToggleRSVP(c *gin.Context) {
 	id := c.Param("id")
 
 	var event models.Event
-	if result := h.DB.First(&event, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&event, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 		return
 	}
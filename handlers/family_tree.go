@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"errors"
+	"family-tree-backend/mail"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FamilyTreeHandler struct {
+	DB     *gorm.DB
+	Mailer mail.Sender
+}
+
+type CreateTreeRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	IsPublic    bool   `json:"isPublic"`
+}
+
+type UpdateTreeRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"isPublic"`
+}
+
+type SwitchTreeRequest struct {
+	FamilyTreeID string `json:"familyTreeId" binding:"required"`
+}
+
+type AddMemberRequest struct {
+	UserID string          `json:"userId"`
+	Email  string          `json:"email"`
+	Role   models.TreeRole `json:"role"`
+}
+
+type UpdateMemberRequest struct {
+	Role models.TreeRole `json:"role" binding:"required"`
+}
+
+// TreeSummary is a tree together with the caller's role in it
+type TreeSummary struct {
+	models.FamilyTree
+	Role    models.TreeRole `json:"role"`
+	Current bool            `json:"current"`
+}
+
+// treeMemberErrorStatus maps membership service errors to HTTP status codes
+func treeMemberErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrLastOwner):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrNotMember):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// canAssignRole checks that the caller may grant, change or take away role.
+// Only owners can hand out or take away owner and admin; anyone else needs
+// member:manage and every permission the role grants.
+func canAssignRole(c *gin.Context, db *gorm.DB, role models.TreeRole) bool {
+	if middleware.CurrentTreeRole(c).CanManageAdmins() {
+		return true
+	}
+	if role == models.TreeRoleOwner || role == models.TreeRoleAdmin || !middleware.HasPermission(c, models.PermMemberManage) {
+		return false
+	}
+
+	perms, err := services.RolePermissions(db, middleware.FamilyTreeID(c), role)
+	if errors.Is(err, services.ErrRoleNotFound) {
+		// Left over from a deleted custom role; it grants nothing
+		return true
+	}
+	return err == nil && middleware.Permissions(c).Covers(perms)
+}
+
+// isTreeRole reports whether role is built in or defined for the current tree
+func isTreeRole(c *gin.Context, db *gorm.DB, role models.TreeRole) bool {
+	_, err := services.RolePermissions(db, middleware.FamilyTreeID(c), role)
+	return err == nil
+}
+
+// GetMyTrees lists the trees the current user belongs to
+func (h *FamilyTreeHandler) GetMyTrees(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var memberships []models.TreeMembership
+	if err := h.DB.Where("user_id = ?", user.ID).Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	roles := make(map[string]models.TreeRole, len(memberships))
+	treeIDs := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.FamilyTreeID] = m.Role
+		treeIDs = append(treeIDs, m.FamilyTreeID)
+	}
+
+	var trees []models.FamilyTree
+	if err := h.DB.Where("id IN ?", treeIDs).Order("name").Find(&trees).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries := make([]TreeSummary, 0, len(trees))
+	for _, tree := range trees {
+		summaries = append(summaries, TreeSummary{
+			FamilyTree: tree,
+			Role:       roles[tree.ID],
+			Current:    tree.ID == user.FamilyTreeID,
+		})
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// CreateTree starts a new family tree owned by the current user
+func (h *FamilyTreeHandler) CreateTree(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req CreateTreeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tree := models.FamilyTree{
+		Name:        req.Name,
+		Description: req.Description,
+		IsPublic:    req.IsPublic,
+	}
+	if err := services.CreateFamilyTree(h.DB, &tree, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, TreeSummary{
+		FamilyTree: tree,
+		Role:       models.TreeRoleOwner,
+		Current:    user.FamilyTreeID == "",
+	})
+}
+
+// SwitchTree changes the tree used when a request doesn't name one
+func (h *FamilyTreeHandler) SwitchTree(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req SwitchTreeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.DB.Model(&models.TreeMembership{}).Where("family_tree_id = ? AND user_id = ?", req.FamilyTreeID, user.ID).Count(&count)
+	if count == 0 && !user.IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this family tree"})
+		return
+	}
+
+	if err := h.DB.Model(&user).Update("family_tree_id", req.FamilyTreeID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateTree renames the current tree or changes its visibility (Admin only)
+func (h *FamilyTreeHandler) UpdateTree(c *gin.Context) {
+	var req UpdateTreeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tree models.FamilyTree
+	if err := h.DB.First(&tree, "id = ?", middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Family tree not found"})
+		return
+	}
+
+	if req.Name != nil {
+		tree.Name = *req.Name
+	}
+	if req.Description != nil {
+		tree.Description = *req.Description
+	}
+	if req.IsPublic != nil {
+		tree.IsPublic = *req.IsPublic
+	}
+	tree.UpdatedAt = time.Now()
+
+	if err := h.DB.Save(&tree).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// GetMembers lists the current tree's members with their roles (Admin only)
+func (h *FamilyTreeHandler) GetMembers(c *gin.Context) {
+	var memberships []models.TreeMembership
+	if err := h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c)).Order("created_at").Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, memberships)
+}
+
+// AddMember invites a user to the current tree by email or user ID. The
+// invitation is emailed and only that address can redeem it, so nobody
+// joins a tree without accepting. The response is the same whether or not
+// the address has an account, so it can't be used to look up users. (Admin only)
+func (h *FamilyTreeHandler) AddMember(c *gin.Context) {
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UserID == "" && req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId or email is required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.TreeRoleMember
+	}
+	if !isTreeRole(c, h.DB, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	if !canAssignRole(c, h.DB, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't grant this role"})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		var user models.User
+		if err := h.DB.Select("email").First(&user, "id = ?", req.UserID).Error; err == nil {
+			email = user.Email
+		}
+	}
+	if email != "" {
+		if err := h.inviteMember(c, email, req.Role); err != nil {
+			log.Printf("Failed to invite %s to tree %s: %v", email, middleware.FamilyTreeID(c), err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Invitation sent; they join the tree once they accept it"})
+}
+
+// inviteMember creates a single-use invitation for an email address and
+// mails its code
+func (h *FamilyTreeHandler) inviteMember(c *gin.Context, email string, role models.TreeRole) error {
+	var tree models.FamilyTree
+	if err := h.DB.First(&tree, "id = ?", middleware.FamilyTreeID(c)).Error; err != nil {
+		return err
+	}
+	inv := models.Invitation{
+		FamilyTreeID: tree.ID,
+		Role:         role,
+		Email:        email,
+		MaxUses:      1,
+		ExpiresAt:    time.Now().Add(defaultInviteExpiry),
+		CreatedBy:    c.GetString("userID"),
+	}
+	if err := services.CreateInvitation(h.DB, &inv); err != nil {
+		return err
+	}
+
+	inviter := "A member"
+	if user, ok := c.Get("user"); ok {
+		if name := user.(models.User).Name; name != "" {
+			inviter = name
+		}
+	}
+	accept := "enter the code " + inv.Code
+	if link := invitationView(inv).Link; link != "" {
+		accept = "open:\n\n" + link + "\n\nor enter the code " + inv.Code
+	}
+	return h.Mailer.Send(c.Request.Context(), mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Join %s on Family Tree", tree.Name),
+		Body: fmt.Sprintf("Hello,\n\n%s invited you to the family tree %q. To accept, sign in or create an account "+
+			"with this email address and %s.\n\nThe invitation works once and expires in 7 days. "+
+			"If you don't want to join, you can ignore this email.\n",
+			inviter, tree.Name, accept),
+	})
+}
+
+// findMember loads a membership of the current tree
+func (h *FamilyTreeHandler) findMember(c *gin.Context) (*models.TreeMembership, bool) {
+	var membership models.TreeMembership
+	if err := h.DB.Where("family_tree_id = ? AND user_id = ?", middleware.FamilyTreeID(c), c.Param("userId")).First(&membership).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrNotMember.Error()})
+		return nil, false
+	}
+	return &membership, true
+}
+
+// UpdateMember changes a member's role (Admin only)
+func (h *FamilyTreeHandler) UpdateMember(c *gin.Context) {
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !isTreeRole(c, h.DB, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	membership, ok := h.findMember(c)
+	if !ok {
+		return
+	}
+	if !canAssignRole(c, h.DB, req.Role) || !canAssignRole(c, h.DB, membership.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't change this member's role"})
+		return
+	}
+
+	if err := services.ChangeTreeMemberRole(h.DB, membership, req.Role); err != nil {
+		c.JSON(treeMemberErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveMember takes a user out of the current tree (Admin only)
+func (h *FamilyTreeHandler) RemoveMember(c *gin.Context) {
+	membership, ok := h.findMember(c)
+	if !ok {
+		return
+	}
+	if !canAssignRole(c, h.DB, membership.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't remove this member"})
+		return
+	}
+
+	if err := services.RemoveTreeMember(h.DB, membership); err != nil {
+		c.JSON(treeMemberErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"family-tree-backend/gedcom"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GedcomHandler struct {
+	DB *gorm.DB
+}
+
+// maxGedcomUpload caps GEDCOM uploads; files of whole family databases with
+// tens of thousands of individuals stay well under it
+const maxGedcomUpload = 50 << 20
+
+// ImportGedcom reads an uploaded GEDCOM file into a family tree. With
+// dryRun=true nothing is saved and only the report is returned.
+func (h *GedcomHandler) ImportGedcom(c *gin.Context) {
+	familyTreeID := c.Param("familyTreeId")
+	dryRun := c.Query("dryRun") == "true"
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxGedcomUpload)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("GEDCOM files can be at most %d MB", maxGedcomUpload>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	doc, err := gedcom.Parse(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := gedcom.Import(doc, familyTreeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result.Report.DryRun = dryRun
+	if dryRun {
+		c.JSON(http.StatusOK, result.Report)
+		return
+	}
+
+	if err := services.SaveGedcomImport(h.DB, result, c.GetString("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+
+	c.JSON(http.StatusCreated, result.Report)
+}
+
+// ExportGedcom downloads every person in a family tree as a GEDCOM file
+func (h *GedcomHandler) ExportGedcom(c *gin.Context) {
+	familyTreeID := c.Param("familyTreeId")
+
+	var persons []models.Person
+	if result := h.DB.Where("family_tree_id = ?", familyTreeID).Order("created_at").Find(&persons); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	var edges []models.Relationship
+	if result := h.DB.Where("family_tree_id = ?", familyTreeID).Order("created_at").Find(&edges); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	var sources []models.Source
+	if result := h.DB.Where("family_tree_id = ?", familyTreeID).Order("created_at").Find(&sources); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	var citations []models.Citation
+	if result := h.DB.Where("family_tree_id = ?", familyTreeID).Order("created_at").Find(&citations); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	// Exports follow the same privacy rules as the API
+	services.RedactPersons(personViewer(c, h.DB), persons)
+	cited := services.VisibleCitations(persons, citations)
+
+	var buf bytes.Buffer
+	if err := gedcom.Export(&buf, persons, edges, sources, cited); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", familyTreeID+".ged"))
+	c.Data(http.StatusOK, "text/vnd.familysearch.gedcom; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImportGedcomSizeLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &GedcomHandler{}
+	router := gin.New()
+	router.POST("/trees/:familyTreeId/import", h.ImportGedcom)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "family.ged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("0 HEAD\n"))
+	file.Write(bytes.Repeat([]byte("0 NOTE padding\n"), maxGedcomUpload/15+1))
+	form.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/trees/tree-1/import?dryRun=true", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413: %s", w.Code, w.Body)
+	}
+}
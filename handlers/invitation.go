@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InvitationHandler struct {
+	DB *gorm.DB
+}
+
+const (
+	defaultInviteExpiry = 7 * 24 * time.Hour
+	maxInviteExpiry     = 90 * 24 * time.Hour
+	maxInviteUses       = 500
+)
+
+type CreateInvitationRequest struct {
+	Role           models.TreeRole `json:"role"`
+	PersonID       string          `json:"personId"`
+	Note           string          `json:"note"`
+	MaxUses        int             `json:"maxUses"`
+	ExpiresInHours int             `json:"expiresInHours"`
+}
+
+type RedeemInvitationRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// InvitationView is an invitation with its derived status and join link
+type InvitationView struct {
+	models.Invitation
+	Status string `json:"status"`
+	Link   string `json:"link,omitempty"`
+}
+
+func invitationView(inv models.Invitation) InvitationView {
+	view := InvitationView{Invitation: inv, Status: inv.Status(time.Now())}
+	// INVITE_BASE_URL is the app page that accepts ?code=, e.g. https://family.example.com/join
+	if base := os.Getenv("INVITE_BASE_URL"); base != "" {
+		view.Link = strings.TrimRight(base, "/") + "?code=" + inv.Code
+	}
+	return view
+}
+
+// invitationErrorStatus maps invitation service errors to HTTP status codes
+func invitationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvitationNotFound), errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvitationInvalid):
+		return http.StatusGone
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrPersonAlreadyLinked):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvitationEmail):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateInvitation issues an expiring, usage-limited invite code for the
+// current tree (Admin only)
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.TreeRoleMember
+	}
+	if !isTreeRole(c, h.DB, req.Role) || req.Role == models.TreeRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	if !canAssignRole(c, h.DB, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't invite people with this role"})
+		return
+	}
+
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 1 || req.MaxUses > maxInviteUses {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxUses must be between 1 and 500"})
+		return
+	}
+
+	expiry := defaultInviteExpiry
+	if req.ExpiresInHours != 0 {
+		expiry = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if expiry <= 0 || expiry > maxInviteExpiry {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInHours must be between 1 and 2160"})
+		return
+	}
+
+	inv := models.Invitation{
+		FamilyTreeID: middleware.FamilyTreeID(c),
+		Role:         req.Role,
+		PersonID:     req.PersonID,
+		Note:         req.Note,
+		MaxUses:      req.MaxUses,
+		ExpiresAt:    time.Now().Add(expiry),
+		CreatedBy:    c.GetString("userID"),
+	}
+	if err := services.CreateInvitation(h.DB, &inv); err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitationView(inv))
+}
+
+// GetInvitations lists the current tree's invitations, newest first (Admin only)
+func (h *InvitationHandler) GetInvitations(c *gin.Context) {
+	var invitations []models.Invitation
+	if err := h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c)).Order("created_at desc").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	views := make([]InvitationView, 0, len(invitations))
+	for _, inv := range invitations {
+		views = append(views, invitationView(inv))
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// RevokeInvitation stops an invitation from being used. The row is kept for
+// the audit trail. (Admin only)
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	var inv models.Invitation
+	if err := h.DB.First(&inv, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	if inv.RevokedAt == nil {
+		now := time.Now()
+		inv.RevokedAt = &now
+		inv.RevokedBy = c.GetString("userID")
+		inv.UpdatedAt = now
+		if err := h.DB.Save(&inv).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, invitationView(inv))
+}
+
+// GetRedemptions lists who joined with an invitation and when (Admin only)
+func (h *InvitationHandler) GetRedemptions(c *gin.Context) {
+	var redemptions []models.InvitationRedemption
+	if err := h.DB.Where("invitation_id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).
+		Order("redeemed_at").Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redemptions)
+}
+
+// PreviewInvitation shows which tree a code is for before signing up
+func (h *InvitationHandler) PreviewInvitation(c *gin.Context) {
+	inv, err := services.FindInvitation(h.DB, c.Param("code"))
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var tree models.FamilyTree
+	if err := h.DB.First(&tree, "id = ?", inv.FamilyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrInvitationNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"familyTreeId": tree.ID,
+		"treeName":     tree.Name,
+		"role":         inv.Role,
+		"status":       inv.Status(time.Now()),
+		"expiresAt":    inv.ExpiresAt,
+		"linksPerson":  inv.PersonID != "",
+	})
+}
+
+// RedeemInvitation joins the current user to the invitation's tree
+func (h *InvitationHandler) RedeemInvitation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req RedeemInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var redemption *models.InvitationRedemption
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		redemption, err = services.RedeemInvitation(tx, req.Code, &user)
+		return err
+	})
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if redemption.PersonID != "" {
+		middleware.DeleteCache(context.Background(), personsCacheKey(redemption.FamilyTreeID))
+	}
+
+	h.DB.First(&user, "id = ?", user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"redemption": redemption,
+		"user":       user,
+	})
+}
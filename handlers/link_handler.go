@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/services"
 	"net/http"
 	"time"
 
@@ -36,10 +38,11 @@ func (h *LinkHandler) RequestLink(c *gin.Context) {
 		return
 	}
 
-	// Get User to find FamilyTreeID
-	var user models.User
-	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// The person must be in the tree the request acts on
+	familyTreeID := middleware.FamilyTreeID(c)
+	var person models.Person
+	if err := h.DB.First(&person, "id = ? AND family_tree_id = ?", req.PersonID, familyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
 		return
 	}
 
@@ -54,7 +57,7 @@ func (h *LinkHandler) RequestLink(c *gin.Context) {
 		ID:           uuid.New().String(),
 		UserID:       userID,
 		PersonID:     req.PersonID,
-		FamilyTreeID: user.FamilyTreeID,
+		FamilyTreeID: familyTreeID,
 		Status:       models.LinkStatusPending,
 		RequestedAt:  time.Now(),
 		CreatedAt:    time.Now(),
@@ -73,7 +76,7 @@ func (h *LinkHandler) RequestLink(c *gin.Context) {
 func (h *LinkHandler) GetLinkRequests(c *gin.Context) {
 	var requests []models.LinkRequest
 	// Preload User and Person details if needed, for now just raw requests
-	if err := h.DB.Where("status = ?", models.LinkStatusPending).Find(&requests).Error; err != nil {
+	if err := h.DB.Where("status = ? AND family_tree_id = ?", models.LinkStatusPending, middleware.FamilyTreeID(c)).Find(&requests).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch requests"})
 		return
 	}
@@ -93,7 +96,7 @@ func (h *LinkHandler) UpdateLinkStatus(c *gin.Context) {
 	}
 
 	var linkRequest models.LinkRequest
-	if err := h.DB.First(&linkRequest, "id = ?", requestID).Error; err != nil {
+	if err := h.DB.First(&linkRequest, "id = ? AND family_tree_id = ?", requestID, middleware.FamilyTreeID(c)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
 		return
 	}
@@ -125,7 +128,19 @@ func (h *LinkHandler) UpdateLinkStatus(c *gin.Context) {
 		}
 
 		// Update Person: AuthUserID = linkRequest.UserID
-		if err := tx.Model(&models.Person{}).Where("id = ?", linkRequest.PersonID).Update("auth_user_id", linkRequest.UserID).Error; err != nil {
+		var person models.Person
+		if err := tx.First(&person, "id = ?", linkRequest.PersonID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+			return
+		}
+		before := person
+		if err := tx.Model(&person).Update("auth_user_id", linkRequest.UserID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link person"})
+			return
+		}
+		if err := services.RecordPersonRevision(tx, &before, &person, adminID, models.RevisionLink, linkRequest.ID); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link person"})
 			return
@@ -162,7 +177,7 @@ func (h *LinkHandler) GetMyLinkStatus(c *gin.Context) {
 
 	// Check for pending request
 	var linkRequest models.LinkRequest
-	if err := h.DB.Where("user_id = ? AND status = ?", userID, models.LinkStatusPending).First(&linkRequest).Error; err != nil {
+	if err := h.DB.Where("user_id = ? AND status = ? AND family_tree_id = ?", userID, models.LinkStatusPending, middleware.FamilyTreeID(c)).First(&linkRequest).Error; err != nil {
 		// No pending request
 		c.JSON(http.StatusOK, gin.H{
 			"isVerified": false,
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
 	"family-tree-backend/services"
 	"net/http"
 	"time"
@@ -16,13 +18,28 @@ type MessageHandler struct {
 	NotificationService *services.NotificationService
 }
 
+// messageListSpec pages chat newest first, so a chat screen loads the
+// latest messages and follows the cursor back in time
+var messageListSpec = pagination.Spec{
+	Sorts:       map[string]string{"sentAt": "sent_at"},
+	DefaultSort: "-sentAt",
+	TimeColumn:  "sent_at",
+	Filters:     map[string]string{"userId": "user_id", "type": "type"},
+}
+
 func (h *MessageHandler) GetMessages(c *gin.Context) {
-	var messages []models.Message
-	if result := h.DB.Order("sent_at asc").Find(&messages); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	params, err := pagination.Parse(c, messageListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := pagination.Find(h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c)), params,
+		func(m models.Message) string { return m.ID })
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *MessageHandler) SendMessage(c *gin.Context) {
@@ -33,6 +50,7 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}
 
 	message.ID = uuid.New().String()
+	message.FamilyTreeID = middleware.FamilyTreeID(c)
 	message.SentAt = time.Now()
 	message.CreatedAt = time.Now()
 	message.IsRead = false
@@ -42,17 +60,16 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Send notification to all users except sender
+	// Send notification to the tree's members except sender
 	if h.NotificationService != nil {
 		go func() {
-			var users []models.User
-			h.DB.Find(&users)
+			memberIDs, _ := services.TreeMemberIDs(h.DB, message.FamilyTreeID)
 
 			var userIDs []string
-			for _, user := range users {
+			for _, memberID := range memberIDs {
 				// Don't notify the message sender
-				if user.ID != message.UserID {
-					userIDs = append(userIDs, user.ID)
+				if memberID != message.UserID {
+					userIDs = append(userIDs, memberID)
 				}
 			}
 
@@ -80,7 +97,7 @@ func (h *MessageHandler) UpdateMessage(c *gin.Context) {
 	}
 
 	var message models.Message
-	if result := h.DB.First(&message, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&message, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
@@ -93,8 +110,8 @@ func (h *MessageHandler) UpdateMessage(c *gin.Context) {
 	}
 	currentUser := user.(models.User)
 
-	if currentUser.Role != "admin" && message.UserID != currentUser.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to edit this message"})
+	if !middleware.HasPermission(c, models.PermMessageModerate) && message.UserID != currentUser.ID {
+		middleware.Forbid(c, models.PermMessageModerate, "Not authorized to edit this message")
 		return
 	}
 
@@ -112,7 +129,7 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 	id := c.Param("id")
 
 	var message models.Message
-	if result := h.DB.First(&message, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&message, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
@@ -125,8 +142,8 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 	}
 	currentUser := user.(models.User)
 
-	if currentUser.Role != "admin" && message.UserID != currentUser.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to delete this message"})
+	if !middleware.HasPermission(c, models.PermMessageModerate) && message.UserID != currentUser.ID {
+		middleware.Forbid(c, models.PermMessageModerate, "Not authorized to delete this message")
 		return
 	}
 
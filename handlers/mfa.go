@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"family-tree-backend/auth"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"` // Authenticator code or recovery code
+}
+
+type MFALoginRequest struct {
+	MFAToken   string `json:"mfaToken" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+// mfaErrorStatus maps two-factor service errors to HTTP status codes
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMFACodeInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrMFALocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetMFAStatus shows whether the current user has two-factor authentication on
+func (h *AuthHandler) GetMFAStatus(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	status := gin.H{
+		"enabled":       user.MFAEnabled,
+		"mfaVerifiedAt": nil,
+	}
+	if at := middleware.MFAVerifiedAt(c); !at.IsZero() {
+		status["mfaVerifiedAt"] = at
+	}
+	if user.MFAEnabled {
+		status["recoveryCodesRemaining"] = services.RemainingRecoveryCodes(h.DB, user.ID)
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// StartMFAEnrollment returns a new secret and the otpauth:// URI to show as a
+// QR code
+func (h *AuthHandler) StartMFAEnrollment(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	secret, uri, err := services.StartMFAEnrollment(h.DB, &user)
+	if err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "uri": uri})
+}
+
+// ConfirmMFAEnrollment turns two-factor authentication on with a first code
+// from the app. The recovery codes are only ever shown in this response.
+func (h *AuthHandler) ConfirmMFAEnrollment(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := services.ConfirmMFAEnrollment(h.DB, &user, req.Code)
+	if err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Entering the code just now counts as a check for this device
+	if sessionID := c.GetString("sessionID"); sessionID != "" {
+		services.MarkSessionMFAVerified(h.DB, sessionID)
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "recoveryCodes": codes})
+}
+
+// VerifyMFA re-checks the second factor on the current session, e.g. when an
+// admin route answers with code "mfa_required"
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	sessionID := c.GetString("sessionID")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Firebase accounts use Firebase multi-factor sign-in"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.VerifyMFA(h.DB, c.GetString("userID"), req.Code); err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.MarkSessionMFAVerified(h.DB, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verified"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes. Requires a current code.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.VerifyMFA(h.DB, userID, req.Code); err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// DisableMFA turns two-factor authentication off. Requires a current code.
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.VerifyMFA(h.DB, userID, req.Code); err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.DisableMFA(h.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": false})
+}
+
+// CompleteMFALogin finishes a login that answered mfaRequired, creating the
+// session once the second factor checks out
+func (h *AuthHandler) CompleteMFALogin(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := auth.ValidateMFAChallenge(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err := services.VerifyMFA(h.DB, userID, req.Code); err != nil {
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if result := h.DB.First(&user, "id = ?", userID); result.Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	tokens, err := services.CreateSession(h.DB, user.ID, deviceInfo(c, req.DeviceName))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if err := services.MarkSessionMFAVerified(h.DB, tokens.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"user":         user,
+	})
+}
+
+// ResetUserMFA turns off two-factor authentication for a user who lost their
+// authenticator and recovery codes (Global admin only)
+func (h *AuthHandler) ResetUserMFA(c *gin.Context) {
+	var user models.User
+	if result := h.DB.First(&user, "id = ?", c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := services.DisableMFA(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Whoever held the lost device should not stay signed in
+	services.RevokeAllSessions(h.DB, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
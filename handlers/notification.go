@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
 	"net/http"
 	"time"
 
@@ -63,7 +64,15 @@ func (h *NotificationHandler) RegisterDeviceToken(c *gin.Context) {
 	c.JSON(http.StatusCreated, token)
 }
 
-// GetNotifications retrieves all notifications for the current user
+var notificationListSpec = pagination.Spec{
+	Sorts:       map[string]string{"createdAt": "created_at"},
+	DefaultSort: "-createdAt",
+	TimeColumn:  "created_at",
+	Filters:     map[string]string{"type": "type", "entityType": "entity_type"},
+}
+
+// GetNotifications pages through the current user's notifications, newest
+// first. unread=true leaves out those already read.
 func (h *NotificationHandler) GetNotifications(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -71,16 +80,22 @@ func (h *NotificationHandler) GetNotifications(c *gin.Context) {
 		return
 	}
 
-	var notifications []models.Notification
-	if err := h.DB.Where("user_id = ?", userID.(string)).
-		Order("created_at DESC").
-		Limit(100).
-		Find(&notifications).Error; err != nil {
+	params, err := pagination.Parse(c, notificationListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := h.DB.Where("user_id = ?", userID.(string))
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	page, err := pagination.Find(query, params, func(n models.Notification) string { return n.ID })
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, notifications)
+	c.JSON(http.StatusOK, page)
 }
 
 // MarkAsRead marks a notification as read
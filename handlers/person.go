@@ -3,9 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
+	"family-tree-backend/services"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,46 +21,183 @@ type PersonHandler struct {
 	DB *gorm.DB
 }
 
-const personsCacheKey = "persons:all"
 const personsCacheDuration = 5 * time.Minute
 
+// personsCacheKey is the cache entry holding the first page of one tree's
+// person list
+func personsCacheKey(familyTreeID string) string {
+	return "persons:" + familyTreeID
+}
+
+// personViewer is who the persons in a response are shown to. Routes outside
+// the tree middleware, such as the public list, get the public viewer.
+func personViewer(c *gin.Context, db *gorm.DB) services.Viewer {
+	treeID := middleware.FamilyTreeID(c)
+	if treeID == "" {
+		return services.Viewer{}
+	}
+	return services.NewViewer(db, c.GetString("userID"), treeID, middleware.HasPermission(c, models.PermPersonEdit))
+}
+
+// GetPersons lists every person in the caller's current tree
 func (h *PersonHandler) GetPersons(c *gin.Context) {
+	h.listPersons(c, middleware.FamilyTreeID(c))
+}
+
+// GetPublicPersons lists the persons of a tree that its admins made public
+func (h *PersonHandler) GetPublicPersons(c *gin.Context) {
+	familyTreeID := c.Query("familyTreeId")
+	if familyTreeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "familyTreeId is required"})
+		return
+	}
+
+	var tree models.FamilyTree
+	if result := h.DB.First(&tree, "id = ? AND is_public = ?", familyTreeID, true); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Family tree not found"})
+		return
+	}
+
+	h.listPersons(c, familyTreeID)
+}
+
+// personListSpec pages persons alphabetically by default. since and until
+// apply to when a person last changed, so clients can fetch only updates.
+var personListSpec = pagination.Spec{
+	Sorts: map[string]string{
+		"lastName": "last_name", "firstName": "first_name",
+		"createdAt": "created_at", "updatedAt": "updated_at",
+	},
+	DefaultSort:  "lastName",
+	TimeColumn:   "updated_at",
+	Filters:      map[string]string{"gender": "gender", "lastName": "last_name"},
+	DefaultLimit: 200,
+	MaxLimit:     1000,
+}
+
+func (h *PersonHandler) listPersons(c *gin.Context, familyTreeID string) {
+	params, err := pagination.Parse(c, personListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	ctx := context.Background()
+	cacheKey := personsCacheKey(familyTreeID)
+	cacheable := params.IsDefault(personListSpec)
 
 	// Try to get from cache first
-	cachedData, err := middleware.GetCache(ctx, personsCacheKey)
-	if err == nil && cachedData != "" {
-		var persons []models.Person
-		if err := json.Unmarshal([]byte(cachedData), &persons); err == nil {
-			c.Header("X-Cache", "HIT")
-			c.JSON(http.StatusOK, persons)
-			return
+	if cacheable {
+		cachedData, err := middleware.GetCache(ctx, cacheKey)
+		if err == nil && cachedData != "" {
+			var page pagination.Page[models.Person]
+			if err := json.Unmarshal([]byte(cachedData), &page); err == nil {
+				services.RedactPersons(personViewer(c, h.DB), page.Items)
+				c.Header("X-Cache", "HIT")
+				c.JSON(http.StatusOK, page)
+				return
+			}
 		}
 	}
 
 	// Cache miss, fetch from database
-	var persons []models.Person
-	if result := h.DB.Find(&persons); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	page, err := pagination.Find(h.DB.Where("family_tree_id = ?", familyTreeID), params,
+		func(p models.Person) string { return p.ID })
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.LoadRelationships(h.DB, page.Items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.LoadCitations(h.DB, page.Items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Store in cache
-	if jsonData, err := json.Marshal(persons); err == nil {
-		middleware.SetCache(ctx, personsCacheKey, string(jsonData), personsCacheDuration)
+	if cacheable {
+		if jsonData, err := json.Marshal(page); err == nil {
+			middleware.SetCache(ctx, cacheKey, string(jsonData), personsCacheDuration)
+		}
 	}
 
+	services.RedactPersons(personViewer(c, h.DB), page.Items)
 	c.Header("X-Cache", "MISS")
-	c.JSON(http.StatusOK, persons)
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchPersons finds persons by name in any spelling or script, narrowed by
+// birth year, gender, living status and generation
+func (h *PersonHandler) SearchPersons(c *gin.Context) {
+	search := services.PersonSearch{
+		Query:          c.Query("q"),
+		Gender:         c.Query("gender"),
+		GenerationFrom: c.Query("generationFrom"),
+		Limit:          20,
+	}
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 100 {
+		search.Limit = v
+	}
+
+	for param, year := range map[string]*int{"birthYearFrom": &search.BirthYearFrom, "birthYearTo": &search.BirthYearTo} {
+		if raw := c.Query(param); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 1 || v > 9999 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a year"})
+				return
+			}
+			*year = v
+		}
+	}
+	if raw := c.Query("living"); raw != "" {
+		living, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "living must be true or false"})
+			return
+		}
+		search.Living = &living
+	}
+	if raw := c.Query("generation"); raw != "" {
+		generation, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "generation must be a number"})
+			return
+		}
+		search.Generation = &generation
+	}
+
+	results, err := services.SearchPersons(h.DB, personViewer(c, h.DB), middleware.FamilyTreeID(c), search)
+	switch {
+	case errors.Is(err, services.ErrNoGenerationRoot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPersonNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
 }
 
 func (h *PersonHandler) GetPerson(c *gin.Context) {
 	id := c.Param("id")
 	var person models.Person
-	if result := h.DB.First(&person, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&person, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
 		return
 	}
+	if err := services.LoadPersonRelationships(h.DB, &person); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.LoadPersonCitations(h.DB, &person); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.RedactPerson(personViewer(c, h.DB), &person)
 	c.JSON(http.StatusOK, person)
 }
 
@@ -66,38 +207,78 @@ func (h *PersonHandler) CreatePerson(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !person.Privacy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "privacy must be members, public or private"})
+		return
+	}
+	// Field privacy is the linked user's own choice, made through UpdatePrivacy
+	person.FieldPrivacy = nil
 
 	// Set ID if not provided
 	if person.ID == "" {
 		person.ID = uuid.New().String()
 	}
 
+	// Persons always belong to the tree the request acts on
+	person.FamilyTreeID = middleware.FamilyTreeID(c)
+
+	if err := services.ResolveEventPlaces(h.DB, person.FamilyTreeID, person.LifeEvents); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Set timestamps
 	person.CreatedAt = time.Now()
 	person.UpdatedAt = time.Now()
 
-	// Set AuthUserID from context if not provided (optional, depending on logic)
-	userID, exists := c.Get("userID")
-	if exists && person.AuthUserID == "" {
-		person.AuthUserID = userID.(string)
+	// Persons are linked to accounts by approved link requests and redeemed
+	// invitations. ?linkToMe=true creates the caller's own profile instead.
+	person.AuthUserID = ""
+	if c.Query("linkToMe") == "true" {
+		userID := c.GetString("userID")
+		var linked int64
+		if err := h.DB.Model(&models.Person{}).
+			Where("family_tree_id = ? AND auth_user_id = ?", person.FamilyTreeID, userID).
+			Count(&linked).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if linked > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "You are already linked to a person in this tree"})
+			return
+		}
+		person.AuthUserID = userID
 	}
 
-	if result := h.DB.Create(&person); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	// Store the person and the submitted relationships together so a
+	// rejected edge leaves nothing behind
+	person.SearchText = services.PersonSearchText(&person)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&person).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPersonRevision(tx, nil, &person, c.GetString("userID"), models.RevisionCreate, ""); err != nil {
+			return err
+		}
+		return services.AddInitialRelationships(tx, &person)
+	})
+	if err != nil {
+		c.JSON(relationshipErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	services.LoadPersonRelationships(h.DB, &person)
 
 	// Invalidate cache
 	ctx := context.Background()
-	middleware.DeleteCache(ctx, personsCacheKey)
+	middleware.DeleteCache(ctx, personsCacheKey(person.FamilyTreeID))
 
-	c.JSON(http.StatusCreated, person)
+	h.respondPerson(c, http.StatusCreated, &person)
 }
 
 func (h *PersonHandler) UpdatePerson(c *gin.Context) {
 	id := c.Param("id")
 	var person models.Person
-	if result := h.DB.First(&person, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&person, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
 		return
 	}
@@ -109,57 +290,133 @@ func (h *PersonHandler) UpdatePerson(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !updateData.Privacy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "privacy must be members, public or private"})
+		return
+	}
+	updateData.FieldPrivacy = nil
+	services.PreserveHiddenFields(personViewer(c, h.DB), &person, &updateData)
 
-	// Update fields
+	// Update fields. Relationships are not stored on the person and are
+	// managed through the relationship endpoints.
 	updateData.ID = person.ID // Ensure ID doesn't change
+	updateData.FamilyTreeID = person.FamilyTreeID
 	updateData.UpdatedAt = time.Now()
 
-	if result := h.DB.Model(&person).Updates(updateData); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	// Only those who approve links can change authUserId
+	if !middleware.HasPermission(c, models.PermLinkApprove) {
+		updateData.AuthUserID = person.AuthUserID
+	}
+
+	if err := services.ResolveEventPlaces(h.DB, person.FamilyTreeID, updateData.LifeEvents); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.UpdatePerson(h.DB, &person, updateData, c.GetString("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Invalidate cache
 	ctx := context.Background()
-	middleware.DeleteCache(ctx, personsCacheKey)
+	middleware.DeleteCache(ctx, personsCacheKey(person.FamilyTreeID))
 
-	c.JSON(http.StatusOK, person)
+	services.LoadPersonRelationships(h.DB, &person)
+	h.respondPerson(c, http.StatusOK, &person)
 }
 
+// deleteOptions reads ?mode=detach|reassign|refuse and ?reassignTo=
+func deleteOptions(c *gin.Context) services.DeleteOptions {
+	return services.DeleteOptions{
+		Mode:       models.DeleteMode(c.Query("mode")),
+		ReassignTo: c.Query("reassignTo"),
+	}
+}
+
+// deletionErrorStatus maps deletion service errors to HTTP status codes
+func deletionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPersonReferenced), errors.Is(err, services.ErrNothingToRestore),
+		errors.Is(err, services.ErrRelationshipCycle):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidDeleteMode):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetDeletionPreview lists everything deleting a person would touch, for the
+// same mode and reassignTo as the delete
+func (h *PersonHandler) GetDeletionPreview(c *gin.Context) {
+	plan, err := services.PlanPersonDeletion(h.DB, middleware.FamilyTreeID(c), c.Param("id"), deleteOptions(c))
+	if err != nil {
+		c.JSON(deletionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	services.RedactPerson(personViewer(c, h.DB), &plan.Person)
+	c.JSON(http.StatusOK, plan)
+}
+
+// DeletePerson soft-deletes a person. By default every edge touching them is
+// detached; ?mode=reassign&reassignTo=ID gives their children to another
+// parent and ?mode=refuse only deletes a person nothing refers to.
 func (h *PersonHandler) DeletePerson(c *gin.Context) {
-	id := c.Param("id")
-	if result := h.DB.Delete(&models.Person{}, "id = ?", id); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	familyTreeID := middleware.FamilyTreeID(c)
+	deletion, plan, err := services.DeletePerson(h.DB, familyTreeID, c.Param("id"), deleteOptions(c), c.GetString("userID"))
+	if err != nil {
+		if errors.Is(err, services.ErrPersonReferenced) {
+			services.RedactPerson(personViewer(c, h.DB), &plan.Person)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "preview": plan})
+			return
+		}
+		c.JSON(deletionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	// Invalidate cache
 	ctx := context.Background()
-	middleware.DeleteCache(ctx, personsCacheKey)
+	middleware.DeleteCache(ctx, personsCacheKey(familyTreeID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Person deleted", "deletion": deletion})
+}
+
+// RestorePerson undoes the latest delete of a person, re-attaching the edges
+// and links it removed where the tree still allows
+func (h *PersonHandler) RestorePerson(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	result, err := services.RestorePerson(h.DB, familyTreeID, c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		c.JSON(deletionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
 
-	c.JSON(http.StatusOK, gin.H{"message": "Person deleted"})
+	services.LoadPersonRelationships(h.DB, result.Person)
+	services.RedactPerson(personViewer(c, h.DB), result.Person)
+	c.JSON(http.StatusOK, result)
 }
 
-// UpdatePersonWithPermission allows users to update only their own profile, or admin to update any
+// UpdatePersonWithPermission allows users to update only their own profile,
+// or anyone with person:edit to update any person in the tree
 func (h *PersonHandler) UpdatePersonWithPermission(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("userID")
-	isAdmin, _ := c.Get("isAdmin")
+	canEdit := middleware.HasPermission(c, models.PermPersonEdit)
 
 	var person models.Person
-	if result := h.DB.First(&person, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&person, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
 		return
 	}
 
-	// Check permission: user can only update their own linked profile, or be admin
-	isAdminBool, ok := isAdmin.(bool)
-	if !ok {
-		isAdminBool = false
-	}
-
-	if !isAdminBool && person.AuthUserID != userID.(string) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own profile"})
+	// Check permission: user can only update their own linked profile, or be an editor
+	if !canEdit && person.AuthUserID != userID.(string) {
+		middleware.Forbid(c, models.PermPersonEdit, "You can only edit your own profile")
 		return
 	}
 
@@ -168,26 +425,224 @@ func (h *PersonHandler) UpdatePersonWithPermission(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !updateData.Privacy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "privacy must be members, public or private"})
+		return
+	}
+	updateData.FieldPrivacy = nil
+	services.PreserveHiddenFields(personViewer(c, h.DB), &person, &updateData)
 
 	// Preserve certain fields
 	updateData.ID = person.ID
+	updateData.FamilyTreeID = person.FamilyTreeID
 	updateData.UpdatedAt = time.Now()
 
-	// Non-admins cannot change their authUserId (prevent unlinking)
-	if !isAdminBool {
+	if err := services.ResolveEventPlaces(h.DB, person.FamilyTreeID, updateData.LifeEvents); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only those who approve links can change authUserId (prevent unlinking)
+	if !middleware.HasPermission(c, models.PermLinkApprove) {
 		updateData.AuthUserID = person.AuthUserID
 	}
 
-	if result := h.DB.Model(&person).Updates(updateData); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	if err := services.UpdatePerson(h.DB, &person, updateData, userID.(string)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Invalidate cache
 	ctx := context.Background()
-	middleware.DeleteCache(ctx, personsCacheKey)
+	middleware.DeleteCache(ctx, personsCacheKey(person.FamilyTreeID))
+
+	services.LoadPersonRelationships(h.DB, &person)
+	h.respondPerson(c, http.StatusOK, &person)
+}
+
+type PrivacyRequest struct {
+	Privacy models.PersonPrivacy `json:"privacy"`
+	Fields  models.FieldPrivacy  `json:"fields"` // Replaces every field setting
+}
+
+// UpdatePrivacy lets the user linked to a person choose who sees the person
+// and each of their fields. Nobody else can, editors included.
+func (h *PersonHandler) UpdatePrivacy(c *gin.Context) {
+	var person models.Person
+	if result := h.DB.First(&person, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+	userID := c.GetString("userID")
+	if person.AuthUserID == "" || person.AuthUserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the person linked to this profile can change its privacy"})
+		return
+	}
+
+	var req PrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Privacy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "privacy must be members, public or private"})
+		return
+	}
+	if req.Fields == nil {
+		req.Fields = models.FieldPrivacy{}
+	}
+	if err := services.ValidateFieldPrivacy(req.Fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := models.Person{Privacy: req.Privacy, FieldPrivacy: req.Fields, UpdatedAt: time.Now()}
+	if err := services.UpdatePerson(h.DB, &person, update, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(person.FamilyTreeID))
 
-	// Fetch updated person
-	h.DB.First(&person, "id = ?", id)
+	services.LoadPersonRelationships(h.DB, &person)
+	h.respondPerson(c, http.StatusOK, &person)
+}
+
+// respondPerson writes a saved person. With ?validate=true the response is
+// {"person", "warnings"} listing the tree issues that involve the person;
+// they never block the save.
+func (h *PersonHandler) respondPerson(c *gin.Context, status int, person *models.Person) {
+	services.RedactPerson(personViewer(c, h.DB), person)
+	if c.Query("validate") != "true" {
+		c.JSON(status, person)
+		return
+	}
+
+	warnings := []services.Issue{}
+	if graph, err := services.LoadFamilyGraph(h.DB, person.FamilyTreeID); err == nil {
+		warnings = services.ValidatePerson(graph, person.ID)
+	}
+	c.JSON(status, gin.H{"person": person, "warnings": warnings})
+}
+
+// GetPersonHistory lists who changed a person and how, newest first
+func (h *PersonHandler) GetPersonHistory(c *gin.Context) {
+	revisions, err := services.PersonHistory(h.DB, middleware.FamilyTreeID(c), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Revisions carry old values, so they are as private as the person
+	var person models.Person
+	if err := h.DB.Unscoped().First(&person, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err == nil {
+		revisions = services.RedactRevisions(personViewer(c, h.DB), &person, revisions)
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RevertPersonRevision undoes one revision of a person. Fields edited again
+// since are a conflict unless ?force=true.
+func (h *PersonHandler) RevertPersonRevision(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	force := c.Query("force") == "true"
+
+	person, err := services.RevertPersonRevision(h.DB, familyTreeID, c.Param("id"), c.Param("revisionId"), c.GetString("userID"), force)
+	if err != nil {
+		c.JSON(revisionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+
+	services.LoadPersonRelationships(h.DB, person)
+	services.RedactPerson(personViewer(c, h.DB), person)
 	c.JSON(http.StatusOK, person)
 }
+
+// revisionErrorStatus maps revision service errors to HTTP status codes
+func revisionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRevisionNotFound), errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRevisionConflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRevisionNotRevertible):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type MergePersonsRequest struct {
+	DuplicateID string   `json:"duplicateId" binding:"required"`
+	Take        []string `json:"take"` // Fields to take from the duplicate instead of keeping
+}
+
+// GetDuplicates lists pairs of persons in the tree that may be the same
+// individual, best matches first
+func (h *PersonHandler) GetDuplicates(c *gin.Context) {
+	minScore := services.DefaultDuplicateScore
+	if v, err := strconv.ParseFloat(c.Query("minScore"), 64); err == nil && v > 0 && v <= 1 {
+		minScore = v
+	}
+	limit := 50
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	graph, err := services.LoadFamilyGraph(h.DB, middleware.FamilyTreeID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	candidates := services.FindDuplicates(graph, minScore)
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	viewer := personViewer(c, h.DB)
+	for i := range candidates {
+		services.RedactPerson(viewer, &candidates[i].Person)
+		services.RedactPerson(viewer, &candidates[i].Other)
+	}
+	c.JSON(http.StatusOK, candidates)
+}
+
+// MergePersons folds a duplicate into the person in the URL. Relationships,
+// link requests, proposals and invitations move to the kept person and the
+// duplicate is deleted.
+func (h *PersonHandler) MergePersons(c *gin.Context) {
+	var req MergePersonsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	familyTreeID := middleware.FamilyTreeID(c)
+	person, err := services.MergePersons(h.DB, familyTreeID, c.Param("id"), req.DuplicateID, req.Take, c.GetString("userID"))
+	if err != nil {
+		c.JSON(mergeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+
+	services.LoadPersonRelationships(h.DB, person)
+	services.RedactPerson(personViewer(c, h.DB), person)
+	c.JSON(http.StatusOK, person)
+}
+
+// mergeErrorStatus maps merge errors to HTTP status codes
+func mergeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrMergeLinkedPersons), errors.Is(err, services.ErrRelationshipCycle):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrMergeSamePerson), errors.Is(err, services.ErrUnknownField):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"family-tree-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreatePersonLinking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testDB(t, &models.Person{}, &models.PersonRevision{}, &models.Relationship{}, &models.Citation{}, &models.Place{})
+	h := &PersonHandler{DB: db}
+	router := gin.New()
+	router.POST("/persons", func(c *gin.Context) {
+		c.Set("userID", "admin-1")
+		c.Set("familyTreeID", "tree-1")
+		h.CreatePerson(c)
+	})
+	create := func(query string, body map[string]interface{}) (int, models.Person) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/persons"+query, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		var person models.Person
+		json.Unmarshal(w.Body.Bytes(), &person)
+		return w.Code, person
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		body     map[string]interface{}
+		wantCode int
+		wantLink string
+	}{
+		{"unlinked by default", "", map[string]interface{}{"firstName": "Hind"}, http.StatusCreated, ""},
+		{"link in body ignored", "", map[string]interface{}{"firstName": "Zaid", "authUserId": "user-2"}, http.StatusCreated, ""},
+		{"own profile", "?linkToMe=true", map[string]interface{}{"firstName": "Admin"}, http.StatusCreated, "admin-1"},
+		{"second own profile", "?linkToMe=true", map[string]interface{}{"firstName": "Admin"}, http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		code, person := create(tt.query, tt.body)
+		if code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.wantCode)
+			continue
+		}
+		if code != http.StatusCreated {
+			continue
+		}
+		var stored models.Person
+		if err := db.First(&stored, "id = ?", person.ID).Error; err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if stored.AuthUserID != tt.wantLink {
+			t.Errorf("%s: authUserId = %q, want %q", tt.name, stored.AuthUserID, tt.wantLink)
+		}
+	}
+}
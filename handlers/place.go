@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"family-tree-backend/geocode"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PlaceHandler manages a tree's places. Geocoder may be nil, in which case
+// new places are only matched by name.
+type PlaceHandler struct {
+	DB       *gorm.DB
+	Geocoder geocode.Geocoder
+}
+
+type PlaceRequest struct {
+	Query          string           `json:"query"` // Free text to resolve, e.g. "Nablus, Palestine"; the other fields are then ignored
+	Name           string           `json:"name"`
+	Type           models.PlaceType `json:"type"`
+	ParentID       string           `json:"parentId"`
+	AlternateNames []string         `json:"alternateNames"`
+	Latitude       *float64         `json:"latitude"`
+	Longitude      *float64         `json:"longitude"`
+}
+
+// PlaceView is a place with where it sits in the hierarchy
+type PlaceView struct {
+	models.Place
+	FullName string          `json:"fullName"`
+	Path     []*models.Place `json:"path,omitempty"` // Enclosing places, innermost first
+	Children []*models.Place `json:"children,omitempty"`
+}
+
+// placeErrorStatus maps place service errors to HTTP status codes
+func placeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPlaceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPlace):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPlaceInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrNoGeocoder):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetPlaces lists the tree's places by full name; ?q= matches the start of
+// any of a place's names
+func (h *PlaceHandler) GetPlaces(c *gin.Context) {
+	idx, err := services.LoadPlaceIndex(h.DB, middleware.FamilyTreeID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch places"})
+		return
+	}
+
+	var places []*models.Place
+	if q := c.Query("q"); q != "" {
+		places = idx.Search(q)
+	} else {
+		for _, p := range idx.Places {
+			places = append(places, p)
+		}
+	}
+
+	views := make([]PlaceView, 0, len(places))
+	for _, p := range places {
+		views = append(views, PlaceView{Place: *p, FullName: idx.FullName(p.ID)})
+	}
+	sort.SliceStable(views, func(i, j int) bool { return views[i].FullName < views[j].FullName })
+	c.JSON(http.StatusOK, views)
+}
+
+// GetPlace returns a place with the places enclosing it and inside it
+func (h *PlaceHandler) GetPlace(c *gin.Context) {
+	idx, err := services.LoadPlaceIndex(h.DB, middleware.FamilyTreeID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch places"})
+		return
+	}
+	place, ok := idx.Places[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Place not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PlaceView{
+		Place:    *place,
+		FullName: idx.FullName(place.ID),
+		Path:     idx.Path(place.ID)[1:],
+		Children: idx.Children(place.ID),
+	})
+}
+
+// GetPlacePersons lists the life events at a place or inside it. ?event=
+// keeps one kind, e.g. ?event=Birth for everyone born there.
+func (h *PlaceHandler) GetPlacePersons(c *gin.Context) {
+	visits, err := services.PersonsAtPlace(h.DB, personViewer(c, h.DB), middleware.FamilyTreeID(c), c.Param("id"), c.Query("event"))
+	if err != nil {
+		c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, visits)
+}
+
+// GetPersonPlaces lists the places of a person's life in date order with
+// coordinates, for a migration map
+func (h *PlaceHandler) GetPersonPlaces(c *gin.Context) {
+	var person models.Person
+	if err := h.DB.First(&person, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+	services.RedactPerson(personViewer(c, h.DB), &person)
+
+	visits, err := services.PersonPlaces(h.DB, &person)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, visits)
+}
+
+// Geocode returns the geocoder's candidates for ?q= without saving anything
+func (h *PlaceHandler) Geocode(c *gin.Context) {
+	if h.Geocoder == nil {
+		c.JSON(placeErrorStatus(services.ErrNoGeocoder), gin.H{"error": services.ErrNoGeocoder.Error()})
+		return
+	}
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	results, err := h.Geocoder.Geocode(context.Background(), q)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if results == nil {
+		results = []geocode.Result{}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// CreatePlace adds a place. With "query" the text is resolved instead: an
+// existing place is returned, or the place and its enclosing places are
+// created, geocoded when possible.
+func (h *PlaceHandler) CreatePlace(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+
+	var req PlaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var place *models.Place
+	if req.Query != "" {
+		resolved, err := services.ResolvePlace(h.DB, h.Geocoder, familyTreeID, req.Query)
+		if err != nil {
+			c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		place = resolved
+	} else {
+		place = &models.Place{
+			ID:           uuid.New().String(),
+			FamilyTreeID: familyTreeID,
+			CreatedAt:    time.Now(),
+		}
+		if err := h.applyPlaceRequest(place, req); err != nil {
+			c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.DB.Create(place).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create place"})
+			return
+		}
+	}
+
+	idx, _ := services.LoadPlaceIndex(h.DB, familyTreeID)
+	c.JSON(http.StatusCreated, PlaceView{Place: *place, FullName: idx.FullName(place.ID)})
+}
+
+// UpdatePlace replaces a place's name, type, parent, alternate names and
+// coordinates
+func (h *PlaceHandler) UpdatePlace(c *gin.Context) {
+	var place models.Place
+	if err := h.DB.First(&place, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Place not found"})
+		return
+	}
+
+	var req PlaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.applyPlaceRequest(&place, req); err != nil {
+		c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Save(&place).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update place"})
+		return
+	}
+	c.JSON(http.StatusOK, place)
+}
+
+// applyPlaceRequest copies the editable fields after checking them
+func (h *PlaceHandler) applyPlaceRequest(place *models.Place, req PlaceRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("%w: name is required", services.ErrInvalidPlace)
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude go together", services.ErrInvalidPlace)
+	}
+	if err := services.ValidatePlaceParent(h.DB, place.FamilyTreeID, place.ID, req.ParentID); err != nil {
+		return err
+	}
+
+	switch req.Type {
+	case "":
+		req.Type = models.PlaceOther
+	case models.PlaceCountry, models.PlaceRegion, models.PlaceCity, models.PlaceOther:
+	default:
+		return fmt.Errorf("%w: unknown type %q", services.ErrInvalidPlace, req.Type)
+	}
+
+	place.Name = strings.TrimSpace(req.Name)
+	place.Type = req.Type
+	place.ParentID = req.ParentID
+	place.AlternateNames = models.JSONStringArray(append([]string{}, req.AlternateNames...))
+	place.Latitude, place.Longitude = req.Latitude, req.Longitude
+	place.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeletePlace removes a place nothing refers to
+func (h *PlaceHandler) DeletePlace(c *gin.Context) {
+	if err := services.DeletePlace(h.DB, middleware.FamilyTreeID(c), c.Param("id")); err != nil {
+		c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Place deleted"})
+}
+
+// LinkPlaces links every free-text location in the tree to a place,
+// creating the places that are missing
+func (h *PlaceHandler) LinkPlaces(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	result, err := services.LinkTreePlaces(h.DB, h.Geocoder, familyTreeID, c.GetString("userID"))
+	if err != nil {
+		c.JSON(placeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+	c.JSON(http.StatusOK, result)
+}
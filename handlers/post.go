@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
 	"family-tree-backend/services"
 	"net/http"
 	"regexp"
@@ -17,13 +19,33 @@ type PostHandler struct {
 	NotificationService *services.NotificationService
 }
 
+var postListSpec = pagination.Spec{
+	Sorts:       map[string]string{"createdAt": "created_at", "updatedAt": "updated_at"},
+	DefaultSort: "-createdAt",
+	TimeColumn:  "created_at",
+	Filters:     map[string]string{"userId": "user_id"},
+}
+
+var commentListSpec = pagination.Spec{
+	Sorts:       map[string]string{"createdAt": "created_at"},
+	DefaultSort: "createdAt",
+	TimeColumn:  "created_at",
+	Filters:     map[string]string{"userId": "user_id"},
+}
+
 func (h *PostHandler) GetPosts(c *gin.Context) {
-	var posts []models.Post
-	if result := h.DB.Order("created_at desc").Find(&posts); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	params, err := pagination.Parse(c, postListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, posts)
+	page, err := pagination.Find(h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c)), params,
+		func(p models.Post) string { return p.ID })
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *PostHandler) CreatePost(c *gin.Context) {
@@ -33,7 +55,15 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		return
 	}
 
+	// Posts are always by the caller
+	user := c.MustGet("user").(models.User)
+	post.UserID = user.ID
+	if post.UserName == "" {
+		post.UserName = user.Name
+	}
+
 	post.ID = uuid.New().String()
+	post.FamilyTreeID = middleware.FamilyTreeID(c)
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = time.Now()
 
@@ -42,17 +72,16 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		return
 	}
 
-	// Send notification to all users about new post
+	// Send notification to the tree's members about new post
 	if h.NotificationService != nil {
 		go func() {
-			var users []models.User
-			h.DB.Find(&users)
+			memberIDs, _ := services.TreeMemberIDs(h.DB, post.FamilyTreeID)
 
 			var userIDs []string
-			for _, user := range users {
+			for _, memberID := range memberIDs {
 				// Don't notify the post author
-				if user.ID != post.UserID {
-					userIDs = append(userIDs, user.ID)
+				if memberID != post.UserID {
+					userIDs = append(userIDs, memberID)
 				}
 			}
 
@@ -80,10 +109,14 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 	}
 
 	var post models.Post
-	if result := h.DB.First(&post, "id = ?", id); result.Error != nil {
+	if result := h.DB.First(&post, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
+	if post.UserID != c.GetString("userID") && !middleware.HasPermission(c, models.PermPostManage) {
+		middleware.Forbid(c, models.PermPostManage, "Not authorized to edit this post")
+		return
+	}
 
 	post.Content = req.Content
 	post.Photos = req.Photos
@@ -101,27 +134,62 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 
 func (h *PostHandler) DeletePost(c *gin.Context) {
 	id := c.Param("id")
-	if result := h.DB.Delete(&models.Post{}, "id = ?", id); result.Error != nil {
+
+	var post models.Post
+	if result := h.DB.First(&post, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if post.UserID != c.GetString("userID") && !middleware.HasPermission(c, models.PermPostManage) {
+		middleware.Forbid(c, models.PermPostManage, "Not authorized to delete this post")
+		return
+	}
+
+	if result := h.DB.Delete(&post); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted"})
 }
 
+// postInTree checks that a post belongs to the tree the request acts on
+func (h *PostHandler) postInTree(c *gin.Context, postID string) bool {
+	var count int64
+	h.DB.Model(&models.Post{}).Where("id = ? AND family_tree_id = ?", postID, middleware.FamilyTreeID(c)).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return false
+	}
+	return true
+}
+
 // ===== COMMENTS =====
 
 func (h *PostHandler) GetComments(c *gin.Context) {
 	postID := c.Param("id")
-	var comments []models.Comment
-	if result := h.DB.Where("post_id = ?", postID).Order("created_at asc").Find(&comments); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	if !h.postInTree(c, postID) {
 		return
 	}
-	c.JSON(http.StatusOK, comments)
+
+	params, err := pagination.Parse(c, commentListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := pagination.Find(h.DB.Where("post_id = ?", postID), params,
+		func(comment models.Comment) string { return comment.ID })
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *PostHandler) CreateComment(c *gin.Context) {
 	postID := c.Param("id")
+	if !h.postInTree(c, postID) {
+		return
+	}
 
 	var comment models.Comment
 	if err := c.ShouldBindJSON(&comment); err != nil {
@@ -166,7 +234,9 @@ func (h *PostHandler) CreateComment(c *gin.Context) {
 				if len(mention) > 1 {
 					userName := mention[1]
 					var user models.User
-					if h.DB.Where("name = ?", userName).First(&user).Error == nil {
+					if h.DB.Where("name = ? AND id IN (?)", userName,
+						h.DB.Model(&models.TreeMembership{}).Select("user_id").Where("family_tree_id = ?", post.FamilyTreeID),
+					).First(&user).Error == nil {
 						// Don't notify if they're the commenter or already notified as post author
 						if user.ID != comment.UserID && user.ID != post.UserID {
 							h.NotificationService.SendNotification(
@@ -188,9 +258,24 @@ func (h *PostHandler) CreateComment(c *gin.Context) {
 	c.JSON(http.StatusCreated, comment)
 }
 
+// DeleteComment lets authors remove their comments and post:manage holders
+// remove any comment
 func (h *PostHandler) DeleteComment(c *gin.Context) {
 	id := c.Param("id")
-	if result := h.DB.Delete(&models.Comment{}, "id = ?", id); result.Error != nil {
+
+	var comment models.Comment
+	if result := h.DB.Where("post_id IN (?)",
+		h.DB.Model(&models.Post{}).Select("id").Where("family_tree_id = ?", middleware.FamilyTreeID(c)),
+	).First(&comment, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if comment.UserID != c.GetString("userID") && !middleware.HasPermission(c, models.PermPostManage) {
+		middleware.Forbid(c, models.PermPostManage, "Not authorized to delete this comment")
+		return
+	}
+
+	if result := h.DB.Delete(&comment); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
@@ -201,6 +286,9 @@ func (h *PostHandler) DeleteComment(c *gin.Context) {
 
 func (h *PostHandler) ToggleReaction(c *gin.Context) {
 	postID := c.Param("id")
+	if !h.postInTree(c, postID) {
+		return
+	}
 
 	var req struct {
 		Emoji  string `json:"emoji"`
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RelationshipHandler struct {
+	DB *gorm.DB
+}
+
+type CreateRelationshipRequest struct {
+	PersonID        string                  `json:"personId" binding:"required"`
+	RelatedPersonID string                  `json:"relatedPersonId" binding:"required"`
+	Type            models.RelationshipType `json:"type" binding:"required"`
+	Qualifier       string                  `json:"qualifier"`
+	StartDate       *time.Time              `json:"startDate"`
+	EndDate         *time.Time              `json:"endDate"`
+}
+
+type UpdateRelationshipRequest struct {
+	Qualifier *string      `json:"qualifier"`
+	StartDate optionalTime `json:"startDate"`
+	EndDate   optionalTime `json:"endDate"`
+}
+
+// optionalTime tells a date left out of a request from one set to null,
+// so a partial update only clears the dates it names
+type optionalTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (o *optionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// relationshipErrorStatus maps relationship service errors to HTTP status codes
+func relationshipErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPersonNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRelationshipExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidRelationship), errors.Is(err, services.ErrRelationshipCycle):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetPersonRelationships returns every edge touching a person
+func (h *RelationshipHandler) GetPersonRelationships(c *gin.Context) {
+	id := c.Param("id")
+
+	var edges []models.Relationship
+	if err := h.DB.Where("family_tree_id = ? AND (person_id = ? OR related_person_id = ?)", middleware.FamilyTreeID(c), id, id).Find(&edges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, edges)
+}
+
+// CreateRelationship adds an edge between two persons (Admin only)
+func (h *RelationshipHandler) CreateRelationship(c *gin.Context) {
+	var req CreateRelationshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Both persons must be in the tree the request acts on
+	familyTreeID := middleware.FamilyTreeID(c)
+	var count int64
+	h.DB.Model(&models.Person{}).Where("id IN ? AND family_tree_id = ?", []string{req.PersonID, req.RelatedPersonID}, familyTreeID).Count(&count)
+	if count != 2 && req.PersonID != req.RelatedPersonID {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrPersonNotFound.Error()})
+		return
+	}
+
+	rel := models.Relationship{
+		PersonID:        req.PersonID,
+		RelatedPersonID: req.RelatedPersonID,
+		Type:            req.Type,
+		Qualifier:       req.Qualifier,
+		StartDate:       req.StartDate,
+		EndDate:         req.EndDate,
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return services.AddRelationship(tx, &rel)
+	})
+	if err != nil {
+		c.JSON(relationshipErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(middleware.FamilyTreeID(c)))
+
+	c.JSON(http.StatusCreated, rel)
+}
+
+// UpdateRelationship changes the qualifier or dates of an edge (Admin only)
+func (h *RelationshipHandler) UpdateRelationship(c *gin.Context) {
+	id := c.Param("id")
+
+	var req UpdateRelationshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rel models.Relationship
+	if err := h.DB.First(&rel, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+
+	if req.Qualifier != nil {
+		if err := services.ValidateQualifier(rel.Type, *req.Qualifier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rel.Qualifier = *req.Qualifier
+	}
+	if req.StartDate.Set || req.EndDate.Set {
+		switch rel.Type {
+		case models.RelationshipParentChild:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only spouse relationships have dates"})
+			return
+		case models.RelationshipSpouse:
+			if req.StartDate.Set {
+				rel.StartDate = req.StartDate.Value
+			}
+			if req.EndDate.Set {
+				rel.EndDate = req.EndDate.Value
+			}
+		}
+	}
+	rel.UpdatedAt = time.Now()
+
+	if err := h.DB.Save(&rel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(middleware.FamilyTreeID(c)))
+
+	c.JSON(http.StatusOK, rel)
+}
+
+// DeleteRelationship removes an edge, which updates both persons at once (Admin only)
+func (h *RelationshipHandler) DeleteRelationship(c *gin.Context) {
+	id := c.Param("id")
+
+	result := h.DB.Delete(&models.Relationship{}, "id = ? AND family_tree_id = ?", id, middleware.FamilyTreeID(c))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+
+	middleware.DeleteCache(context.Background(), personsCacheKey(middleware.FamilyTreeID(c)))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Relationship deleted"})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleHandler struct {
+	DB *gorm.DB
+}
+
+type CreateRoleRequest struct {
+	Name        models.TreeRole     `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string             `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// roleErrorStatus maps role service errors to HTTP status codes
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidRoleName), errors.Is(err, services.ErrInvalidPermission),
+		errors.Is(err, services.ErrBuiltInRole):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetMyPermissions returns the caller's role and permissions in the current
+// tree so clients can hide what they can't do
+func (h *RoleHandler) GetMyPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"familyTreeId": middleware.FamilyTreeID(c),
+		"role":         middleware.CurrentTreeRole(c),
+		"permissions":  middleware.Permissions(c).List(),
+	})
+}
+
+// GetPermissions lists every permission a tree role can grant
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.TreePermissions)
+}
+
+// GetRoles lists the built-in roles and the current tree's custom roles
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	roles, err := services.TreeRoles(h.DB, middleware.FamilyTreeID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole defines a custom role. Callers can't grant permissions they
+// don't hold themselves.
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !middleware.Permissions(c).Covers(models.NewPermissionSet(req.Permissions...)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't grant permissions you don't have"})
+		return
+	}
+
+	role := models.Role{
+		FamilyTreeID: middleware.FamilyTreeID(c),
+		Name:         req.Name,
+		Description:  req.Description,
+		CreatedBy:    c.GetString("userID"),
+	}
+	if err := services.CreateRole(h.DB, &role, req.Permissions); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole changes a custom role's description or permissions
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := services.FindRole(h.DB, middleware.FamilyTreeID(c), models.TreeRole(c.Param("name")))
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	perms := middleware.Permissions(c)
+	if !perms.Covers(role.PermissionSet()) || !perms.Covers(models.NewPermissionSet(req.Permissions...)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't change a role with permissions you don't have"})
+		return
+	}
+
+	if err := services.UpdateRole(h.DB, role, req.Description, req.Permissions); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a custom role that no member or open invitation uses
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	role, err := services.FindRole(h.DB, middleware.FamilyTreeID(c), models.TreeRole(c.Param("name")))
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !middleware.Permissions(c).Covers(role.PermissionSet()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't delete a role with permissions you don't have"})
+		return
+	}
+
+	if err := services.DeleteRole(h.DB, role); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
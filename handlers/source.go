@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SourceHandler manages the sources of a tree and the citations that tie
+// them to facts
+type SourceHandler struct {
+	DB *gorm.DB
+}
+
+type SourceRequest struct {
+	Title      string `json:"title" binding:"required"`
+	Author     string `json:"author"`
+	Repository string `json:"repository"`
+	URL        string `json:"url"`
+}
+
+type CitationRequest struct {
+	SourceID       string                    `json:"sourceId" binding:"required"`
+	Fact           models.CitationFact       `json:"fact" binding:"required"`
+	PersonID       string                    `json:"personId"`
+	LifeEventID    string                    `json:"lifeEventId"`
+	RelationshipID string                    `json:"relationshipId"`
+	Page           string                    `json:"page"`
+	Confidence     models.CitationConfidence `json:"confidence"`
+	Note           string                    `json:"note"`
+}
+
+// sourceErrorStatus maps source and citation service errors to HTTP status
+// codes
+func sourceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSourceNotFound), errors.Is(err, services.ErrCitationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCitation):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSourceCited):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// invalidatePersons drops the cached person list, which embeds citations
+func invalidatePersons(familyTreeID string) {
+	middleware.DeleteCache(context.Background(), personsCacheKey(familyTreeID))
+}
+
+// GetSources lists the tree's sources by title; ?q= matches part of the
+// title or author
+func (h *SourceHandler) GetSources(c *gin.Context) {
+	query := h.DB.Where("family_tree_id = ?", middleware.FamilyTreeID(c))
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(title) LIKE ? OR LOWER(author) LIKE ?", like, like)
+	}
+
+	sources := []models.Source{}
+	if err := query.Order("title").Find(&sources).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sources"})
+		return
+	}
+	c.JSON(http.StatusOK, sources)
+}
+
+// GetSource returns a source with everything it is cited for
+func (h *SourceHandler) GetSource(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	var source models.Source
+	if err := h.DB.First(&source, "id = ? AND family_tree_id = ?", c.Param("id"), familyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+
+	citations, err := services.SourceCitations(h.DB, familyTreeID, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch citations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"source": source, "citations": citations})
+}
+
+func (h *SourceHandler) CreateSource(c *gin.Context) {
+	var req SourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source := models.Source{
+		ID:           uuid.New().String(),
+		FamilyTreeID: middleware.FamilyTreeID(c),
+		Title:        req.Title,
+		Author:       req.Author,
+		Repository:   req.Repository,
+		URL:          req.URL,
+		CreatedBy:    c.GetString("userID"),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := h.DB.Create(&source).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create source"})
+		return
+	}
+	c.JSON(http.StatusCreated, source)
+}
+
+func (h *SourceHandler) UpdateSource(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	var source models.Source
+	if err := h.DB.First(&source, "id = ? AND family_tree_id = ?", c.Param("id"), familyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+
+	var req SourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source.Title = req.Title
+	source.Author = req.Author
+	source.Repository = req.Repository
+	source.URL = req.URL
+	source.UpdatedAt = time.Now()
+	if err := h.DB.Save(&source).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update source"})
+		return
+	}
+
+	invalidatePersons(familyTreeID)
+	c.JSON(http.StatusOK, source)
+}
+
+// DeleteSource removes a source; a cited one needs ?force=true, which
+// removes its citations as well
+func (h *SourceHandler) DeleteSource(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	if err := services.DeleteSource(h.DB, familyTreeID, c.Param("id"), c.Query("force") == "true"); err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	invalidatePersons(familyTreeID)
+	c.JSON(http.StatusOK, gin.H{"message": "Source deleted"})
+}
+
+// UploadSourceDocument stores a scan of the source, replacing any earlier one
+func (h *SourceHandler) UploadSourceDocument(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	var source models.Source
+	if err := h.DB.First(&source, "id = ? AND family_tree_id = ?", c.Param("id"), familyTreeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	filename := fmt.Sprintf("source-%d%s", time.Now().UnixNano(), filepath.Ext(file.Filename))
+	if err := c.SaveUploadedFile(file, filepath.Join("uploads", filename)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	source.DocumentURL = "/uploads/" + filename
+	source.UpdatedAt = time.Now()
+	if err := h.DB.Save(&source).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update source"})
+		return
+	}
+
+	invalidatePersons(familyTreeID)
+	c.JSON(http.StatusOK, source)
+}
+
+// GetPersonCitations lists the citations for a person's facts and edges
+func (h *SourceHandler) GetPersonCitations(c *gin.Context) {
+	var person models.Person
+	if err := h.DB.First(&person, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return
+	}
+	if err := services.LoadPersonCitations(h.DB, &person); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.RedactPerson(personViewer(c, h.DB), &person)
+
+	citations := person.Citations
+	if citations == nil {
+		citations = []models.Citation{}
+	}
+	c.JSON(http.StatusOK, citations)
+}
+
+func (h *SourceHandler) CreateCitation(c *gin.Context) {
+	var req CitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	citation := models.Citation{
+		ID:           uuid.New().String(),
+		FamilyTreeID: middleware.FamilyTreeID(c),
+		CreatedBy:    c.GetString("userID"),
+		CreatedAt:    time.Now(),
+	}
+	applyCitationRequest(&citation, req)
+	if err := services.ValidateCitation(h.DB, &citation); err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Create(&citation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create citation"})
+		return
+	}
+
+	invalidatePersons(citation.FamilyTreeID)
+	c.JSON(http.StatusCreated, citation)
+}
+
+func (h *SourceHandler) UpdateCitation(c *gin.Context) {
+	var citation models.Citation
+	if err := h.DB.First(&citation, "id = ? AND family_tree_id = ?", c.Param("id"), middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Citation not found"})
+		return
+	}
+
+	var req CitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applyCitationRequest(&citation, req)
+	if err := services.ValidateCitation(h.DB, &citation); err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Save(&citation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update citation"})
+		return
+	}
+
+	invalidatePersons(citation.FamilyTreeID)
+	c.JSON(http.StatusOK, citation)
+}
+
+func applyCitationRequest(citation *models.Citation, req CitationRequest) {
+	citation.SourceID = req.SourceID
+	citation.Fact = req.Fact
+	citation.PersonID = req.PersonID
+	citation.LifeEventID = req.LifeEventID
+	citation.RelationshipID = req.RelationshipID
+	citation.Page = req.Page
+	citation.Confidence = req.Confidence
+	citation.Note = req.Note
+	citation.UpdatedAt = time.Now()
+}
+
+func (h *SourceHandler) DeleteCitation(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	result := h.DB.Where("id = ? AND family_tree_id = ?", c.Param("id"), familyTreeID).Delete(&models.Citation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete citation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Citation not found"})
+		return
+	}
+
+	invalidatePersons(familyTreeID)
+	c.JSON(http.StatusOK, gin.H{"message": "Citation deleted"})
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"family-tree-backend/chart"
+	"family-tree-backend/middleware"
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TreeHandler struct {
+	DB *gorm.DB
+}
+
+const defaultTraversalDepth = 4
+
+// loadGraphFor finds a person and loads the graph of their family tree
+func (h *TreeHandler) loadGraphFor(c *gin.Context, personID string) (*services.FamilyGraph, bool) {
+	var person models.Person
+	if err := h.DB.First(&person, "id = ? AND family_tree_id = ?", personID, middleware.FamilyTreeID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
+		return nil, false
+	}
+
+	graph, err := services.LoadFamilyGraph(h.DB, person.FamilyTreeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	viewer := personViewer(c, h.DB)
+	for _, p := range graph.Persons {
+		services.RedactPerson(viewer, p)
+	}
+	return graph, true
+}
+
+// parseDepth reads the depth query parameter and enforces the max-depth guard
+func parseDepth(c *gin.Context) (int, error) {
+	raw := c.Query("depth")
+	if raw == "" {
+		return defaultTraversalDepth, nil
+	}
+	depth, err := strconv.Atoi(raw)
+	if err != nil || depth < 1 || depth > services.MaxTraversalDepth {
+		return 0, fmt.Errorf("depth must be between 1 and %d", services.MaxTraversalDepth)
+	}
+	return depth, nil
+}
+
+// GetAncestors returns a person's ancestors as a nested tree, or as a flat
+// list with generation numbers when format=flat
+func (h *TreeHandler) GetAncestors(c *gin.Context) {
+	h.traverse(c, true)
+}
+
+// GetDescendants returns a person's descendants as a nested tree, or as a
+// flat list with generation numbers when format=flat
+func (h *TreeHandler) GetDescendants(c *gin.Context) {
+	h.traverse(c, false)
+}
+
+func (h *TreeHandler) traverse(c *gin.Context, up bool) {
+	id := c.Param("id")
+
+	depth, err := parseDepth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	graph, ok := h.loadGraphFor(c, id)
+	if !ok {
+		return
+	}
+
+	if c.DefaultQuery("format", "tree") == "flat" {
+		var entries []services.GenerationEntry
+		if up {
+			entries = graph.Ancestors(id, depth)
+		} else {
+			entries = graph.Descendants(id, depth)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"rootId":  id,
+			"depth":   depth,
+			"persons": entries,
+		})
+		return
+	}
+
+	var tree *services.TreeNode
+	if up {
+		tree = graph.AncestorTree(id, depth)
+	} else {
+		tree = graph.DescendantTree(id, depth)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rootId": id,
+		"depth":  depth,
+		"tree":   tree,
+	})
+}
+
+// chartFormats maps the chart formats to their content types
+var chartFormats = map[string]string{
+	"svg": "image/svg+xml",
+	"png": "image/png",
+	"pdf": "application/pdf",
+}
+
+// GetChart renders a printable pedigree or descendant chart of a person as
+// SVG, PNG or a PDF spread over as many sheets as it needs
+func (h *TreeHandler) GetChart(c *gin.Context) {
+	id := c.Param("id")
+
+	depth, err := parseDepth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind := chart.Kind(c.DefaultQuery("type", string(chart.Pedigree)))
+	if kind != chart.Pedigree && kind != chart.Descendant {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be pedigree or descendant"})
+		return
+	}
+	orientation := chart.Orientation(c.DefaultQuery("orientation", string(chart.Vertical)))
+	if orientation != chart.Vertical && orientation != chart.Horizontal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "orientation must be vertical or horizontal"})
+		return
+	}
+	format := c.DefaultQuery("format", "svg")
+	contentType, ok := chartFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be svg, png or pdf"})
+		return
+	}
+	paper, ok := chart.Papers[c.DefaultQuery("paper", "a4")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paper must be a4, a3 or letter"})
+		return
+	}
+	photos, dates := c.Query("photos") == "true", c.Query("dates") != "false"
+
+	collapsed := map[string]bool{}
+	for _, collapsedID := range strings.Split(c.Query("collapse"), ",") {
+		if collapsedID = strings.TrimSpace(collapsedID); collapsedID != "" {
+			collapsed[collapsedID] = true
+		}
+	}
+
+	graph, ok := h.loadGraphFor(c, id)
+	if !ok {
+		return
+	}
+	root := graph.BuildChart(id, services.ChartOptions{
+		Kind:      kind,
+		Depth:     depth,
+		Photos:    photos,
+		Dates:     dates,
+		Collapsed: collapsed,
+	})
+	layout := chart.Layout(root, chart.Options{Kind: kind, Orientation: orientation, Photos: photos})
+
+	var out bytes.Buffer
+	switch format {
+	case "svg":
+		err = chart.SVG(&out, layout)
+	case "png":
+		err = chart.PNG(&out, layout, chart.PNGScale)
+	case "pdf":
+		err = chart.PDF(&out, layout, paper)
+	}
+	if errors.Is(err, chart.ErrTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%s.%s"`, kind, id, format))
+	c.Data(http.StatusOK, contentType, out.Bytes())
+}
+
+// requestLanguage picks the label language from ?lang= or Accept-Language
+func requestLanguage(c *gin.Context) string {
+	lang := c.Query("lang")
+	if lang == "" {
+		lang = c.GetHeader("Accept-Language")
+	}
+	if strings.HasPrefix(strings.ToLower(lang), services.LangArabic) {
+		return services.LangArabic
+	}
+	return services.LangEnglish
+}
+
+// GetRelationshipTo explains how otherId is related to id, with a localized
+// label and the path of person IDs through the common ancestor
+func (h *TreeHandler) GetRelationshipTo(c *gin.Context) {
+	id := c.Param("id")
+	otherID := c.Param("otherId")
+
+	graph, ok := h.loadGraphFor(c, id)
+	if !ok {
+		return
+	}
+	if _, found := graph.Persons[otherID]; !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Other person not found in this family tree"})
+		return
+	}
+
+	lang := requestLanguage(c)
+	kinship := graph.Kinship(id, otherID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"personId":      id,
+		"otherPersonId": otherID,
+		"label":         services.KinshipLabel(kinship, lang),
+		"labels":        services.KinshipLabels(kinship),
+		"lang":          lang,
+		"kinship":       kinship,
+	})
+}
+
+// GetIssues checks the whole tree for impossible or unlikely data, such as
+// children born before their parents or edges to deleted persons. Filter
+// with ?severity=error|warning and ?rule=.
+func (h *TreeHandler) GetIssues(c *gin.Context) {
+	familyTreeID := middleware.FamilyTreeID(c)
+	issues, err := services.ValidateTree(h.DB, familyTreeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	severity, rule := c.Query("severity"), c.Query("rule")
+	counts := map[services.IssueSeverity]int{services.SeverityError: 0, services.SeverityWarning: 0}
+	filtered := make([]services.Issue, 0, len(issues))
+	for _, issue := range issues {
+		counts[issue.Severity]++
+		if (severity == "" || string(issue.Severity) == severity) && (rule == "" || issue.Rule == rule) {
+			filtered = append(filtered, issue)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"familyTreeId": familyTreeID,
+		"counts":       counts,
+		"issues":       filtered,
+	})
+}
@@ -5,10 +5,15 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"family-tree-backend/auth"
+	"family-tree-backend/geocode"
 	"family-tree-backend/handlers"
+	"family-tree-backend/mail"
 	"family-tree-backend/middleware"
 	"family-tree-backend/models"
+	"family-tree-backend/pagination"
 	"family-tree-backend/seed"
 	"family-tree-backend/services"
 
@@ -45,6 +50,11 @@ func main() {
 		return
 	}
 
+	// Birth and death dates moved from timestamps to genealogical dates
+	if err := services.MigratePersonDates(db); err != nil {
+		log.Printf("Warning: Failed to migrate person dates: %v", err)
+	}
+
 	// Auto Migrate
 	db.AutoMigrate(
 		&models.User{},
@@ -59,8 +69,39 @@ func main() {
 		&models.NotificationPreference{},
 		&models.Reminder{},
 		&models.LinkRequest{},
+		&models.Relationship{},
+		&models.FamilyTree{},
+		&models.TreeMembership{},
+		&models.Invitation{},
+		&models.InvitationRedemption{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.MFASecret{},
+		&models.RecoveryCode{},
+		&models.Role{},
+		&models.EditProposal{},
+		&models.PersonRevision{},
+		&models.PersonDeletion{},
+		&models.Place{},
+		&models.Source{},
+		&models.Citation{},
 	)
 
+	// Create trees and memberships for data from before trees were entities
+	if err := services.BootstrapFamilyTrees(db); err != nil {
+		log.Printf("Warning: Failed to bootstrap family trees: %v", err)
+	}
+
+	// Move relationships out of the legacy JSON column into edges
+	if err := services.MigrateLegacyRelationships(db); err != nil {
+		log.Printf("Warning: Failed to migrate legacy relationships: %v", err)
+	}
+
+	// Index names for search and fill in persons saved before search existed
+	if err := services.SetupPersonSearch(db); err != nil {
+		log.Printf("Warning: Failed to set up person search: %v", err)
+	}
+
 	// Create uploads directory
 	if _, err := os.Stat("uploads"); os.IsNotExist(err) {
 		os.Mkdir("uploads", 0755)
@@ -88,7 +129,32 @@ func main() {
 			log.Println("Firebase initialized from credentials file")
 		}
 	} else {
-		log.Println("Warning: No Firebase credentials found. Auth will be skipped.")
+		log.Println("Warning: No Firebase credentials found. Only local tokens will be accepted.")
+	}
+
+	// Keys for local access tokens; see JWT_SIGNING_KEYS
+	if err := auth.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+
+	// Build the authenticator chain: local tokens from /login, Firebase ID
+	// tokens, and dev mode only when explicitly enabled
+	authenticators := auth.Chain{auth.LocalAuthenticator{
+		SessionStatus: func(ctx context.Context, sessionID string) (bool, time.Time) {
+			return services.SessionStatus(db.WithContext(ctx), sessionID)
+		},
+	}}
+	if app != nil {
+		client, err := app.Auth(context.Background())
+		if err != nil {
+			log.Printf("Warning: Failed to initialize Firebase auth client: %v", err)
+		} else {
+			authenticators = append(authenticators, auth.FirebaseAuthenticator{Client: client})
+		}
+	}
+	if os.Getenv("AUTH_DEV_MODE") == "true" {
+		log.Println("WARNING: AUTH_DEV_MODE is enabled. Any bearer token is accepted as a user ID. Never use this in production.")
+		authenticators = append(authenticators, auth.DevAuthenticator{})
 	}
 
 	// Initialize Redis
@@ -111,7 +177,8 @@ func main() {
 	}
 
 	// Initialize Handlers
-	authHandler := &handlers.AuthHandler{DB: db}
+	mailer := mail.NewSenderFromEnv()
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer}
 	personHandler := &handlers.PersonHandler{DB: db}
 	uploadHandler := &handlers.UploadHandler{}
 	postHandler := &handlers.PostHandler{DB: db, NotificationService: notificationService}
@@ -120,6 +187,15 @@ func main() {
 	notificationHandler := &handlers.NotificationHandler{DB: db}
 	reminderHandler := &handlers.ReminderHandler{DB: db}
 	linkHandler := &handlers.LinkHandler{DB: db}
+	relationshipHandler := &handlers.RelationshipHandler{DB: db}
+	treeHandler := &handlers.TreeHandler{DB: db}
+	gedcomHandler := &handlers.GedcomHandler{DB: db}
+	familyTreeHandler := &handlers.FamilyTreeHandler{DB: db, Mailer: mailer}
+	invitationHandler := &handlers.InvitationHandler{DB: db}
+	roleHandler := &handlers.RoleHandler{DB: db}
+	editProposalHandler := &handlers.EditProposalHandler{DB: db, NotificationService: notificationService}
+	placeHandler := &handlers.PlaceHandler{DB: db, Geocoder: geocode.NewGeocoderFromEnv()}
+	sourceHandler := &handlers.SourceHandler{DB: db}
 
 	// Setup Router
 	r := gin.Default()
@@ -128,7 +204,7 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Family-Tree-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -142,17 +218,24 @@ func main() {
 	// Public Routes
 	r.POST("/register", authHandler.Register)
 	r.POST("/login", authHandler.Login)
+	r.POST("/auth/refresh", authHandler.Refresh)
+	r.POST("/auth/logout", authHandler.Logout)
+	r.POST("/auth/mfa/verify", authHandler.CompleteMFALogin)
+	r.POST("/auth/verify-email", authHandler.VerifyEmail)
+	r.POST("/auth/password/forgot", authHandler.ForgotPassword)
+	r.POST("/auth/password/reset", authHandler.ResetPassword)
+	r.GET("/invitations/:code", invitationHandler.PreviewInvitation)
 	r.Static("/uploads", "./uploads")
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
 
-	// Public read-only access to persons (for demo mode)
-	r.GET("/public/persons", personHandler.GetPersons)
+	// Public read-only access to persons of public trees (for demo mode)
+	r.GET("/public/persons", personHandler.GetPublicPersons)
 
 	// Protected Routes (authenticated users)
 	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware(app, db))
+	api.Use(middleware.AuthMiddleware(authenticators, db))
 	{
 		// User info endpoint - get current user with role
 		api.GET("/me", func(c *gin.Context) {
@@ -164,34 +247,30 @@ func main() {
 			c.JSON(http.StatusOK, user)
 		})
 
-		// Person Routes - READ for all authenticated users
-		api.GET("/persons", personHandler.GetPersons)
-		api.GET("/persons/:id", personHandler.GetPerson)
-
-		// Person UPDATE - users can update their own profile
-		api.PUT("/persons/:id", personHandler.UpdatePersonWithPermission)
-
-		// Upload Routes - all authenticated users can upload (for profile photos)
-		api.POST("/upload", uploadHandler.UploadFile)
+		// Ask for another verification email
+		api.POST("/me/verify-email", authHandler.RequestEmailVerification)
 
-		// Post Routes - READ for all, reactions for all
-		api.GET("/posts", postHandler.GetPosts)
-		api.GET("/posts/:id/comments", postHandler.GetComments)
-		api.POST("/posts/:id/reactions", postHandler.ToggleReaction)
+		// Two-factor authentication
+		api.GET("/mfa", authHandler.GetMFAStatus)
+		api.POST("/mfa/enroll", authHandler.StartMFAEnrollment)
+		api.POST("/mfa/enroll/confirm", authHandler.ConfirmMFAEnrollment)
+		api.POST("/mfa/verify", authHandler.VerifyMFA)
+		api.POST("/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		api.DELETE("/mfa", authHandler.DisableMFA)
 
-		// Comments - all users can comment
-		api.POST("/posts/:id/comments", postHandler.CreateComment)
-		api.DELETE("/comments/:id", postHandler.DeleteComment)
+		// Signed-in devices
+		api.GET("/sessions", authHandler.GetSessions)
+		api.DELETE("/sessions/:id", authHandler.RevokeSession)
+		api.POST("/sessions/logout-all", authHandler.LogoutAll)
 
-		// Message Routes - all users can chat
-		api.GET("/messages", messageHandler.GetMessages)
-		api.POST("/messages", messageHandler.SendMessage)
-		api.PUT("/messages/:id", messageHandler.UpdateMessage)
-		api.DELETE("/messages/:id", messageHandler.DeleteMessage)
+		// Family trees the user belongs to
+		api.GET("/trees", familyTreeHandler.GetMyTrees)
+		api.POST("/trees", familyTreeHandler.CreateTree)
+		api.PUT("/trees/current", familyTreeHandler.SwitchTree)
+		api.POST("/invitations/redeem", invitationHandler.RedeemInvitation)
 
-		// Event Routes - READ for all, RSVP for all
-		api.GET("/events", eventHandler.GetEvents)
-		api.POST("/events/:id/rsvp", eventHandler.ToggleRSVP)
+		// Upload Routes - all authenticated users can upload (for profile photos)
+		api.POST("/upload", uploadHandler.UploadFile)
 
 		// Notification Routes
 		api.POST("/devices/register", notificationHandler.RegisterDeviceToken)
@@ -208,46 +287,181 @@ func main() {
 		api.PUT("/reminders/:id", reminderHandler.UpdateReminder)
 		api.PUT("/reminders/:id/snooze", reminderHandler.SnoozeReminder)
 		api.DELETE("/reminders/:id", reminderHandler.DeleteReminder)
+	}
+
+	// Tree-scoped Routes - act on the current tree or the X-Family-Tree-ID header
+	treeAPI := api.Group("")
+	treeAPI.Use(middleware.TreeMiddleware(db))
+	{
+		// Person Routes - READ for all authenticated users
+		treeAPI.GET("/persons", personHandler.GetPersons)
+		treeAPI.GET("/persons/search", personHandler.SearchPersons)
+		treeAPI.GET("/persons/:id", personHandler.GetPerson)
+		treeAPI.GET("/persons/:id/relationships", relationshipHandler.GetPersonRelationships)
+		treeAPI.GET("/persons/:id/history", personHandler.GetPersonHistory)
+		treeAPI.GET("/persons/:id/ancestors", treeHandler.GetAncestors)
+		treeAPI.GET("/persons/:id/descendants", treeHandler.GetDescendants)
+		treeAPI.GET("/persons/:id/relationship-to/:otherId", treeHandler.GetRelationshipTo)
+		treeAPI.GET("/persons/:id/chart", treeHandler.GetChart)
+		treeAPI.GET("/persons/:id/places", placeHandler.GetPersonPlaces)
+		treeAPI.GET("/persons/:id/citations", sourceHandler.GetPersonCitations)
+
+		// Person UPDATE - users can update their own profile
+		treeAPI.PUT("/persons/:id", personHandler.UpdatePersonWithPermission)
+		treeAPI.PUT("/persons/:id/privacy", personHandler.UpdatePrivacy)
+
+		// Suggested edits - any member proposes; editors or the linked person review
+		treeAPI.POST("/persons/:id/proposals", editProposalHandler.CreateProposal)
+		treeAPI.GET("/persons/:id/proposals", editProposalHandler.GetPersonProposals)
+		treeAPI.GET("/proposals", editProposalHandler.GetProposals)
+		treeAPI.GET("/proposals/:id", editProposalHandler.GetProposal)
+		treeAPI.POST("/proposals/:id/review", editProposalHandler.ReviewProposal)
+		treeAPI.POST("/proposals/:id/withdraw", editProposalHandler.WithdrawProposal)
+
+		// Places - READ for all; who was born, married or lived where
+		treeAPI.GET("/places", placeHandler.GetPlaces)
+		treeAPI.GET("/places/geocode", placeHandler.Geocode)
+		treeAPI.GET("/places/:id", placeHandler.GetPlace)
+		treeAPI.GET("/places/:id/persons", placeHandler.GetPlacePersons)
+
+		// Sources - READ for all, with what each source is cited for
+		treeAPI.GET("/sources", sourceHandler.GetSources)
+		treeAPI.GET("/sources/:id", sourceHandler.GetSource)
+
+		// Permissions in the current tree
+		treeAPI.GET("/permissions", roleHandler.GetMyPermissions)
+
+		// Post Routes - READ for all, reactions for all; authors edit their own
+		treeAPI.GET("/posts", postHandler.GetPosts)
+		treeAPI.POST("/posts", middleware.RequirePermission(models.PermPostCreate), postHandler.CreatePost)
+		treeAPI.PUT("/posts/:id", postHandler.UpdatePost)
+		treeAPI.DELETE("/posts/:id", postHandler.DeletePost)
+		treeAPI.GET("/posts/:id/comments", postHandler.GetComments)
+		treeAPI.POST("/posts/:id/reactions", postHandler.ToggleReaction)
+
+		// Comments - all users can comment
+		treeAPI.POST("/posts/:id/comments", postHandler.CreateComment)
+		treeAPI.DELETE("/comments/:id", postHandler.DeleteComment)
+
+		// Message Routes - all users can chat
+		treeAPI.GET("/messages", messageHandler.GetMessages)
+		treeAPI.POST("/messages", messageHandler.SendMessage)
+		treeAPI.PUT("/messages/:id", messageHandler.UpdateMessage)
+		treeAPI.DELETE("/messages/:id", messageHandler.DeleteMessage)
+
+		// Event Routes - READ for all, RSVP for all; creators edit their own
+		treeAPI.GET("/events", eventHandler.GetEvents)
+		treeAPI.POST("/events", middleware.RequirePermission(models.PermEventCreate), eventHandler.CreateEvent)
+		treeAPI.PUT("/events/:id", eventHandler.UpdateEvent)
+		treeAPI.DELETE("/events/:id", eventHandler.DeleteEvent)
+		treeAPI.POST("/events/:id/rsvp", eventHandler.ToggleRSVP)
 
 		// Link Request Routes
-		api.POST("/link-requests", linkHandler.RequestLink)
-		api.GET("/link-requests/my-status", linkHandler.GetMyLinkStatus)
+		treeAPI.POST("/link-requests", linkHandler.RequestLink)
+		treeAPI.GET("/link-requests/my-status", linkHandler.GetMyLinkStatus)
 	}
 
-	// Admin-only Routes
+	// Admin Routes - for roles beyond a regular member; each route checks
+	// its own permission
+	requires := middleware.RequirePermission
 	admin := r.Group("/api/admin")
-	admin.Use(middleware.AuthMiddleware(app, db), middleware.AdminMiddleware(db))
+	admin.Use(middleware.AuthMiddleware(authenticators, db), middleware.TreeMiddleware(db), middleware.AdminMiddleware(db))
 	{
+		// Tree settings and membership
+		admin.PUT("/tree", requires(models.PermTreeManage), familyTreeHandler.UpdateTree)
+		admin.GET("/members", requires(models.PermMemberManage), familyTreeHandler.GetMembers)
+		admin.POST("/members", requires(models.PermMemberManage), familyTreeHandler.AddMember)
+		admin.PUT("/members/:userId", requires(models.PermMemberManage), familyTreeHandler.UpdateMember)
+		admin.DELETE("/members/:userId", requires(models.PermMemberManage), familyTreeHandler.RemoveMember)
+
+		// Custom roles - permission bundles such as "historian"
+		admin.GET("/permissions", requires(models.PermRoleManage), roleHandler.GetPermissions)
+		admin.GET("/roles", requires(models.PermRoleManage), roleHandler.GetRoles)
+		admin.POST("/roles", requires(models.PermRoleManage), roleHandler.CreateRole)
+		admin.PUT("/roles/:name", requires(models.PermRoleManage), roleHandler.UpdateRole)
+		admin.DELETE("/roles/:name", requires(models.PermRoleManage), roleHandler.DeleteRole)
+
+		// Invitations - revoking keeps the record for the audit trail
+		admin.POST("/invitations", requires(models.PermMemberManage), invitationHandler.CreateInvitation)
+		admin.GET("/invitations", requires(models.PermMemberManage), invitationHandler.GetInvitations)
+		admin.DELETE("/invitations/:id", requires(models.PermMemberManage), invitationHandler.RevokeInvitation)
+		admin.GET("/invitations/:id/redemptions", requires(models.PermMemberManage), invitationHandler.GetRedemptions)
+
 		// Link Request Admin Routes
-		admin.GET("/link-requests", linkHandler.GetLinkRequests)
-		admin.PUT("/link-requests/:id", linkHandler.UpdateLinkStatus)
-
-		// Person management - CREATE, DELETE (admin only)
-		admin.POST("/persons", personHandler.CreatePerson)
-		admin.PUT("/persons/:id", personHandler.UpdatePerson)
-		admin.DELETE("/persons/:id", personHandler.DeletePerson)
-
-		// Post management - CREATE, UPDATE, DELETE (admin only)
-		admin.POST("/posts", postHandler.CreatePost)
-		admin.PUT("/posts/:id", postHandler.UpdatePost)
-		admin.DELETE("/posts/:id", postHandler.DeletePost)
-
-		// Event management - CREATE, UPDATE, DELETE (admin only)
-		admin.POST("/events", eventHandler.CreateEvent)
-		admin.PUT("/events/:id", eventHandler.UpdateEvent)
-		admin.DELETE("/events/:id", eventHandler.DeleteEvent)
-
-		// User management
-		admin.GET("/users", func(c *gin.Context) {
-			var users []models.User
-			if result := db.Find(&users); result.Error != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		admin.GET("/link-requests", requires(models.PermLinkApprove), linkHandler.GetLinkRequests)
+		admin.PUT("/link-requests/:id", requires(models.PermLinkApprove), linkHandler.UpdateLinkStatus)
+
+		// Person management
+		admin.POST("/persons", requires(models.PermPersonCreate), personHandler.CreatePerson)
+		admin.GET("/persons/duplicates", requires(models.PermPersonEdit), personHandler.GetDuplicates)
+		admin.PUT("/persons/:id", requires(models.PermPersonEdit), personHandler.UpdatePerson)
+		admin.GET("/persons/:id/deletion-preview", requires(models.PermPersonDelete), personHandler.GetDeletionPreview)
+		admin.DELETE("/persons/:id", requires(models.PermPersonDelete), personHandler.DeletePerson)
+		admin.POST("/persons/:id/restore", requires(models.PermPersonDelete), personHandler.RestorePerson)
+		admin.POST("/persons/:id/revert/:revisionId", requires(models.PermPersonEdit), personHandler.RevertPersonRevision)
+		admin.POST("/persons/:id/merge", requires(models.PermPersonEdit), requires(models.PermPersonDelete), personHandler.MergePersons)
+
+		// Relationship edges - each change updates both persons at once
+		admin.POST("/relationships", requires(models.PermRelationshipManage), relationshipHandler.CreateRelationship)
+		admin.PUT("/relationships/:id", requires(models.PermRelationshipManage), relationshipHandler.UpdateRelationship)
+		admin.DELETE("/relationships/:id", requires(models.PermRelationshipManage), relationshipHandler.DeleteRelationship)
+
+		// Places - create, correct and link free-text locations
+		admin.POST("/places", requires(models.PermPersonEdit), placeHandler.CreatePlace)
+		admin.POST("/places/link", requires(models.PermPersonEdit), placeHandler.LinkPlaces)
+		admin.PUT("/places/:id", requires(models.PermPersonEdit), placeHandler.UpdatePlace)
+		admin.DELETE("/places/:id", requires(models.PermPersonEdit), placeHandler.DeletePlace)
+
+		// Sources and citations - the evidence behind dates, events and edges
+		admin.POST("/sources", requires(models.PermPersonEdit), sourceHandler.CreateSource)
+		admin.PUT("/sources/:id", requires(models.PermPersonEdit), sourceHandler.UpdateSource)
+		admin.DELETE("/sources/:id", requires(models.PermPersonEdit), sourceHandler.DeleteSource)
+		admin.POST("/sources/:id/document", requires(models.PermPersonEdit), sourceHandler.UploadSourceDocument)
+		admin.POST("/citations", requires(models.PermPersonEdit), sourceHandler.CreateCitation)
+		admin.PUT("/citations/:id", requires(models.PermPersonEdit), sourceHandler.UpdateCitation)
+		admin.DELETE("/citations/:id", requires(models.PermPersonEdit), sourceHandler.DeleteCitation)
+
+		// Data quality - impossible dates, dangling edges, ancestry cycles
+		admin.GET("/trees/:familyTreeId/issues", requires(models.PermPersonEdit), treeHandler.GetIssues)
+
+		// GEDCOM import/export
+		admin.POST("/trees/:familyTreeId/import", requires(models.PermTreeManage), gedcomHandler.ImportGedcom)
+		admin.GET("/trees/:familyTreeId/export.ged", requires(models.PermTreeExport), gedcomHandler.ExportGedcom)
+
+		// Post management - anyone's posts
+		admin.POST("/posts", requires(models.PermPostCreate), postHandler.CreatePost)
+		admin.PUT("/posts/:id", requires(models.PermPostManage), postHandler.UpdatePost)
+		admin.DELETE("/posts/:id", requires(models.PermPostManage), postHandler.DeletePost)
+
+		// Event management - anyone's events
+		admin.POST("/events", requires(models.PermEventCreate), eventHandler.CreateEvent)
+		admin.PUT("/events/:id", requires(models.PermEventManage), eventHandler.UpdateEvent)
+		admin.DELETE("/events/:id", requires(models.PermEventManage), eventHandler.DeleteEvent)
+
+		// User management - deployment-wide, only global admins hold user:role
+		userListSpec := pagination.Spec{
+			Sorts:       map[string]string{"createdAt": "created_at", "name": "name", "email": "email"},
+			DefaultSort: "createdAt",
+			TimeColumn:  "created_at",
+			Filters:     map[string]string{"role": "role", "familyTreeId": "family_tree_id"},
+		}
+		admin.GET("/users", requires(models.PermUserRole), func(c *gin.Context) {
+			params, err := pagination.Parse(c, userListSpec)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, users)
+			page, err := pagination.Find(db, params, func(u models.User) string { return u.ID })
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, page)
 		})
 
-		admin.PUT("/users/:id/role", func(c *gin.Context) {
+		admin.DELETE("/users/:id/mfa", requires(models.PermUserRole), authHandler.ResetUserMFA)
+
+		admin.PUT("/users/:id/role", requires(models.PermUserRole), func(c *gin.Context) {
 			id := c.Param("id")
 			var req struct {
 				Role string `json:"role"`
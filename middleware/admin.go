@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"family-tree-backend/models"
 
@@ -9,7 +12,35 @@ import (
 	"gorm.io/gorm"
 )
 
-// AdminMiddleware checks if the authenticated user has admin role
+// defaultMFAMaxAge is how long a second-factor check lasts for admin routes
+const defaultMFAMaxAge = 12 * time.Hour
+
+// MFAVerifiedAt is when the current request's session last passed a second
+// factor, or zero
+func MFAVerifiedAt(c *gin.Context) time.Time {
+	return c.GetTime("mfaVerifiedAt")
+}
+
+// adminMFAPolicy reads MFA_REQUIRED_FOR_ADMINS and MFA_MAX_AGE
+func adminMFAPolicy() (bool, time.Duration) {
+	required := os.Getenv("MFA_REQUIRED_FOR_ADMINS") == "true"
+	maxAge := defaultMFAMaxAge
+	if v := os.Getenv("MFA_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("Warning: invalid MFA_MAX_AGE %q, using %s", v, defaultMFAMaxAge)
+		} else {
+			maxAge = d
+		}
+	}
+	return required, maxAge
+}
+
+// AdminMiddleware guards the /api/admin routes: the caller's role in the tree
+// resolved by TreeMiddleware must grant more than a regular member's, and
+// each route then checks its own permission with RequirePermission. With
+// MFA_REQUIRED_FOR_ADMINS=true they must also have passed a second factor
+// within MFA_MAX_AGE.
 func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
@@ -26,12 +57,18 @@ func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if !user.IsAdmin() {
+		if !user.IsAdmin() && !Permissions(c).IsElevated() {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
 
+		if !RecentMFA(c) {
+			c.JSON(http.StatusForbidden, mfaChallenge(c, &user))
+			c.Abort()
+			return
+		}
+
 		c.Set("user", user)
 		c.Next()
 	}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"family-tree-backend/auth"
+	"family-tree-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaPolicy is adminMFAPolicy, read once
+var mfaPolicy = sync.OnceValues(adminMFAPolicy)
+
+// Permissions returns the caller's permissions resolved by TreeMiddleware
+func Permissions(c *gin.Context) models.PermissionSet {
+	value, _ := c.Get("permissions")
+	perms, _ := value.(models.PermissionSet)
+	return perms
+}
+
+// RecentMFA reports whether the caller may use elevated permissions: either
+// MFA_REQUIRED_FOR_ADMINS is off or their session passed a second factor
+// within MFA_MAX_AGE
+func RecentMFA(c *gin.Context) bool {
+	required, maxAge := mfaPolicy()
+	return !required || time.Since(MFAVerifiedAt(c)) <= maxAge
+}
+
+// HasPermission reports whether the caller holds perm in the current tree.
+// Permissions beyond a regular member's also need a recent second factor,
+// wherever they are checked, just as the /api/admin routes do.
+func HasPermission(c *gin.Context, perm models.Permission) bool {
+	return Permissions(c).Has(perm) && (!perm.IsElevated() || RecentMFA(c))
+}
+
+// RequirePermission rejects callers whose role in the current tree lacks
+// perm. It must run after TreeMiddleware.
+func RequirePermission(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			Forbid(c, perm, "You don't have permission to do this")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Forbid answers a request that needed perm with a 403. Callers who hold
+// perm but lack a recent second factor are told to verify it instead.
+func Forbid(c *gin.Context, perm models.Permission, message string) {
+	if Permissions(c).Has(perm) {
+		user, _ := c.Get("user")
+		u, _ := user.(models.User)
+		c.JSON(http.StatusForbidden, mfaChallenge(c, &u))
+		return
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": message, "permission": perm})
+}
+
+// mfaChallenge is the 403 body asking for a second factor. Clients use the
+// code to send the user to enrollment or the code prompt.
+func mfaChallenge(c *gin.Context, user *models.User) gin.H {
+	if c.GetString("authProvider") == auth.ProviderLocal && !user.MFAEnabled {
+		return gin.H{"error": "Admins must set up two-factor authentication", "code": "mfa_enrollment_required"}
+	}
+	return gin.H{"error": "Verify your second factor to continue", "code": "mfa_required"}
+}
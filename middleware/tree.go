@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+
+	"family-tree-backend/models"
+	"family-tree-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TreeHeader lets a client act on a tree other than the user's current one
+const TreeHeader = "X-Family-Tree-ID"
+
+// TreeMiddleware resolves the family tree a request acts on and the caller's
+// role and permissions in it. The tree comes from the :familyTreeId route
+// parameter, the X-Family-Tree-ID header, or the user's current tree, in that
+// order. Global admins may act on any tree as its owner and hold every
+// permission.
+func TreeMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userValue, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+		user := userValue.(models.User)
+
+		treeID := c.Param("familyTreeId")
+		if treeID == "" {
+			treeID = c.GetHeader(TreeHeader)
+		}
+		if treeID == "" {
+			treeID = user.FamilyTreeID
+		}
+		if treeID == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No family tree selected. Create or join a tree first"})
+			c.Abort()
+			return
+		}
+
+		var tree models.FamilyTree
+		if err := db.First(&tree, "id = ?", treeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Family tree not found"})
+			c.Abort()
+			return
+		}
+
+		var role models.TreeRole
+		var membership models.TreeMembership
+		if err := db.Where("family_tree_id = ? AND user_id = ?", treeID, user.ID).First(&membership).Error; err == nil {
+			role = membership.Role
+		}
+		if user.IsAdmin() {
+			role = models.TreeRoleOwner
+		}
+		if role == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this family tree"})
+			c.Abort()
+			return
+		}
+
+		perms, err := services.RolePermissions(db, treeID, role)
+		if err != nil {
+			// A custom role that was deleted grants nothing
+			perms = models.NewPermissionSet()
+		}
+		if user.IsAdmin() {
+			perms = models.NewPermissionSet(models.AllPermissions...)
+		}
+
+		c.Set("familyTreeID", treeID)
+		c.Set("treeRole", role)
+		c.Set("permissions", perms)
+		c.Next()
+	}
+}
+
+// FamilyTreeID returns the tree resolved by TreeMiddleware
+func FamilyTreeID(c *gin.Context) string {
+	return c.GetString("familyTreeID")
+}
+
+// CurrentTreeRole returns the caller's role resolved by TreeMiddleware
+func CurrentTreeRole(c *gin.Context) models.TreeRole {
+	role, _ := c.Get("treeRole")
+	treeRole, _ := role.(models.TreeRole)
+	return treeRole
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProposalStatus is where a suggested edit is in review
+type ProposalStatus string
+
+const (
+	ProposalPending   ProposalStatus = "pending"
+	ProposalApplied   ProposalStatus = "applied"  // Every change decided, at least one accepted
+	ProposalRejected  ProposalStatus = "rejected" // Every change rejected
+	ProposalWithdrawn ProposalStatus = "withdrawn"
+)
+
+// ChangeStatus is the reviewer's decision on one change
+type ChangeStatus string
+
+const (
+	ChangePending  ChangeStatus = "pending"
+	ChangeAccepted ChangeStatus = "accepted"
+	ChangeRejected ChangeStatus = "rejected"
+)
+
+// ProposalFieldRelationship marks a change that adds or removes an edge
+// rather than setting a profile field
+const ProposalFieldRelationship = "relationship"
+
+// ProposedRelationship adds an edge touching the person, or removes one
+type ProposedRelationship struct {
+	Action          string           `json:"action"` // add or remove
+	RelationshipID  string           `json:"relationshipId,omitempty"`
+	PersonID        string           `json:"personId,omitempty"`
+	RelatedPersonID string           `json:"relatedPersonId,omitempty"`
+	Type            RelationshipType `json:"type,omitempty"`
+	Qualifier       string           `json:"qualifier,omitempty"`
+	StartDate       *time.Time       `json:"startDate,omitempty"`
+	EndDate         *time.Time       `json:"endDate,omitempty"`
+}
+
+// ProposalChange is one field of a suggested edit. Old is the value the
+// proposer saw, so reviewers can tell if the person changed since.
+type ProposalChange struct {
+	ID           string                `json:"id"`
+	Field        string                `json:"field"`
+	Old          json.RawMessage       `json:"old,omitempty"`
+	New          json.RawMessage       `json:"new,omitempty"`
+	Relationship *ProposedRelationship `json:"relationship,omitempty"`
+	Status       ChangeStatus          `json:"status"`
+	Reason       string                `json:"reason,omitempty"` // Reviewer's note
+}
+
+type ProposalChanges []ProposalChange
+
+func (pc *ProposalChanges) Scan(value interface{}) error {
+	if value == nil {
+		*pc = ProposalChanges{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion failed for ProposalChanges")
+	}
+	return json.Unmarshal(bytes, pc)
+}
+
+func (pc ProposalChanges) Value() (driver.Value, error) {
+	return json.Marshal(pc)
+}
+
+// EditProposal is a suggested edit to a person, reviewed change by change by
+// someone with person:edit or the user linked to the person
+type EditProposal struct {
+	ID           string          `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string          `gorm:"index" json:"familyTreeId"`
+	PersonID     string          `gorm:"index" json:"personId"`
+	ProposedBy   string          `gorm:"index" json:"proposedBy"`
+	Note         string          `json:"note"` // Where the proposer knows this from
+	Changes      ProposalChanges `gorm:"type:text" json:"changes"`
+	Status       ProposalStatus  `gorm:"default:pending;index" json:"status"`
+	ReviewedBy   string          `json:"reviewedBy,omitempty"`
+	ReviewedAt   *time.Time      `json:"reviewedAt,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+	DeletedAt    gorm.DeletedAt  `gorm:"index" json:"-"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TreeRole is a user's role within one family tree: one of the built-in
+// roles below or the name of a custom Role defined for the tree
+type TreeRole string
+
+const (
+	TreeRoleOwner  TreeRole = "owner"
+	TreeRoleAdmin  TreeRole = "admin"
+	TreeRoleEditor TreeRole = "editor" // Can edit any person in the tree
+	TreeRoleMember TreeRole = "member" // Can also create posts and events
+	TreeRoleViewer TreeRole = "viewer" // Can read, chat, comment and edit their own profile
+)
+
+// BuiltInTreeRoles lists the built-in roles from most to least powerful
+var BuiltInTreeRoles = []TreeRole{TreeRoleOwner, TreeRoleAdmin, TreeRoleEditor, TreeRoleMember, TreeRoleViewer}
+
+// IsBuiltIn reports whether r is one of the built-in roles
+func (r TreeRole) IsBuiltIn() bool {
+	return BuiltInRolePermissions(r) != nil
+}
+
+// CanManageAdmins reports whether the role may grant or take away owner and
+// admin
+func (r TreeRole) CanManageAdmins() bool {
+	return r == TreeRoleOwner
+}
+
+// FamilyTree is one family hosted on the deployment. All persons, posts,
+// messages and events belong to exactly one tree.
+type FamilyTree struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	IsPublic    bool           `gorm:"default:false" json:"isPublic"` // Readable through /public/persons
+	CreatedBy   string         `json:"createdBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TreeMembership grants a user a role in a family tree
+type TreeMembership struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string    `gorm:"uniqueIndex:idx_tree_membership" json:"familyTreeId"`
+	UserID       string    `gorm:"uniqueIndex:idx_tree_membership;index" json:"userId"`
+	Role         TreeRole  `gorm:"default:member" json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
@@ -8,7 +8,7 @@ import (
 
 type Post struct {
 	ID           string          `gorm:"primaryKey" json:"id"`
-	FamilyTreeID string          `json:"familyTreeId"`
+	FamilyTreeID string          `gorm:"index:idx_posts_tree_created" json:"familyTreeId"`
 	UserID       string          `json:"userId"`
 	UserName     string          `json:"userName"`
 	UserPhoto    string          `json:"userPhoto"`
@@ -16,21 +16,21 @@ type Post struct {
 	Photos       JSONStringArray `gorm:"type:text" json:"photos"`
 	Videos       JSONStringArray `gorm:"type:text" json:"videos"`
 	Files        JSONStringArray `gorm:"type:text" json:"files"`
-	CreatedAt    time.Time       `json:"createdAt"`
+	CreatedAt    time.Time       `gorm:"index:idx_posts_tree_created" json:"createdAt"`
 	UpdatedAt    time.Time       `json:"updatedAt"`
 	DeletedAt    gorm.DeletedAt  `gorm:"index" json:"-"`
 }
 
 type Message struct {
 	ID           string         `gorm:"primaryKey" json:"id"`
-	FamilyTreeID string         `json:"familyTreeId"`
+	FamilyTreeID string         `gorm:"index:idx_messages_tree_sent" json:"familyTreeId"`
 	UserID       string         `json:"userId"`
 	UserName     string         `json:"userName"`
 	UserPhoto    string         `json:"userPhoto"`
 	Text         string         `json:"text"`
 	Type         string         `json:"type"` // text, image, video
 	MediaURL     string         `json:"mediaUrl"`
-	SentAt       time.Time      `json:"sentAt"`
+	SentAt       time.Time      `gorm:"index:idx_messages_tree_sent" json:"sentAt"`
 	IsRead       bool           `json:"isRead"`
 	CreatedAt    time.Time      `json:"createdAt"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
@@ -43,6 +43,7 @@ type Event struct {
 	Description  string          `json:"description"`
 	Location     string          `json:"location"`
 	MapLink      string          `json:"mapLink"`
+	PlaceID      string          `gorm:"index" json:"placeId,omitempty"`
 	DateTime     time.Time       `json:"dateTime"`
 	CreatedBy    string          `json:"createdBy"`
 	Attendees    JSONStringArray `gorm:"type:text" json:"attendees"`
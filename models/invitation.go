@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation states, derived from the row rather than stored
+const (
+	InvitationActive  = "active"
+	InvitationExpired = "expired"
+	InvitationRevoked = "revoked"
+	InvitationUsedUp  = "used_up"
+)
+
+// Invitation lets people join a family tree with a code or link. An
+// invitation bound to a person also links the new member's account to them;
+// one sent to an email address can only be redeemed by that address.
+type Invitation struct {
+	ID           string         `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string         `gorm:"index" json:"familyTreeId"`
+	Code         string         `gorm:"uniqueIndex" json:"code"`
+	Role         TreeRole       `json:"role"`
+	PersonID     string         `json:"personId,omitempty"`
+	Email        string         `json:"email,omitempty"` // Only an account with this verified email can redeem it
+	Note         string         `json:"note,omitempty"`
+	MaxUses      int            `json:"maxUses"`
+	UseCount     int            `json:"useCount"`
+	ExpiresAt    time.Time      `json:"expiresAt"`
+	CreatedBy    string         `json:"createdBy"`
+	RevokedAt    *time.Time     `json:"revokedAt,omitempty"`
+	RevokedBy    string         `json:"revokedBy,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Status reports whether the invitation can still be redeemed
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case now.After(i.ExpiresAt):
+		return InvitationExpired
+	case i.UseCount >= i.MaxUses:
+		return InvitationUsedUp
+	default:
+		return InvitationActive
+	}
+}
+
+// InvitationRedemption records who joined a tree with which invitation
+type InvitationRedemption struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	InvitationID string    `gorm:"index" json:"invitationId"`
+	FamilyTreeID string    `gorm:"index" json:"familyTreeId"`
+	UserID       string    `gorm:"index" json:"userId"`
+	PersonID     string    `json:"personId,omitempty"`
+	RedeemedAt   time.Time `json:"redeemedAt"`
+}
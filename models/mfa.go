@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// MFASecret is a user's TOTP authenticator. EnabledAt stays nil until the
+// user proves the app is set up by entering a code.
+type MFASecret struct {
+	UserID         string     `gorm:"primaryKey" json:"userId"`
+	Secret         string     `json:"-"`
+	LastStep       int64      `json:"-"` // Last accepted time step; a code can't be used twice
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+	EnabledAt      *time.Time `json:"enabledAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// RecoveryCode is a single-use backup for when the authenticator is lost.
+// Only its hash is stored.
+type RecoveryCode struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"index" json:"userId"`
+	CodeHash  string     `gorm:"uniqueIndex" json:"-"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -18,6 +18,7 @@ const (
 	NotificationNewMessage    NotificationType = "new_message"
 	NotificationEventRSVP     NotificationType = "event_rsvp"
 	NotificationMention       NotificationType = "mention"
+	NotificationEditProposal  NotificationType = "edit_proposal"
 )
 
 // JSONMap is a custom type for storing JSON data
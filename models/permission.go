@@ -0,0 +1,148 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission names one thing a role allows, as "resource:action"
+type Permission string
+
+const (
+	PermPersonCreate       Permission = "person:create"
+	PermPersonEdit         Permission = "person:edit" // Any person; everyone may edit their own profile
+	PermPersonDelete       Permission = "person:delete"
+	PermRelationshipManage Permission = "relationship:manage"
+	PermPostCreate         Permission = "post:create"
+	PermPostManage         Permission = "post:manage" // Edit or delete anyone's posts and comments
+	PermEventCreate        Permission = "event:create"
+	PermEventManage        Permission = "event:manage" // Edit or delete any event
+	PermMessageModerate    Permission = "message:moderate"
+	PermLinkApprove        Permission = "link:approve"
+	PermMemberManage       Permission = "member:manage" // Members and invitations
+	PermRoleManage         Permission = "role:manage"
+	PermTreeManage         Permission = "tree:manage" // Settings and GEDCOM import
+	PermTreeExport         Permission = "tree:export"
+	PermUserRole           Permission = "user:role" // Deployment-wide; global admins only
+)
+
+// TreePermissions are the permissions a tree role can grant, in display order
+var TreePermissions = []Permission{
+	PermPersonCreate,
+	PermPersonEdit,
+	PermPersonDelete,
+	PermRelationshipManage,
+	PermPostCreate,
+	PermPostManage,
+	PermEventCreate,
+	PermEventManage,
+	PermMessageModerate,
+	PermLinkApprove,
+	PermMemberManage,
+	PermRoleManage,
+	PermTreeManage,
+	PermTreeExport,
+}
+
+// AllPermissions adds the deployment-wide permissions held by global admins
+var AllPermissions = append(append([]Permission{}, TreePermissions...), PermUserRole)
+
+// IsTreePermission reports whether p can be granted by a tree role
+func (p Permission) IsTreePermission() bool {
+	for _, tp := range TreePermissions {
+		if p == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// IsElevated reports whether p goes beyond what the built-in member role
+// allows
+func (p Permission) IsElevated() bool {
+	return !BuiltInRolePermissions(TreeRoleMember).Has(p)
+}
+
+// PermissionSet is the permissions a caller holds
+type PermissionSet map[Permission]bool
+
+func NewPermissionSet(perms ...Permission) PermissionSet {
+	s := make(PermissionSet, len(perms))
+	for _, p := range perms {
+		s[p] = true
+	}
+	return s
+}
+
+func (s PermissionSet) Has(p Permission) bool {
+	return s[p]
+}
+
+// Covers reports whether s holds every permission in other
+func (s PermissionSet) Covers(other PermissionSet) bool {
+	for p := range other {
+		if !s[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsElevated reports whether s goes beyond what the built-in member role
+// allows. Elevated callers may use the /api/admin routes.
+func (s PermissionSet) IsElevated() bool {
+	return !BuiltInRolePermissions(TreeRoleMember).Covers(s)
+}
+
+// List returns the permissions in display order
+func (s PermissionSet) List() []Permission {
+	list := make([]Permission, 0, len(s))
+	for _, p := range AllPermissions {
+		if s[p] {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// BuiltInRolePermissions is the bundle for a built-in role, or nil for
+// custom roles. Owners and admins differ only in that owners can manage admins.
+func BuiltInRolePermissions(role TreeRole) PermissionSet {
+	switch role {
+	case TreeRoleOwner, TreeRoleAdmin:
+		return NewPermissionSet(TreePermissions...)
+	case TreeRoleEditor:
+		return NewPermissionSet(PermPersonCreate, PermPersonEdit, PermRelationshipManage,
+			PermPostCreate, PermEventCreate, PermTreeExport)
+	case TreeRoleMember:
+		return NewPermissionSet(PermPostCreate, PermEventCreate)
+	case TreeRoleViewer:
+		return NewPermissionSet()
+	default:
+		return nil
+	}
+}
+
+// Role is a custom permission bundle defined by a tree's admins, e.g. a
+// "historian" who can edit any person but not posts. Members reference it by
+// Name in TreeMembership.Role.
+type Role struct {
+	ID           string          `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string          `gorm:"uniqueIndex:idx_tree_role" json:"familyTreeId"`
+	Name         TreeRole        `gorm:"uniqueIndex:idx_tree_role" json:"name"`
+	Description  string          `json:"description"`
+	Permissions  JSONStringArray `gorm:"type:text" json:"permissions"`
+	CreatedBy    string          `json:"createdBy"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+// PermissionSet returns the role's permissions, ignoring unknown names
+func (r *Role) PermissionSet() PermissionSet {
+	s := NewPermissionSet()
+	for _, p := range r.Permissions {
+		if Permission(p).IsTreePermission() {
+			s[Permission(p)] = true
+		}
+	}
+	return s
+}
@@ -4,8 +4,11 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"strings"
 	"time"
 
+	"family-tree-backend/gendate"
+
 	"gorm.io/gorm"
 )
 
@@ -33,7 +36,8 @@ func (a JSONStringArray) Value() (driver.Value, error) {
 	return json.Marshal(a)
 }
 
-// Relationships represents family connections
+// Relationships represents family connections. It is not stored on the
+// person row; it is built from the relationships table on read.
 type Relationships struct {
 	ParentIDs   []string                 `json:"parents"`
 	Spouses     []RelationshipConnection `json:"spouses"`
@@ -41,27 +45,6 @@ type Relationships struct {
 	SiblingIDs  []string                 `json:"siblings"`
 }
 
-func (r *Relationships) Scan(value interface{}) error {
-	if value == nil {
-		*r = Relationships{}
-		return nil
-	}
-	var bytes []byte
-	switch v := value.(type) {
-	case []byte:
-		bytes = v
-	case string:
-		bytes = []byte(v)
-	default:
-		return errors.New("type assertion failed for Relationships")
-	}
-	return json.Unmarshal(bytes, r)
-}
-
-func (r Relationships) Value() (driver.Value, error) {
-	return json.Marshal(r)
-}
-
 // RelationshipConnection represents a spousal relationship
 type RelationshipConnection struct {
 	PersonID  string     `json:"personId"`
@@ -72,12 +55,13 @@ type RelationshipConnection struct {
 
 // LifeEvent represents a life event
 type LifeEvent struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	Date        time.Time `json:"date"`
-	Location    string    `json:"location,omitempty"`
-	Photos      []string  `json:"photos"`
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description,omitempty"`
+	Date        *gendate.Date `json:"date,omitempty"`
+	Location    string        `json:"location,omitempty"`
+	PlaceID     string        `json:"placeId,omitempty"` // Set when the location is linked to a Place
+	Photos      []string      `json:"photos"`
 }
 
 type LifeEvents []LifeEvent
@@ -103,6 +87,64 @@ func (le LifeEvents) Value() (driver.Value, error) {
 	return json.Marshal(le)
 }
 
+// PersonPrivacy is who may see a living person's details, or one field of
+// them
+type PersonPrivacy string
+
+const (
+	PrivacyMembers PersonPrivacy = "members" // Tree members, not the public; the default
+	PrivacyPublic  PersonPrivacy = "public"  // Everyone, even while living
+	PrivacyFamily  PersonPrivacy = "family"  // Close family in the tree; fields only
+	PrivacyPrivate PersonPrivacy = "private" // For a person, editors and the person themselves; for a field, only the person
+)
+
+// IsValid reports whether p is a known setting for a whole person; empty
+// means PrivacyMembers
+func (p PersonPrivacy) IsValid() bool {
+	switch p {
+	case "", PrivacyMembers, PrivacyPublic, PrivacyPrivate:
+		return true
+	}
+	return false
+}
+
+// Fields whose visibility the person linked to a profile can choose
+const (
+	FieldBirthDate  = "birthDate"
+	FieldBio        = "bio"
+	FieldPhotos     = "photos" // With the profile photo
+	FieldLifeEvents = "lifeEvents"
+	FieldContact    = "contact" // Email and phone
+)
+
+// PrivacyFields lists the fields of FieldPrivacy
+var PrivacyFields = []string{FieldBirthDate, FieldBio, FieldPhotos, FieldLifeEvents, FieldContact}
+
+// FieldPrivacy maps a field in PrivacyFields to who may see it. Fields left
+// out follow the person's privacy.
+type FieldPrivacy map[string]PersonPrivacy
+
+func (fp *FieldPrivacy) Scan(value interface{}) error {
+	if value == nil {
+		*fp = FieldPrivacy{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion failed for FieldPrivacy")
+	}
+	return json.Unmarshal(bytes, fp)
+}
+
+func (fp FieldPrivacy) Value() (driver.Value, error) {
+	return json.Marshal(fp)
+}
+
 // Person model matching Flutter structure
 type Person struct {
 	ID              string          `gorm:"primaryKey" json:"id"`
@@ -110,15 +152,33 @@ type Person struct {
 	AuthUserID      string          `gorm:"index" json:"authUserId"`
 	FirstName       string          `json:"firstName"`
 	LastName        string          `json:"lastName"`
-	BirthDate       *time.Time      `json:"birthDate,omitempty"`
-	DeathDate       *time.Time      `json:"deathDate,omitempty"`
+	BirthDate       *gendate.Date   `gorm:"type:text" json:"birthDate,omitempty"`
+	DeathDate       *gendate.Date   `gorm:"type:text" json:"deathDate,omitempty"`
 	Gender          string          `json:"gender"`
 	Bio             string          `json:"bio"`
 	ProfilePhotoURL string          `json:"profilePhotoUrl"`
 	Photos          JSONStringArray `gorm:"type:text" json:"photos"`
 	LifeEvents      LifeEvents      `gorm:"type:text" json:"lifeEvents"`
-	Relationships   Relationships   `gorm:"type:text" json:"relationships"`
+	Email           string          `json:"email"`
+	Phone           string          `json:"phone"`
+	Living          *bool           `json:"living"` // Set when the dates don't tell; otherwise inferred
+	Privacy         PersonPrivacy   `json:"privacy,omitempty"`
+	FieldPrivacy    FieldPrivacy    `gorm:"type:text" json:"fieldPrivacy,omitempty"` // Set by the linked user only
+	Redacted        bool            `gorm:"-" json:"redacted,omitempty"`             // Details hidden from the viewer
+	HiddenFields    []string        `gorm:"-" json:"hiddenFields,omitempty"`         // Fields in PrivacyFields hidden from the viewer
+	SearchText      string          `gorm:"type:text" json:"-"`                      // Name spellings for search, see services.PersonSearchText
+	Relationships   Relationships   `gorm:"-" json:"relationships"`
+	Citations       []Citation      `gorm:"-" json:"citations,omitempty"` // Evidence for the person's facts and edges
 	CreatedAt       time.Time       `json:"createdAt"`
 	UpdatedAt       time.Time       `json:"updatedAt"`
 	DeletedAt       gorm.DeletedAt  `gorm:"index" json:"-"`
 }
+
+// FullName is the name shown for a person in messages
+func (p *Person) FullName() string {
+	name := strings.TrimSpace(p.FirstName + " " + p.LastName)
+	if name == "" {
+		return p.ID
+	}
+	return name
+}
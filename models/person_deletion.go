@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// DeleteMode says what happens to a deleted person's references
+type DeleteMode string
+
+const (
+	DeleteDetach   DeleteMode = "detach"   // Remove every edge touching the person
+	DeleteReassign DeleteMode = "reassign" // Give the person's children to another parent, remove other edges
+	DeleteRefuse   DeleteMode = "refuse"   // Only delete a person nothing refers to
+)
+
+// PersonDeletion records what deleting a person changed so it can be
+// undone. Detached edges stay in the table, soft-deleted.
+type PersonDeletion struct {
+	ID                        string          `gorm:"primaryKey" json:"id"`
+	FamilyTreeID              string          `gorm:"index" json:"familyTreeId"`
+	PersonID                  string          `gorm:"index" json:"personId"`
+	Mode                      DeleteMode      `json:"mode"`
+	DeletedBy                 string          `json:"deletedBy"`
+	AuthUserID                string          `json:"authUserId,omitempty"` // Account link the delete removed
+	DetachedRelationshipIDs   JSONStringArray `gorm:"type:text" json:"detachedRelationshipIds"`
+	ReassignedTo              string          `json:"reassignedTo,omitempty"`
+	ReassignedRelationshipIDs JSONStringArray `gorm:"type:text" json:"reassignedRelationshipIds"`
+	LinkRequestIDs            JSONStringArray `gorm:"type:text" json:"linkRequestIds"` // Pending requests the delete rejected
+	InvitationIDs             JSONStringArray `gorm:"type:text" json:"invitationIds"`  // Invitations no longer bound to the person
+	CreatedAt                 time.Time       `json:"createdAt"`
+	RestoredAt                *time.Time      `json:"restoredAt,omitempty"`
+	RestoredBy                string          `json:"restoredBy,omitempty"`
+}
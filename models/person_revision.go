@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RevisionAction is what produced a person revision
+type RevisionAction string
+
+const (
+	RevisionCreate   RevisionAction = "create"
+	RevisionUpdate   RevisionAction = "update"
+	RevisionDelete   RevisionAction = "delete"
+	RevisionRevert   RevisionAction = "revert"   // SourceID is the reverted revision
+	RevisionProposal RevisionAction = "proposal" // SourceID is the applied edit proposal
+	RevisionLink     RevisionAction = "link"     // Linked to a user account
+	RevisionImport   RevisionAction = "import"
+	RevisionMerge    RevisionAction = "merge"   // SourceID is the other person of the merge
+	RevisionRestore  RevisionAction = "restore" // SourceID is the undone deletion
+)
+
+// FieldChange is one field's value before and after a revision, as JSON.
+// Old is null for fields a revision set for the first time.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// RevisionChanges maps a person's JSON field names to what changed
+type RevisionChanges map[string]FieldChange
+
+func (rc *RevisionChanges) Scan(value interface{}) error {
+	if value == nil {
+		*rc = RevisionChanges{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion failed for RevisionChanges")
+	}
+	return json.Unmarshal(bytes, rc)
+}
+
+func (rc RevisionChanges) Value() (driver.Value, error) {
+	return json.Marshal(rc)
+}
+
+// PersonRevision records who changed a person, when, and how. Revisions are
+// never edited or deleted.
+type PersonRevision struct {
+	ID           string          `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string          `gorm:"index" json:"familyTreeId"`
+	PersonID     string          `gorm:"index" json:"personId"`
+	Action       RevisionAction  `json:"action"`
+	ActorID      string          `gorm:"index" json:"actorId"`
+	SourceID     string          `json:"sourceId,omitempty"`
+	Changes      RevisionChanges `gorm:"type:text" json:"changes"`
+	CreatedAt    time.Time       `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"family-tree-backend/gendate"
+)
+
+// Life events saved before dates were genealogical hold RFC3339 timestamps,
+// with the zero time for events without a date
+func TestLifeEventsScanLegacyDates(t *testing.T) {
+	stored := `[
+		{"id":"1","title":"Wedding","date":"1921-06-04T00:00:00Z","photos":null},
+		{"id":"2","title":"Moved to Cairo","date":"0001-01-01T00:00:00Z","photos":[]},
+		{"id":"3","title":"Graduated","date":"about 1915","photos":[]}
+	]`
+	var events LifeEvents
+	if err := events.Scan(stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("%d events, want 3", len(events))
+	}
+
+	want := []string{"1921-06-04", "", "about 1915"}
+	for i, e := range events {
+		if got := e.Date.String(); got != want[i] {
+			t.Errorf("event %s: date %q, want %q", e.ID, got, want[i])
+		}
+	}
+	if !events[1].Date.IsZero() {
+		t.Errorf("zero-time date = %+v, want unset", events[1].Date)
+	}
+	if events[0].Date.Qualifier != gendate.Exact || events[0].Date.Precision() != gendate.PrecisionDay {
+		t.Errorf("timestamp date = %+v, want an exact day", events[0].Date)
+	}
+}
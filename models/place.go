@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PlaceType string
+
+const (
+	PlaceCountry PlaceType = "country"
+	PlaceRegion  PlaceType = "region"
+	PlaceCity    PlaceType = "city"
+	PlaceOther   PlaceType = "other" // Villages, addresses and places not yet classified
+)
+
+// Place is a location in a family tree that life events and events refer to.
+// Places nest (city in region in country) so "Cairo" and "Cairo, Egypt" are
+// one place, and alternate names cover other spellings and scripts.
+type Place struct {
+	ID             string          `gorm:"primaryKey" json:"id"`
+	FamilyTreeID   string          `gorm:"index" json:"familyTreeId"`
+	ParentID       string          `gorm:"index" json:"parentId,omitempty"`
+	Name           string          `json:"name"`
+	Type           PlaceType       `json:"type"`
+	AlternateNames JSONStringArray `gorm:"type:text" json:"alternateNames"`
+	Latitude       *float64        `json:"latitude,omitempty"`
+	Longitude      *float64        `json:"longitude,omitempty"`
+	GeocoderID     string          `gorm:"index" json:"geocoderId,omitempty"` // The geocoder's ID, so a geocoded place is created once per tree
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"-"`
+}
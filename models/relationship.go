@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RelationshipType identifies the kind of edge between two persons
+type RelationshipType string
+
+const (
+	RelationshipParentChild RelationshipType = "parent_child" // PersonID is the parent, RelatedPersonID the child
+	RelationshipSpouse      RelationshipType = "spouse"
+	RelationshipSibling     RelationshipType = "sibling" // Only for siblings whose shared parents are unknown
+)
+
+// Qualifiers for parent-child edges
+const (
+	ParentBiological = "biological"
+	ParentAdoptive   = "adoptive"
+	ParentStep       = "step"
+	ParentFoster     = "foster"
+)
+
+// Qualifiers for spouse edges
+const (
+	SpouseMarried  = "married"
+	SpousePartner  = "partner"
+	SpouseDivorced = "divorced"
+)
+
+// Relationship is a single edge of the family graph. Every connection is
+// stored exactly once; both persons' views are derived from it.
+type Relationship struct {
+	ID              string           `gorm:"primaryKey" json:"id"`
+	FamilyTreeID    string           `gorm:"index" json:"familyTreeId"`
+	PersonID        string           `gorm:"index" json:"personId"`
+	RelatedPersonID string           `gorm:"index" json:"relatedPersonId"`
+	Type            RelationshipType `gorm:"index" json:"type"`
+	Qualifier       string           `json:"qualifier"` // biological/adoptive/step/foster or married/partner/divorced
+	StartDate       *time.Time       `json:"startDate,omitempty"`
+	EndDate         *time.Time       `json:"endDate,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+	DeletedAt       gorm.DeletedAt   `gorm:"index" json:"-"`
+}
+
+// Involves reports whether the edge touches the given person
+func (r *Relationship) Involves(personID string) bool {
+	return r.PersonID == personID || r.RelatedPersonID == personID
+}
+
+// Other returns the person on the opposite end of the edge
+func (r *Relationship) Other(personID string) string {
+	if r.PersonID == personID {
+		return r.RelatedPersonID
+	}
+	return r.PersonID
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one signed-in device using local auth. The refresh token is
+// rotated on every use and only its hash is stored.
+type Session struct {
+	ID                string     `gorm:"primaryKey" json:"id"`
+	UserID            string     `gorm:"index" json:"userId"`
+	RefreshTokenHash  string     `gorm:"uniqueIndex" json:"-"`
+	PreviousTokenHash string     `gorm:"index" json:"-"` // Detects reuse of a rotated token
+	DeviceName        string     `json:"deviceName"`
+	UserAgent         string     `json:"userAgent"`
+	IPAddress         string     `json:"ipAddress"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	LastUsedAt        time.Time  `json:"lastUsedAt"`
+	ExpiresAt         time.Time  `json:"expiresAt"`
+	RevokedAt         *time.Time `json:"revokedAt,omitempty"`
+	MFAVerifiedAt     *time.Time `json:"mfaVerifiedAt,omitempty"` // Last second-factor check on this device
+}
+
+// IsActive reports whether the session can still be refreshed
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Source is a document evidence comes from: a certificate, a census page, a
+// book or an interview
+type Source struct {
+	ID           string         `gorm:"primaryKey" json:"id"`
+	FamilyTreeID string         `gorm:"index" json:"familyTreeId"`
+	Title        string         `json:"title"`
+	Author       string         `json:"author"`
+	Repository   string         `json:"repository"` // Where the original is kept, e.g. an archive
+	URL          string         `json:"url"`
+	DocumentURL  string         `json:"documentUrl"` // An uploaded scan
+	CreatedBy    string         `json:"createdBy"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// CitationFact is the kind of fact a citation supports
+type CitationFact string
+
+const (
+	CitationPerson       CitationFact = "person" // The person as a whole, such as their name
+	CitationBirthDate    CitationFact = "birthDate"
+	CitationDeathDate    CitationFact = "deathDate"
+	CitationLifeEvent    CitationFact = "lifeEvent"
+	CitationRelationship CitationFact = "relationship"
+)
+
+// CitationConfidence follows the GEDCOM QUAY scale
+type CitationConfidence string
+
+const (
+	ConfidenceUnreliable   CitationConfidence = "unreliable"   // QUAY 0
+	ConfidenceQuestionable CitationConfidence = "questionable" // QUAY 1
+	ConfidenceSecondary    CitationConfidence = "secondary"    // QUAY 2
+	ConfidencePrimary      CitationConfidence = "primary"      // QUAY 3, direct evidence
+)
+
+// Citation ties a source to one fact. PersonID is set for every fact about a
+// person, LifeEventID for life events and RelationshipID for edges.
+type Citation struct {
+	ID             string             `gorm:"primaryKey" json:"id"`
+	FamilyTreeID   string             `gorm:"index" json:"familyTreeId"`
+	SourceID       string             `gorm:"index" json:"sourceId"`
+	Fact           CitationFact       `json:"fact"`
+	PersonID       string             `gorm:"index" json:"personId,omitempty"`
+	LifeEventID    string             `json:"lifeEventId,omitempty"`
+	RelationshipID string             `gorm:"index" json:"relationshipId,omitempty"`
+	Page           string             `json:"page"` // Where in the source, e.g. "p. 12, entry 4"
+	Confidence     CitationConfidence `json:"confidence,omitempty"`
+	Note           string             `json:"note"`
+	Source         *Source            `gorm:"-" json:"source,omitempty"`
+	CreatedBy      string             `json:"createdBy"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt     `gorm:"index" json:"-"`
+}
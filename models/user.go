@@ -15,16 +15,19 @@ const (
 )
 
 type User struct {
-	ID           string         `gorm:"primaryKey" json:"id"`
-	Email        string         `gorm:"uniqueIndex" json:"email"`
-	Password     string         `json:"-"` // Don't return password in JSON
-	Name         string         `json:"name"`
-	Role         UserRole       `gorm:"default:member" json:"role"`
-	IsVerified   bool           `gorm:"default:false" json:"isVerified"`
-	FamilyTreeID string         `json:"familyTreeId"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            string         `gorm:"primaryKey" json:"id"`
+	Email         string         `gorm:"uniqueIndex" json:"email"`
+	Password      string         `json:"-"` // Don't return password in JSON
+	Name          string         `json:"name"`
+	Role          UserRole       `gorm:"default:member" json:"role"`
+	IsVerified    bool           `gorm:"default:false" json:"isVerified"` // Linked to a person by an admin or invitation
+	EmailVerified bool           `gorm:"default:false" json:"emailVerified"`
+	MFAEnabled    bool           `gorm:"default:false" json:"mfaEnabled"`
+	FirebaseUID   *string        `gorm:"uniqueIndex" json:"-"` // Set when a local account first signs in with Firebase
+	FamilyTreeID  string         `json:"familyTreeId"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // IsAdmin checks if user has admin role
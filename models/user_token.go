@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// UserTokenPurpose is what a UserToken can be used for
+type UserTokenPurpose string
+
+const (
+	TokenVerifyEmail   UserTokenPurpose = "verify_email"
+	TokenResetPassword UserTokenPurpose = "reset_password"
+)
+
+// UserToken is a single-use, expiring token sent by email. Only its hash is
+// stored.
+type UserToken struct {
+	ID        string           `gorm:"primaryKey" json:"id"`
+	UserID    string           `gorm:"index" json:"userId"`
+	Purpose   UserTokenPurpose `gorm:"index" json:"purpose"`
+	TokenHash string           `gorm:"uniqueIndex" json:"-"`
+	Email     string           `json:"email"` // Address the token was sent to
+	ExpiresAt time.Time        `json:"expiresAt"`
+	UsedAt    *time.Time       `json:"usedAt,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
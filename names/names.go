@@ -0,0 +1,234 @@
+// Package names compares personal names across spellings. Arabic names
+// are written many ways in Latin script (Mohammed, Muhammad, Mohamed) and
+// also appear in Arabic script, so names are reduced to a consonant
+// skeleton before comparing.
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+// arabicLetters transliterates Arabic script to the Latin letters most
+// romanizations use. Alef and ain become vowels, so they only count at the
+// start of a name.
+var arabicLetters = map[rune]string{
+	'ا': "a", 'أ': "a", 'إ': "a", 'آ': "a", 'ٱ': "a", 'ى': "a", 'ع': "a",
+	'ب': "b", 'ت': "t", 'ث': "th", 'ج': "j", 'ح': "h", 'خ': "kh",
+	'د': "d", 'ذ': "dh", 'ر': "r", 'ز': "z", 'س': "s", 'ش': "sh",
+	'ص': "s", 'ض': "d", 'ط': "t", 'ظ': "z", 'غ': "gh", 'ف': "f",
+	'ق': "q", 'ك': "k", 'ل': "l", 'م': "m", 'ن': "n", 'ه': "h",
+	'ة': "a", 'و': "w", 'ي': "y", 'ئ': "y", 'ؤ': "w", 'ء': "",
+	'پ': "p", 'چ': "ch", 'ڤ': "v", 'گ': "g", 'ی': "y", 'ک': "k",
+}
+
+// latinAccents folds the accented letters found in romanized names
+var latinAccents = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ā': 'a', 'ã': 'a',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'ō': 'o', 'õ': 'o',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u',
+	'ç': 'c', 'ñ': 'n', 'ṣ': 's', 'ḥ': 'h', 'ṭ': 't', 'ḍ': 'd', 'ẓ': 'z',
+}
+
+// Normalize lowercases a name, transliterates Arabic script and drops
+// accents, diacritics and punctuation. Words are separated by single spaces.
+func Normalize(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case arabicLetters[r] != "" || r == 'ء':
+			b.WriteString(arabicLetters[r])
+			space = false
+		case latinAccents[r] != 0:
+			b.WriteRune(latinAccents[r])
+			space = false
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+			space = false
+		case r == '-' || r == '\'' || r == '’' || r == 'ʿ' || r == 'ʾ' || unicode.Is(unicode.Mn, r) || r == 'ـ':
+			// Joiners, apostrophes for ain/hamza, harakat and tatweel
+		case unicode.IsSpace(r) || unicode.IsPunct(r):
+			if !space && b.Len() > 0 {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Latin spellings of the same Arabic sound
+var digraphs = strings.NewReplacer(
+	"kh", "k", "gh", "g", "sh", "s", "th", "t", "dh", "d", "ph", "f",
+	"q", "k", "ck", "k", "c", "k", "x", "ks", "z", "s", "j", "g",
+)
+
+// Skeleton reduces one word of a name to its consonants so spellings that
+// differ only in vowels match: Mohammed, Muhammad and محمد are all "mhmd".
+// A leading vowel is kept as "a" since Omar and Umar are the same name.
+func Skeleton(word string) string {
+	word = strings.ReplaceAll(Normalize(word), " ", "")
+	// A final h after a vowel is usually ta marbuta (Fatimah, Fatima), but
+	// not in Allah
+	if n := len(word); n > 2 && word[n-1] == 'h' && isVowel(rune(word[n-2])) && !strings.HasSuffix(word, "llah") {
+		word = word[:n-1]
+	}
+	word = digraphs.Replace(word)
+
+	var b strings.Builder
+	var last rune
+	for i, r := range word {
+		if isVowel(r) || (i > 0 && (r == 'w' || r == 'y')) {
+			if i == 0 {
+				b.WriteRune('a')
+				last = 'a'
+			}
+			continue
+		}
+		if r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+func isVowel(r rune) bool {
+	return r == 'a' || r == 'e' || r == 'i' || r == 'o' || r == 'u'
+}
+
+// Words splits a name into skeletons. The article al/el is dropped, whether
+// written separately or not, so Al-Hassan, Alhassan, Hassan and الحسن match;
+// after "abd" it is kept ("Abd al Rahman" matches "Abdulrahman").
+func Words(name string) []string {
+	var words []string
+	for _, w := range strings.Fields(Normalize(name)) {
+		if w == "al" || w == "el" || w == "ul" {
+			if len(words) > 0 {
+				words[len(words)-1] += "l"
+			}
+			continue
+		}
+		s := Skeleton(w)
+		// Ali and Alaa are names, not articles
+		if len(s) > 3 && strings.HasPrefix(s, "al") && s != "abdl" {
+			s = s[2:]
+		}
+		if s != "" {
+			words = append(words, s)
+		}
+	}
+	return joinCompounds(words)
+}
+
+// joinCompounds writes "abd" names as one word with a single article, since
+// Abdullah, Abd Allah and Abdul Rahman, Abd al-Rahman are equally common
+func joinCompounds(words []string) []string {
+	out := words[:0]
+	for i := 0; i < len(words); i++ {
+		if (words[i] == "abd" || words[i] == "abdl") && i+1 < len(words) {
+			out = append(out, "abdl"+strings.TrimPrefix(strings.TrimPrefix(words[i+1], "al"), "a"))
+			i++
+			continue
+		}
+		out = append(out, words[i])
+	}
+	return out
+}
+
+// Similarity scores two names from 0 (unrelated) to 1 (same name up to
+// spelling). Each word is matched to its closest counterpart, so word order
+// and a missing middle name only lower the score a little.
+func Similarity(a, b string) float64 {
+	wa, wb := Words(a), Words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+
+	used := make([]bool, len(wb))
+	total := 0.0
+	for _, x := range wa {
+		best, bestIdx := 0.0, -1
+		for j, y := range wb {
+			if used[j] {
+				continue
+			}
+			if s := wordSimilarity(x, y); s > best {
+				best, bestIdx = s, j
+			}
+		}
+		if bestIdx >= 0 {
+			used[bestIdx] = true
+		}
+		total += best
+	}
+	// Unmatched extra words count half against the score
+	return total / (float64(len(wa)) + float64(len(wb)-len(wa))/2)
+}
+
+func wordSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	// Matching skeletons are a strong signal; near misses less so
+	return 0.9 * JaroWinkler(a, b)
+}
+
+// JaroWinkler is the Jaro-Winkler similarity of two strings, from 0 to 1
+func JaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
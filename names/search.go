@@ -0,0 +1,87 @@
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+// arabicForms unifies the letters Arabic spelling varies on: hamza seats
+// and madda on alef, alef maqsura and ya, ta marbuta and ha
+var arabicForms = map[rune]rune{
+	'أ': 'ا', 'إ': 'ا', 'آ': 'ا', 'ٱ': 'ا',
+	'ى': 'ي', 'ئ': 'ي', 'ؤ': 'و', 'ة': 'ه',
+}
+
+// Fold lowercases a name and drops diacritics without transliterating, so
+// Arabic stays in Arabic script: tashkeel and tatweel are removed and
+// alef, ya and ta marbuta forms unified. Words are separated by single
+// spaces.
+func Fold(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case arabicForms[r] != 0:
+			b.WriteRune(arabicForms[r])
+			space = false
+		case latinAccents[r] != 0:
+			b.WriteRune(latinAccents[r])
+			space = false
+		case r == 'ـ' || r == '\'' || r == '’' || r == 'ʿ' || r == 'ʾ' || unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		default:
+			if !space && b.Len() > 0 {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// SearchText is the text a name is searched by: its folded words, their
+// Latin transliteration and their skeletons, each once. It starts with a
+// space so "% word%" matches the start of any word.
+func SearchText(name string) string {
+	seen := map[string]bool{}
+	var b strings.Builder
+	add := func(words ...string) {
+		for _, w := range words {
+			if w != "" && !seen[w] {
+				seen[w] = true
+				b.WriteByte(' ')
+				b.WriteString(w)
+			}
+		}
+	}
+	add(strings.Fields(Fold(name))...)
+	add(strings.Fields(Normalize(name))...)
+	add(Words(name)...)
+	return b.String()
+}
+
+// QueryTerms returns the spellings to look for a word of a search query
+// under: as typed (folded), transliterated, and, for words long enough to
+// sound like a name, its skeleton
+func QueryTerms(word string) []string {
+	var terms []string
+	add := func(t string) {
+		if t == "" {
+			return
+		}
+		for _, existing := range terms {
+			if existing == t {
+				return
+			}
+		}
+		terms = append(terms, t)
+	}
+	add(strings.ReplaceAll(Fold(word), " ", ""))
+	add(strings.ReplaceAll(Normalize(word), " ", ""))
+	if skeletons := Words(word); len(skeletons) == 1 && len(skeletons[0]) >= 3 {
+		add(skeletons[0])
+	}
+	return terms
+}
@@ -0,0 +1,210 @@
+// Package pagination pages, filters and sorts list endpoints. Pages are
+// keyset-based: a cursor names the last row of the previous page, so pages
+// stay stable while rows are added and deep pages cost no more than the
+// first.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorSort    = errors.New("cursor belongs to a different sort")
+)
+
+// Spec describes what a list endpoint can be sorted and filtered by. Query
+// parameters and sort names use the JSON field names; the maps give their
+// columns.
+type Spec struct {
+	Sorts        map[string]string // Sort name to column, e.g. "createdAt": "created_at"
+	DefaultSort  string            // A sort name, "-" prefixed for newest or last first
+	TimeColumn   string            // Column since and until apply to, if any
+	Filters      map[string]string // Query parameter to column, matched exactly
+	DefaultLimit int               // Zero for DefaultLimit
+	MaxLimit     int               // Zero for MaxLimit
+}
+
+// Params is a parsed page request
+type Params struct {
+	Limit      int
+	sort       string
+	column     string
+	desc       bool
+	afterID    string
+	timeColumn string
+	since      *time.Time
+	until      *time.Time
+	filters    map[string]string
+}
+
+// Page is one page of a list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor is the decoded form of a page cursor
+type cursor struct {
+	Sort string `json:"s"`
+	ID   string `json:"id"`
+}
+
+// Parse reads limit, cursor, sort, since, until and the spec's filters from
+// the query string
+func Parse(c *gin.Context, spec Spec) (Params, error) {
+	p := Params{Limit: spec.DefaultLimit, filters: map[string]string{}}
+	if p.Limit == 0 {
+		p.Limit = DefaultLimit
+	}
+	maxLimit := spec.MaxLimit
+	if maxLimit == 0 {
+		maxLimit = MaxLimit
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		p.Limit = limit
+	}
+
+	p.sort = c.DefaultQuery("sort", spec.DefaultSort)
+	name := strings.TrimPrefix(p.sort, "-")
+	column, ok := spec.Sorts[name]
+	if !ok {
+		return p, fmt.Errorf("sort must be one of %s, with - for descending", strings.Join(sortNames(spec), ", "))
+	}
+	p.column, p.desc = column, strings.HasPrefix(p.sort, "-")
+
+	if raw := c.Query("cursor"); raw != "" {
+		var cur cursor
+		data, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil || json.Unmarshal(data, &cur) != nil || cur.ID == "" {
+			return p, ErrInvalidCursor
+		}
+		if cur.Sort != p.sort {
+			return p, ErrCursorSort
+		}
+		p.afterID = cur.ID
+	}
+
+	for param, bound := range map[string]**time.Time{"since": &p.since, "until": &p.until} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		if spec.TimeColumn == "" {
+			return p, fmt.Errorf("%s is not supported here", param)
+		}
+		t, err := parseTime(raw)
+		if err != nil {
+			return p, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", param)
+		}
+		*bound = &t
+	}
+	p.timeColumn = spec.TimeColumn
+
+	for param, column := range spec.Filters {
+		if value, ok := c.GetQuery(param); ok {
+			p.filters[column] = value
+		}
+	}
+	return p, nil
+}
+
+// IsDefault reports whether p asks for the first page with no filters and
+// the default sort and limit, the page worth caching
+func (p Params) IsDefault(spec Spec) bool {
+	limit := spec.DefaultLimit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	return p.Limit == limit && p.sort == spec.DefaultSort && p.afterID == "" &&
+		p.since == nil && p.until == nil && len(p.filters) == 0
+}
+
+// Find loads one page of query into a Page. query should already be scoped
+// to the rows the caller may see; id returns a row's primary key.
+func Find[T any](query *gorm.DB, p Params, id func(T) string) (Page[T], error) {
+	var zero T
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(&zero); err != nil {
+		return Page[T]{}, err
+	}
+	table := stmt.Schema.Table
+
+	query = query.Model(&zero)
+	for column, value := range p.filters {
+		query = query.Where(column+" = ?", value)
+	}
+	if p.since != nil {
+		query = query.Where(p.timeColumn+" >= ?", *p.since)
+	}
+	if p.until != nil {
+		query = query.Where(p.timeColumn+" < ?", *p.until)
+	}
+
+	direction, compare := "ASC", ">"
+	if p.desc {
+		direction, compare = "DESC", "<"
+	}
+	if p.afterID != "" {
+		// Rows after the cursor's in (column, id) order. The cursor row is
+		// read without the soft-delete scope, so deleting it doesn't lose
+		// the position.
+		query = query.Where(
+			fmt.Sprintf("(%s, id) %s (SELECT %s, id FROM %s WHERE id = ?)", p.column, compare, p.column, table),
+			p.afterID,
+		)
+	}
+
+	var items []T
+	err := query.Order(p.column + " " + direction).Order("id " + direction).
+		Limit(p.Limit + 1).Find(&items).Error
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	page := Page[T]{Items: items}
+	if len(items) > p.Limit {
+		page.Items = items[:p.Limit]
+		data, _ := json.Marshal(cursor{Sort: p.sort, ID: id(page.Items[p.Limit-1])})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page, nil
+}
+
+func parseTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+func sortNames(spec Spec) []string {
+	names := make([]string, 0, len(spec.Sorts))
+	for name := range spec.Sorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
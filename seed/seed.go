@@ -6,7 +6,9 @@ import (
 	"math/rand"
 	"time"
 
+	"family-tree-backend/gendate"
 	"family-tree-backend/models"
+	"family-tree-backend/services"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -44,14 +46,23 @@ func SeedDatabase(db *gorm.DB) {
 	log.Println("🌱 Seeding Mohammed's family tree (100 persons)...")
 
 	// Run migrations first
-	db.AutoMigrate(&models.Person{}, &models.User{})
+	db.AutoMigrate(&models.Person{}, &models.User{}, &models.Relationship{}, &models.FamilyTree{}, &models.TreeMembership{})
 
 	// Clear existing data (ignore errors if table doesn't exist)
+	db.Exec("DELETE FROM relationships WHERE 1=1")
 	db.Exec("DELETE FROM people WHERE 1=1")
 
 	rand.Seed(time.Now().UnixNano())
 
 	familyTreeID := "main-family-tree"
+	db.Exec("DELETE FROM family_trees WHERE id = ?", familyTreeID)
+	db.Create(&models.FamilyTree{
+		ID:        familyTreeID,
+		Name:      "Mohammed's Family",
+		IsPublic:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
 	allPersons := make([]models.Person, 0, 100)
 
 	// ==========================================
@@ -140,11 +151,29 @@ func SeedDatabase(db *gorm.DB) {
 
 	// Save all persons to database
 	for i, person := range allPersons {
+		person.SearchText = services.PersonSearchText(&person)
 		if err := db.Create(&person).Error; err != nil {
 			log.Printf("Error creating person %d: %v", i, err)
 		}
 	}
 
+	// Store each parent-child link once as a relationship edge
+	for _, person := range allPersons {
+		for _, childID := range person.Relationships.ChildrenIDs {
+			edge := models.Relationship{
+				ID:              uuid.New().String(),
+				FamilyTreeID:    familyTreeID,
+				PersonID:        person.ID,
+				RelatedPersonID: childID,
+				Type:            models.RelationshipParentChild,
+				Qualifier:       models.ParentBiological,
+			}
+			if err := db.Create(&edge).Error; err != nil {
+				log.Printf("Error creating relationship %s -> %s: %v", person.ID, childID, err)
+			}
+		}
+	}
+
 	// Create a default admin user
 	adminUser := models.User{
 		ID:    "admin-default",
@@ -170,7 +199,7 @@ func createMalePerson(firstName string, birthYear int, familyTreeID string) mode
 	birthDate := parseDate(fmt.Sprintf("%d-%02d-%02d", birthYear, birthMonth, birthDay))
 
 	// Older generations may have passed
-	var deathDate *time.Time
+	var deathDate *gendate.Date
 	if birthYear < 1960 && rand.Float32() > 0.5 {
 		deathYear := birthYear + 60 + rand.Intn(25)
 		if deathYear <= time.Now().Year() {
@@ -190,7 +219,7 @@ func createMalePerson(firstName string, birthYear int, familyTreeID string) mode
 	}
 }
 
-func parseDate(dateStr string) *time.Time {
-	t, _ := time.Parse("2006-01-02", dateStr)
-	return &t
+func parseDate(dateStr string) *gendate.Date {
+	d, _ := gendate.Parse(dateStr)
+	return d
 }
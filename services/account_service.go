@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-tree-backend/auth"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	VerifyEmailTTL   = 48 * time.Hour
+	ResetPasswordTTL = time.Hour
+	// tokenResendDelay stops repeated clicks from flooding an inbox
+	tokenResendDelay = 2 * time.Minute
+)
+
+var (
+	ErrTokenInvalid   = errors.New("link is invalid or has expired")
+	ErrTokenTooRecent = errors.New("an email was sent recently; please check your inbox")
+)
+
+// IssueUserToken creates a token for purpose and returns it for emailing.
+// Earlier unused tokens for the same purpose stop working.
+func IssueUserToken(db *gorm.DB, user *models.User, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	var recent int64
+	if err := db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL AND created_at > ?", user.ID, purpose, time.Now().Add(-tokenResendDelay)).
+		Count(&recent).Error; err != nil {
+		return "", err
+	}
+	if recent > 0 {
+		return "", ErrTokenTooRecent
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			ID:        uuid.New().String(),
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hash,
+			Email:     user.Email,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a token used and returns it. It must be called in a
+// transaction so the token can't be used twice concurrently.
+func consumeUserToken(tx *gorm.DB, token string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var ut models.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", auth.HashToken(token), purpose).
+		First(&ut).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if ut.UsedAt != nil || !now.Before(ut.ExpiresAt) {
+		return nil, ErrTokenInvalid
+	}
+	ut.UsedAt = &now
+	if err := tx.Model(&ut).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &ut, nil
+}
+
+// VerifyEmail confirms the address a verification token was sent to. A token
+// sent before the user changed their email no longer counts.
+func VerifyEmail(db *gorm.DB, token string) (*models.User, error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		ut, err := consumeUserToken(tx, token, models.TokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, "id = ?", ut.UserID).Error; err != nil {
+			return ErrTokenInvalid
+		}
+		if user.Email != ut.Email {
+			return ErrTokenInvalid
+		}
+		user.EmailVerified = true
+		return tx.Model(&user).Update("email_verified", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResetPassword sets a new password hash and signs the user out everywhere.
+// Receiving the email also proves the address, so it is marked verified.
+func ResetPassword(db *gorm.DB, token, passwordHash string) (*models.User, error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		ut, err := consumeUserToken(tx, token, models.TokenResetPassword)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, "id = ?", ut.UserID).Error; err != nil {
+			return ErrTokenInvalid
+		}
+		if user.Email != ut.Email {
+			return ErrTokenInvalid
+		}
+
+		user.Password = passwordHash
+		user.EmailVerified = true
+		user.UpdatedAt = time.Now()
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":       user.Password,
+			"email_verified": true,
+			"updated_at":     user.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Other reset links are void once the password has changed
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenResetPassword).
+			Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+		_, err = RevokeAllSessions(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"family-tree-backend/chart"
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+)
+
+// chartPhotoSize is the side of the square thumbnails charts embed
+const chartPhotoSize = 128
+
+// maxChartPhotoPixels keeps a photo declaring huge dimensions from
+// allocating gigabytes when decoded
+const maxChartPhotoPixels = 32 << 20
+
+// ChartOptions says what goes on a chart
+type ChartOptions struct {
+	Kind      chart.Kind
+	Depth     int
+	Photos    bool
+	Dates     bool
+	Collapsed map[string]bool // Persons whose branch is folded away
+}
+
+// BuildChart turns the pedigree or descendants of a person into the tree a
+// chart lays out. Descendants are shown with their spouses beside them and
+// children in birth order; pedigrees list fathers before mothers. Branches
+// cut off by the depth or collapsed on request count the persons left out.
+// The graph should already be redacted for the viewer.
+func (g *FamilyGraph) BuildChart(rootID string, opts ChartOptions) *chart.Node {
+	up := opts.Kind == chart.Pedigree
+	var tree *TreeNode
+	if up {
+		tree = g.AncestorTree(rootID, opts.Depth)
+	} else {
+		tree = g.DescendantTree(rootID, opts.Depth)
+	}
+	if tree == nil {
+		return nil
+	}
+
+	photos := map[string]image.Image{}
+	person := func(p *models.Person) chart.Person {
+		cp := chart.Person{ID: p.ID, Name: strings.TrimSpace(p.FirstName + " " + p.LastName), Gender: p.Gender}
+		if cp.Name == "" {
+			cp.Name = "Unknown"
+		}
+		if opts.Dates {
+			cp.Dates = lifespan(p)
+		}
+		if opts.Photos && p.ProfilePhotoURL != "" {
+			if _, loaded := photos[p.ProfilePhotoURL]; !loaded {
+				photos[p.ProfilePhotoURL] = chartPhoto(p.ProfilePhotoURL)
+			}
+			cp.Photo = photos[p.ProfilePhotoURL]
+		}
+		return cp
+	}
+	hidden := func(id string) int {
+		if up {
+			return len(g.Ancestors(id, MaxTraversalDepth))
+		}
+		return len(g.Descendants(id, MaxTraversalDepth))
+	}
+
+	var convert func(t *TreeNode) *chart.Node
+	convert = func(t *TreeNode) *chart.Node {
+		node := &chart.Node{Person: person(t.Person)}
+		next := t.Children
+		if up {
+			next = t.Parents
+		} else {
+			for _, id := range g.SpouseIDs(t.Person.ID) {
+				if spouse := g.Persons[id]; spouse != nil {
+					node.Spouses = append(node.Spouses, person(spouse))
+				}
+			}
+		}
+
+		switch {
+		case t.Repeated:
+			// Drawn in full elsewhere on the chart
+		case opts.Collapsed[t.Person.ID] && t.Generation > 0:
+			node.Hidden = hidden(t.Person.ID)
+		case len(next) == 0:
+			if t.Generation >= opts.Depth {
+				node.Hidden = hidden(t.Person.ID)
+			}
+		default:
+			sortChartGeneration(next, up)
+			for _, n := range next {
+				node.Next = append(node.Next, convert(n))
+			}
+		}
+		return node
+	}
+	return convert(tree)
+}
+
+// sortChartGeneration orders parents father first and children by birth,
+// keeping the edge order where that doesn't decide
+func sortChartGeneration(nodes []*TreeNode, up bool) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].Person, nodes[j].Person
+		if up {
+			return a.Gender == "male" && b.Gender != "male"
+		}
+		if a.BirthDate.IsZero() || b.BirthDate.IsZero() {
+			return false
+		}
+		return a.BirthDate.Time().Before(b.BirthDate.Time())
+	})
+}
+
+// lifespan is the years a person lived, e.g. "1920 - 1994", "b. c. 1890"
+func lifespan(p *models.Person) string {
+	birth, death := chartYear(p.BirthDate), chartYear(p.DeathDate)
+	switch {
+	case birth != "" && death != "":
+		return birth + " - " + death
+	case birth != "":
+		return "b. " + birth
+	case death != "":
+		return "d. " + death
+	}
+	return ""
+}
+
+// chartYear shortens a date to its Gregorian year with a qualifier
+func chartYear(d *gendate.Date) string {
+	if d.IsZero() {
+		return ""
+	}
+	d = d.InCalendar(gendate.Gregorian)
+	switch d.Qualifier {
+	case gendate.About:
+		return fmt.Sprintf("c. %d", d.Start.Year)
+	case gendate.Before:
+		return fmt.Sprintf("bef. %d", d.Start.Year)
+	case gendate.After:
+		return fmt.Sprintf("aft. %d", d.Start.Year)
+	case gendate.Between:
+		if d.End.Year != d.Start.Year {
+			return fmt.Sprintf("%d/%d", d.Start.Year, d.End.Year)
+		}
+	}
+	return fmt.Sprintf("%d", d.Start.Year)
+}
+
+// chartPhoto loads an uploaded profile photo as a square thumbnail. Only
+// files in the uploads directory are read; photos hosted elsewhere, or
+// that fail to decode or are larger than maxChartPhotoPixels, are left out.
+func chartPhoto(url string) image.Image {
+	if !strings.HasPrefix(url, "/uploads/") {
+		return nil
+	}
+	f, err := os.Open(filepath.Join("uploads", filepath.Base(url)))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil || config.Width*config.Height > maxChartPhotoPixels {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil
+	}
+
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	if side == 0 {
+		return nil
+	}
+	ox, oy := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	size := min(side, chartPhotoSize)
+	thumb := image.NewRGBA(image.Rect(0, 0, size, size))
+	if size == side {
+		draw.Draw(thumb, thumb.Bounds(), img, image.Pt(ox, oy), draw.Src)
+		return thumb
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			thumb.Set(x, y, img.At(ox+x*side/size, oy+y*side/size))
+		}
+	}
+	return thumb
+}
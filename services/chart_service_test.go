@@ -0,0 +1,59 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngDeclaring encodes a small image, then rewrites its header to declare
+// the given dimensions
+func pngDeclaring(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Signature (8), then the IHDR chunk: length (4), type (4), data (13), CRC (4)
+	ihdr := data[16:29]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestChartPhoto(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("uploads", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewGray(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"small.png": small.Bytes(),
+		"huge.png":  pngDeclaring(t, 100000, 100000),
+		"text.png":  []byte("not an image"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join("uploads", name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if img := chartPhoto("/uploads/small.png"); img == nil || img.Bounds().Dx() != chartPhotoSize || img.Bounds().Dy() != chartPhotoSize {
+		t.Errorf("small photo: got %v, want a %dpx square", img, chartPhotoSize)
+	}
+	for _, url := range []string{"/uploads/huge.png", "/uploads/text.png", "/uploads/missing.png", "https://example.com/small.png"} {
+		if img := chartPhoto(url); img != nil {
+			t.Errorf("chartPhoto(%q) = %v, want nil", url, img.Bounds())
+		}
+	}
+}
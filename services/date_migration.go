@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// MigratePersonDates converts birth and death dates from timestamp columns to
+// the text form gendate stores, "<sort day> <date>", keeping the day. It runs
+// before AutoMigrate, which would otherwise cast with the session's time
+// zone, and does nothing once the columns are text.
+func MigratePersonDates(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Person{}) {
+		return nil
+	}
+	columns, err := db.Migrator().ColumnTypes(&models.Person{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		name := column.Name()
+		if name != "birth_date" && name != "death_date" {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(column.DatabaseTypeName()), "timestamp") {
+			continue
+		}
+		day := fmt.Sprintf("to_char(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD')", name)
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE people ALTER COLUMN %s TYPE text USING %s || ' ' || %s", name, day, day)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPersonReferenced  = errors.New("person is still referenced; detach or reassign first")
+	ErrInvalidDeleteMode = errors.New("mode must be detach, reassign or refuse")
+	ErrNothingToRestore  = errors.New("person is not deleted")
+)
+
+// DeleteOptions choose how a person's references are handled
+type DeleteOptions struct {
+	Mode       models.DeleteMode
+	ReassignTo string // The children's new parent, for DeleteReassign
+}
+
+// DeletionPlan lists everything deleting a person touches
+type DeletionPlan struct {
+	Person       models.Person         `json:"person"`
+	Mode         models.DeleteMode     `json:"mode"`
+	Detached     []models.Relationship `json:"detachedRelationships"`
+	Reassigned   []models.Relationship `json:"reassignedRelationships"` // As they will be after the delete
+	LinkRequests []models.LinkRequest  `json:"linkRequests"`
+	Invitations  []models.Invitation   `json:"invitations"`
+	LinkedUserID string                `json:"linkedUserId,omitempty"`
+}
+
+// Referenced reports whether anything points at the person
+func (p *DeletionPlan) Referenced() bool {
+	return len(p.Detached) > 0 || len(p.Reassigned) > 0 || len(p.LinkRequests) > 0 ||
+		len(p.Invitations) > 0 || p.LinkedUserID != ""
+}
+
+// PlanPersonDeletion works out what deleting a person would change without
+// changing anything
+func PlanPersonDeletion(db *gorm.DB, treeID, personID string, opts DeleteOptions) (*DeletionPlan, error) {
+	switch opts.Mode {
+	case "":
+		opts.Mode = models.DeleteDetach
+	case models.DeleteDetach, models.DeleteRefuse:
+	case models.DeleteReassign:
+		if opts.ReassignTo == "" || opts.ReassignTo == personID {
+			return nil, fmt.Errorf("%w: reassign needs another parent in reassignTo", ErrInvalidDeleteMode)
+		}
+	default:
+		return nil, ErrInvalidDeleteMode
+	}
+
+	plan := &DeletionPlan{
+		Mode:         opts.Mode,
+		Detached:     []models.Relationship{},
+		Reassigned:   []models.Relationship{},
+		LinkRequests: []models.LinkRequest{},
+		Invitations:  []models.Invitation{},
+	}
+	if err := db.First(&plan.Person, "id = ? AND family_tree_id = ?", personID, treeID).Error; err != nil {
+		return nil, ErrPersonNotFound
+	}
+	plan.LinkedUserID = plan.Person.AuthUserID
+
+	var edges []models.Relationship
+	if err := db.Where("person_id = ? OR related_person_id = ?", personID, personID).Order("created_at").Find(&edges).Error; err != nil {
+		return nil, err
+	}
+
+	if opts.Mode == models.DeleteReassign {
+		var parent models.Person
+		if err := db.First(&parent, "id = ? AND family_tree_id = ?", opts.ReassignTo, treeID).Error; err != nil {
+			return nil, fmt.Errorf("%w: new parent not found", ErrPersonNotFound)
+		}
+	}
+
+	for _, e := range edges {
+		if opts.Mode == models.DeleteReassign && e.Type == models.RelationshipParentChild &&
+			e.PersonID == personID && e.RelatedPersonID != opts.ReassignTo {
+			moved := e
+			moved.PersonID = opts.ReassignTo
+			exists, err := relationshipExists(db, &moved)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				cyclic, err := isAncestor(db, moved.RelatedPersonID, moved.PersonID)
+				if err != nil {
+					return nil, err
+				}
+				if cyclic {
+					return nil, ErrRelationshipCycle
+				}
+				plan.Reassigned = append(plan.Reassigned, moved)
+				continue
+			}
+		}
+		plan.Detached = append(plan.Detached, e)
+	}
+
+	if err := db.Where("person_id = ? AND status = ?", personID, models.LinkStatusPending).Find(&plan.LinkRequests).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("person_id = ? AND revoked_at IS NULL AND expires_at > ?", personID, time.Now()).Find(&plan.Invitations).Error; err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// DeletePerson soft-deletes a person after detaching or reassigning their
+// edges, rejecting pending link requests, unbinding invitations and
+// removing the account link. In refuse mode a referenced person is not
+// deleted and the plan is returned with ErrPersonReferenced.
+func DeletePerson(db *gorm.DB, treeID, personID string, opts DeleteOptions, actorID string) (*models.PersonDeletion, *DeletionPlan, error) {
+	var deletion *models.PersonDeletion
+	var plan *DeletionPlan
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var person models.Person
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&person, "id = ? AND family_tree_id = ?", personID, treeID).Error; err != nil {
+			return ErrPersonNotFound
+		}
+
+		var err error
+		plan, err = PlanPersonDeletion(tx, treeID, personID, opts)
+		if err != nil {
+			return err
+		}
+		if plan.Mode == models.DeleteRefuse && plan.Referenced() {
+			return ErrPersonReferenced
+		}
+
+		now := time.Now()
+		deletion = &models.PersonDeletion{
+			ID:                        uuid.New().String(),
+			FamilyTreeID:              treeID,
+			PersonID:                  personID,
+			Mode:                      plan.Mode,
+			DeletedBy:                 actorID,
+			AuthUserID:                plan.LinkedUserID,
+			DetachedRelationshipIDs:   models.JSONStringArray{},
+			ReassignedRelationshipIDs: models.JSONStringArray{},
+			LinkRequestIDs:            models.JSONStringArray{},
+			InvitationIDs:             models.JSONStringArray{},
+			CreatedAt:                 now,
+		}
+
+		for i := range plan.Detached {
+			if err := tx.Delete(&plan.Detached[i]).Error; err != nil {
+				return err
+			}
+			deletion.DetachedRelationshipIDs = append(deletion.DetachedRelationshipIDs, plan.Detached[i].ID)
+		}
+		if len(plan.Reassigned) > 0 {
+			deletion.ReassignedTo = opts.ReassignTo
+		}
+		for i := range plan.Reassigned {
+			edge := &plan.Reassigned[i]
+			edge.UpdatedAt = now
+			if err := tx.Model(edge).Select("person_id", "updated_at").Updates(edge).Error; err != nil {
+				return err
+			}
+			deletion.ReassignedRelationshipIDs = append(deletion.ReassignedRelationshipIDs, edge.ID)
+		}
+		for _, r := range plan.LinkRequests {
+			if err := tx.Model(&r).Updates(map[string]interface{}{
+				"status":       models.LinkStatusRejected,
+				"processed_at": now,
+				"processed_by": actorID,
+			}).Error; err != nil {
+				return err
+			}
+			deletion.LinkRequestIDs = append(deletion.LinkRequestIDs, r.ID)
+		}
+		for _, inv := range plan.Invitations {
+			if err := tx.Model(&inv).Update("person_id", "").Error; err != nil {
+				return err
+			}
+			deletion.InvitationIDs = append(deletion.InvitationIDs, inv.ID)
+		}
+
+		if person.AuthUserID != "" {
+			if err := tx.Model(&person).Update("auth_user_id", "").Error; err != nil {
+				return err
+			}
+			if err := refreshUserVerified(tx, deletion.AuthUserID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(deletion).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&person).Error; err != nil {
+			return err
+		}
+		return RecordPersonRevision(tx, &plan.Person, nil, actorID, models.RevisionDelete, deletion.ID)
+	})
+	if err != nil {
+		return nil, plan, err
+	}
+	return deletion, plan, nil
+}
+
+// refreshUserVerified keeps a user verified only while a person is linked to
+// their account
+func refreshUserVerified(tx *gorm.DB, userID string) error {
+	var count int64
+	if err := tx.Model(&models.Person{}).Where("auth_user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).Update("is_verified", count > 0).Error
+}
+
+// RestoreResult is the restored person and the references that couldn't be
+// put back because things changed after the delete
+type RestoreResult struct {
+	Person   *models.Person `json:"person"`
+	Restored int            `json:"restored"`
+	Skipped  []string       `json:"skipped"`
+}
+
+// RestorePerson undoes the latest deletion of a person: the row comes back,
+// detached edges are re-attached, reassigned children return, rejected link
+// requests are pending again and invitations and the account link are bound
+// again. References that now conflict are skipped and reported.
+func RestorePerson(db *gorm.DB, treeID, personID, actorID string) (*RestoreResult, error) {
+	result := &RestoreResult{Skipped: []string{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var person models.Person
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&person, "id = ? AND family_tree_id = ?", personID, treeID).Error; err != nil {
+			return ErrPersonNotFound
+		}
+		if !person.DeletedAt.Valid {
+			return ErrNothingToRestore
+		}
+
+		var deletion models.PersonDeletion
+		found := tx.Where("person_id = ? AND restored_at IS NULL", personID).Order("created_at DESC").Limit(1).Find(&deletion)
+		if found.Error != nil {
+			return found.Error
+		}
+
+		if err := tx.Unscoped().Model(&person).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		person.DeletedAt = gorm.DeletedAt{}
+		if found.RowsAffected == 0 {
+			// Deleted before deletions were recorded; only the row comes back
+			return RecordPersonRevision(tx, nil, &person, actorID, models.RevisionRestore, "")
+		}
+
+		skip := func(format string, args ...interface{}) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf(format, args...))
+		}
+		// Edges added while the person was gone can make a parent edge a cycle
+		makesCycle := func(edge *models.Relationship) (bool, error) {
+			if edge.Type != models.RelationshipParentChild {
+				return false, nil
+			}
+			return isAncestor(tx, edge.RelatedPersonID, edge.PersonID)
+		}
+
+		for _, id := range deletion.DetachedRelationshipIDs {
+			var edge models.Relationship
+			if err := tx.Unscoped().First(&edge, "id = ?", id).Error; err != nil || !edge.DeletedAt.Valid {
+				skip("relationship %s no longer exists", id)
+				continue
+			}
+			var alive int64
+			if err := tx.Model(&models.Person{}).Where("id = ?", edge.Other(personID)).Count(&alive).Error; err != nil {
+				return err
+			}
+			exists, err := relationshipExists(tx, &edge)
+			if err != nil {
+				return err
+			}
+			cycle, err := makesCycle(&edge)
+			if err != nil {
+				return err
+			}
+			if alive == 0 || exists || cycle {
+				skip("relationship %s conflicts with the current tree", id)
+				continue
+			}
+			if err := tx.Unscoped().Model(&edge).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			result.Restored++
+		}
+
+		for _, id := range deletion.ReassignedRelationshipIDs {
+			var edge models.Relationship
+			if err := tx.First(&edge, "id = ?", id).Error; err != nil || edge.PersonID != deletion.ReassignedTo {
+				skip("relationship %s was changed after the delete", id)
+				continue
+			}
+			edge.PersonID = personID
+			cycle, err := makesCycle(&edge)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				skip("relationship %s conflicts with the current tree", id)
+				continue
+			}
+			edge.UpdatedAt = time.Now()
+			if err := tx.Model(&edge).Select("person_id", "updated_at").Updates(&edge).Error; err != nil {
+				return err
+			}
+			result.Restored++
+		}
+
+		for _, id := range deletion.LinkRequestIDs {
+			update := tx.Model(&models.LinkRequest{}).
+				Where("id = ? AND status = ? AND processed_by = ?", id, models.LinkStatusRejected, deletion.DeletedBy).
+				Updates(map[string]interface{}{"status": models.LinkStatusPending, "processed_at": nil, "processed_by": ""})
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected == 0 {
+				skip("link request %s was handled after the delete", id)
+				continue
+			}
+			result.Restored++
+		}
+
+		for _, id := range deletion.InvitationIDs {
+			update := tx.Model(&models.Invitation{}).Where("id = ? AND person_id = ?", id, "").Update("person_id", personID)
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected == 0 {
+				skip("invitation %s was changed after the delete", id)
+				continue
+			}
+			result.Restored++
+		}
+
+		if deletion.AuthUserID != "" {
+			var linked int64
+			if err := tx.Model(&models.Person{}).Where("auth_user_id = ? AND family_tree_id = ?", deletion.AuthUserID, treeID).Count(&linked).Error; err != nil {
+				return err
+			}
+			if linked > 0 {
+				skip("account %s is linked to another person now", deletion.AuthUserID)
+			} else {
+				person.AuthUserID = deletion.AuthUserID
+				if err := tx.Model(&person).Update("auth_user_id", person.AuthUserID).Error; err != nil {
+					return err
+				}
+				if err := refreshUserVerified(tx, person.AuthUserID); err != nil {
+					return err
+				}
+				result.Restored++
+			}
+		}
+
+		now := time.Now()
+		if err := tx.Model(&deletion).Updates(map[string]interface{}{"restored_at": now, "restored_by": actorID}).Error; err != nil {
+			return err
+		}
+		return RecordPersonRevision(tx, nil, &person, actorID, models.RevisionRestore, deletion.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var person models.Person
+	if err := db.First(&person, "id = ?", personID).Error; err != nil {
+		return nil, err
+	}
+	result.Person = &person
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"family-tree-backend/models"
+)
+
+// Deleting X from P -> X -> C lets C become P's parent; restoring X must not
+// bring back the edge that closes the cycle
+func TestRestorePersonSkipsCycles(t *testing.T) {
+	for _, mode := range []models.DeleteMode{models.DeleteDetach, models.DeleteReassign} {
+		t.Run(string(mode), func(t *testing.T) {
+			db := testDB(t, &models.Person{}, &models.PersonRevision{}, &models.Relationship{}, &models.PersonDeletion{},
+				&models.LinkRequest{}, &models.EditProposal{}, &models.Invitation{}, &models.Citation{})
+			for _, id := range []string{"p", "x", "c", "q"} {
+				createPerson(t, db, models.Person{ID: id, FirstName: id})
+			}
+			edge := func(parent, child string) error {
+				return AddRelationship(db, &models.Relationship{FamilyTreeID: "tree-1", PersonID: parent, RelatedPersonID: child, Type: models.RelationshipParentChild})
+			}
+			for _, e := range [][2]string{{"p", "x"}, {"x", "c"}} {
+				if err := edge(e[0], e[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := DeleteOptions{Mode: mode}
+			if mode == models.DeleteReassign {
+				opts.ReassignTo = "q"
+			}
+			if _, _, err := DeletePerson(db, "tree-1", "x", opts, "admin"); err != nil {
+				t.Fatal(err)
+			}
+			if err := edge("c", "p"); err != nil {
+				t.Fatalf("adding c -> p with x gone: %v", err)
+			}
+
+			result, err := RestorePerson(db, "tree-1", "x", "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Skipped) == 0 {
+				t.Error("nothing was skipped")
+			}
+			if cycle, err := isAncestor(db, "x", "x"); err != nil || cycle {
+				t.Errorf("x is its own ancestor after the restore (%v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+	"family-tree-backend/names"
+)
+
+// DefaultDuplicateScore is the lowest score reported as a likely duplicate
+const DefaultDuplicateScore = 0.7
+
+// Weights of the duplicate score; they add up to 1
+const (
+	duplicateNameWeight     = 0.55
+	duplicateDateWeight     = 0.25
+	duplicateRelativeWeight = 0.2
+)
+
+// DuplicateCandidate is a pair of persons that may be the same individual
+type DuplicateCandidate struct {
+	Person  models.Person `json:"person"`
+	Other   models.Person `json:"other"`
+	Score   float64       `json:"score"`
+	Reasons []string      `json:"reasons"`
+}
+
+// FindDuplicates scores pairs of persons in a tree on name similarity,
+// dates and shared relatives, best matches first. Only persons whose first
+// names start with the same consonant are compared.
+func FindDuplicates(g *FamilyGraph, minScore float64) []DuplicateCandidate {
+	blocks := map[string][]*models.Person{}
+	for _, p := range g.Persons {
+		words := names.Words(p.FirstName)
+		if len(words) == 0 {
+			continue
+		}
+		key := words[0][:1]
+		blocks[key] = append(blocks[key], p)
+	}
+
+	candidates := []DuplicateCandidate{}
+	for _, block := range blocks {
+		sort.Slice(block, func(i, j int) bool { return block[i].ID < block[j].ID })
+		for i := range block {
+			for j := i + 1; j < len(block); j++ {
+				score, reasons, ok := g.duplicateScore(block[i], block[j])
+				if !ok || score < minScore {
+					continue
+				}
+				candidates = append(candidates, DuplicateCandidate{
+					Person:  *g.Person(block[i].ID),
+					Other:   *g.Person(block[j].ID),
+					Score:   math.Round(score*100) / 100,
+					Reasons: reasons,
+				})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Person.ID < candidates[j].Person.ID
+	})
+	return candidates
+}
+
+// duplicateScore rates how likely a and b are the same person. Pairs that
+// can't be, such as different genders or a parent and child, are not ok.
+func (g *FamilyGraph) duplicateScore(a, b *models.Person) (float64, []string, bool) {
+	if a.Gender != "" && b.Gender != "" && a.Gender != b.Gender {
+		return 0, nil, false
+	}
+
+	firstName := names.Similarity(a.FirstName, b.FirstName)
+	if firstName < 0.75 {
+		return 0, nil, false
+	}
+	lastName := 0.5
+	if a.LastName != "" && b.LastName != "" {
+		lastName = names.Similarity(a.LastName, b.LastName)
+	}
+	nameScore := 0.6*firstName + 0.4*lastName
+
+	var reasons []string
+	switch {
+	case nameScore >= 0.99:
+		reasons = append(reasons, "same name")
+	case a.LastName == "" || b.LastName == "":
+		reasons = append(reasons, "similar first name")
+	default:
+		reasons = append(reasons, "similar name")
+	}
+
+	dateScore, known := 0.0, 0
+	for _, d := range []struct {
+		label string
+		a, b  *gendate.Date
+	}{{"birth", a.BirthDate, b.BirthDate}, {"death", a.DeathDate, b.DeathDate}} {
+		if d.a == nil || d.b == nil {
+			continue
+		}
+		score, reason, ok := compareDates(d.a, d.b)
+		if !ok {
+			return 0, nil, false
+		}
+		dateScore += score
+		known++
+		reasons = append(reasons, d.label+" "+reason)
+	}
+	if known == 0 {
+		dateScore = 0.5
+	} else {
+		dateScore /= float64(known)
+	}
+
+	relatives, direct := g.sharedRelatives(a.ID, b.ID)
+	if direct {
+		return 0, nil, false
+	}
+	if relatives > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d shared relatives", relatives))
+	}
+	relativeScore := math.Min(float64(relatives), 2) / 2
+
+	score := duplicateNameWeight*nameScore + duplicateDateWeight*dateScore + duplicateRelativeWeight*relativeScore
+	return score, reasons, true
+}
+
+// compareDates scores two known dates by how far apart the days they could
+// be are. Dates years apart rule a match out.
+func compareDates(a, b *gendate.Date) (float64, string, bool) {
+	// Days between the ranges; open-ended dates reach as far as needed
+	gap := time.Duration(0)
+	if latest, ok := a.Latest(); ok {
+		if earliest, ok := b.Earliest(); ok && latest.Before(earliest) {
+			gap = earliest.Sub(latest)
+		}
+	}
+	if latest, ok := b.Latest(); ok {
+		if earliest, ok := a.Earliest(); ok && latest.Before(earliest) {
+			gap = earliest.Sub(latest)
+		}
+	}
+
+	switch {
+	case a.Precision() == gendate.PrecisionDay && a.String() == b.String():
+		return 1, "date matches", true
+	case gap == 0 && a.Time().Year() == b.Time().Year():
+		return 0.8, "year matches", true
+	case gap == 0:
+		return 0.6, "dates overlap", true
+	case gap <= 2*365*24*time.Hour:
+		return 0.5, "years within 2", true
+	default:
+		return 0, "", false
+	}
+}
+
+// sharedRelatives counts relatives a and b have in common, and reports
+// whether an edge joins them directly. Sharing parents makes them look like
+// siblings, which is the usual shape of a duplicate, so that doesn't count.
+func (g *FamilyGraph) sharedRelatives(a, b string) (int, bool) {
+	direct := func(id string) map[string]bool {
+		set := map[string]bool{}
+		for _, ids := range [][]string{g.ParentIDs(id), g.ChildIDs(id), g.SpouseIDs(id)} {
+			for _, other := range ids {
+				set[other] = true
+			}
+		}
+		for _, e := range g.Siblings[id] {
+			set[e.Other(id)] = true
+		}
+		return set
+	}
+
+	ra, rb := direct(a), direct(b)
+	if ra[b] || rb[a] {
+		return 0, true
+	}
+	for _, id := range g.SiblingIDs(a) {
+		ra[id] = true
+	}
+	for _, id := range g.SiblingIDs(b) {
+		rb[id] = true
+	}
+
+	shared := 0
+	for id := range ra {
+		if rb[id] && id != a && id != b {
+			shared++
+		}
+	}
+	return shared, false
+}
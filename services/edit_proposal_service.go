@@ -0,0 +1,378 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProposalNotFound = errors.New("edit proposal not found")
+	ErrProposalClosed   = errors.New("edit proposal is no longer pending")
+	ErrProposalEmpty    = errors.New("edit proposal doesn't change anything")
+	ErrProposalConflict = errors.New("the person changed since this was proposed")
+	ErrUnknownField     = errors.New("field can't be changed by a proposal")
+	ErrInvalidValue     = errors.New("invalid value")
+)
+
+// proposalField reads and writes one Person field by its JSON name
+type proposalField struct {
+	column string
+	get    func(p *models.Person) interface{}
+	set    func(p *models.Person, raw json.RawMessage) error
+}
+
+var proposalFields = map[string]proposalField{
+	"firstName": {"first_name",
+		func(p *models.Person) interface{} { return p.FirstName },
+		func(p *models.Person, raw json.RawMessage) error { return json.Unmarshal(raw, &p.FirstName) }},
+	"lastName": {"last_name",
+		func(p *models.Person) interface{} { return p.LastName },
+		func(p *models.Person, raw json.RawMessage) error { return json.Unmarshal(raw, &p.LastName) }},
+	"birthDate": {"birth_date",
+		func(p *models.Person) interface{} { return p.BirthDate },
+		func(p *models.Person, raw json.RawMessage) error {
+			p.BirthDate = nil
+			return json.Unmarshal(raw, &p.BirthDate)
+		}},
+	"deathDate": {"death_date",
+		func(p *models.Person) interface{} { return p.DeathDate },
+		func(p *models.Person, raw json.RawMessage) error {
+			p.DeathDate = nil
+			return json.Unmarshal(raw, &p.DeathDate)
+		}},
+	"gender": {"gender",
+		func(p *models.Person) interface{} { return p.Gender },
+		func(p *models.Person, raw json.RawMessage) error { return json.Unmarshal(raw, &p.Gender) }},
+	"bio": {"bio",
+		func(p *models.Person) interface{} { return p.Bio },
+		func(p *models.Person, raw json.RawMessage) error { return json.Unmarshal(raw, &p.Bio) }},
+	"profilePhotoUrl": {"profile_photo_url",
+		func(p *models.Person) interface{} { return p.ProfilePhotoURL },
+		func(p *models.Person, raw json.RawMessage) error { return json.Unmarshal(raw, &p.ProfilePhotoURL) }},
+	"photos": {"photos",
+		func(p *models.Person) interface{} { return p.Photos },
+		func(p *models.Person, raw json.RawMessage) error {
+			p.Photos = nil
+			return json.Unmarshal(raw, &p.Photos)
+		}},
+	"lifeEvents": {"life_events",
+		func(p *models.Person) interface{} { return p.LifeEvents },
+		func(p *models.Person, raw json.RawMessage) error {
+			p.LifeEvents = nil
+			return json.Unmarshal(raw, &p.LifeEvents)
+		}},
+}
+
+// ProposalInput is what a member suggests: new values for profile fields by
+// their JSON name, and relationship edges to add or remove
+type ProposalInput struct {
+	Note          string                        `json:"note"`
+	Fields        map[string]json.RawMessage    `json:"fields"`
+	Relationships []models.ProposedRelationship `json:"relationships"`
+}
+
+// ReviewDecision accepts or rejects one change of a proposal
+type ReviewDecision struct {
+	ChangeID string `json:"changeId" binding:"required"`
+	Accept   bool   `json:"accept"`
+	Reason   string `json:"reason"`
+}
+
+func fieldValue(f proposalField, p *models.Person) (json.RawMessage, error) {
+	return json.Marshal(f.get(p))
+}
+
+// CreateEditProposal records the viewer's suggested edit to person. Fields
+// the viewer can see that already have the proposed value are dropped.
+func CreateEditProposal(db *gorm.DB, viewer Viewer, person *models.Person, input ProposalInput) (*models.EditProposal, error) {
+	visible := changeVisible(viewer, person)
+
+	names := make([]string, 0, len(input.Fields))
+	for name := range input.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := models.ProposalChanges{}
+	for _, name := range names {
+		field, ok := proposalFields[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+		proposed := *person
+		if err := field.set(&proposed, input.Fields[name]); err != nil {
+			return nil, fmt.Errorf("%w for %s: %v", ErrInvalidValue, name, err)
+		}
+		oldValue, err := fieldValue(field, person)
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := fieldValue(field, &proposed)
+		if err != nil {
+			return nil, err
+		}
+		// Dropping unchanged values the proposer can't see would tell them
+		// what the values are
+		if bytes.Equal(oldValue, newValue) && visible(name) {
+			continue
+		}
+		changes = append(changes, models.ProposalChange{
+			ID:     uuid.New().String(),
+			Field:  name,
+			Old:    oldValue,
+			New:    newValue,
+			Status: models.ChangePending,
+		})
+	}
+
+	for i := range input.Relationships {
+		rel := input.Relationships[i]
+		if err := validateProposedRelationship(db, person, &rel); err != nil {
+			return nil, err
+		}
+		changes = append(changes, models.ProposalChange{
+			ID:           uuid.New().String(),
+			Field:        models.ProposalFieldRelationship,
+			Relationship: &rel,
+			Status:       models.ChangePending,
+		})
+	}
+
+	if len(changes) == 0 {
+		return nil, ErrProposalEmpty
+	}
+
+	proposal := models.EditProposal{
+		ID:           uuid.New().String(),
+		FamilyTreeID: person.FamilyTreeID,
+		PersonID:     person.ID,
+		ProposedBy:   viewer.UserID,
+		Note:         input.Note,
+		Changes:      changes,
+		Status:       models.ProposalPending,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := db.Create(&proposal).Error; err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// validateProposedRelationship checks an edge change up front so reviewers
+// only see changes that can be applied
+func validateProposedRelationship(db *gorm.DB, person *models.Person, rel *models.ProposedRelationship) error {
+	switch rel.Action {
+	case "add":
+		if rel.PersonID == "" {
+			rel.PersonID = person.ID
+		}
+		if rel.PersonID != person.ID && rel.RelatedPersonID != person.ID {
+			return fmt.Errorf("%w: the relationship must involve the person being edited", ErrInvalidRelationship)
+		}
+		if rel.Type != models.RelationshipParentChild && rel.Type != models.RelationshipSpouse && rel.Type != models.RelationshipSibling {
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidRelationship, rel.Type)
+		}
+		if rel.Qualifier != "" {
+			if err := ValidateQualifier(rel.Type, rel.Qualifier); err != nil {
+				return err
+			}
+		}
+		if rel.Type == models.RelationshipParentChild && (rel.StartDate != nil || rel.EndDate != nil) {
+			return fmt.Errorf("%w: only spouse relationships have dates", ErrInvalidRelationship)
+		}
+		var count int64
+		if err := db.Model(&models.Person{}).Where("id IN ? AND family_tree_id = ?", []string{rel.PersonID, rel.RelatedPersonID}, person.FamilyTreeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 2 {
+			return ErrPersonNotFound
+		}
+		rel.RelationshipID = ""
+	case "remove":
+		var edge models.Relationship
+		if err := db.First(&edge, "id = ? AND family_tree_id = ?", rel.RelationshipID, person.FamilyTreeID).Error; err != nil || !edge.Involves(person.ID) {
+			return fmt.Errorf("%w: relationship not found", ErrInvalidRelationship)
+		}
+		// Keep a copy so reviewers see what would be removed
+		*rel = models.ProposedRelationship{
+			Action:          "remove",
+			RelationshipID:  edge.ID,
+			PersonID:        edge.PersonID,
+			RelatedPersonID: edge.RelatedPersonID,
+			Type:            edge.Type,
+			Qualifier:       edge.Qualifier,
+			StartDate:       edge.StartDate,
+			EndDate:         edge.EndDate,
+		}
+	default:
+		return fmt.Errorf("%w: action must be add or remove", ErrInvalidRelationship)
+	}
+	return nil
+}
+
+// CurrentValues returns the person's present value of every field a proposal
+// changes, for side-by-side review
+func CurrentValues(person *models.Person, proposal *models.EditProposal) map[string]json.RawMessage {
+	current := map[string]json.RawMessage{}
+	for _, change := range proposal.Changes {
+		if field, ok := proposalFields[change.Field]; ok {
+			if value, err := fieldValue(field, person); err == nil {
+				current[change.Field] = value
+			}
+		}
+	}
+	return current
+}
+
+// ReviewEditProposal records decisions and applies the accepted changes in
+// one transaction. An accepted field whose value changed since the proposal
+// was made fails with ErrProposalConflict unless overwrite is set. Changes
+// not mentioned stay pending for a later review.
+func ReviewEditProposal(db *gorm.DB, proposalID, treeID, reviewerID string, decisions []ReviewDecision, overwrite bool) (*models.EditProposal, error) {
+	var proposal models.EditProposal
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&proposal, "id = ? AND family_tree_id = ?", proposalID, treeID).Error; err != nil {
+			return ErrProposalNotFound
+		}
+		if proposal.Status != models.ProposalPending {
+			return ErrProposalClosed
+		}
+
+		var person models.Person
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&person, "id = ?", proposal.PersonID).Error; err != nil {
+			return ErrPersonNotFound
+		}
+
+		byID := make(map[string]*models.ProposalChange, len(proposal.Changes))
+		for i := range proposal.Changes {
+			byID[proposal.Changes[i].ID] = &proposal.Changes[i]
+		}
+
+		before := person
+		var columns, conflicts []string
+		var edges []*models.ProposedRelationship
+		for _, d := range decisions {
+			change, ok := byID[d.ChangeID]
+			if !ok || change.Status != models.ChangePending {
+				return fmt.Errorf("%w: change %s is not pending", ErrProposalClosed, d.ChangeID)
+			}
+			change.Reason = d.Reason
+			if !d.Accept {
+				change.Status = models.ChangeRejected
+				continue
+			}
+			change.Status = models.ChangeAccepted
+
+			if change.Field == models.ProposalFieldRelationship {
+				edges = append(edges, change.Relationship)
+				continue
+			}
+			field := proposalFields[change.Field]
+			current, err := fieldValue(field, &person)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(current, change.Old) && !overwrite {
+				conflicts = append(conflicts, change.Field)
+				continue
+			}
+			if err := field.set(&person, change.New); err != nil {
+				return err
+			}
+			columns = append(columns, field.column)
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: %s", ErrProposalConflict, strings.Join(conflicts, ", "))
+		}
+
+		if len(columns) > 0 {
+			person.UpdatedAt = time.Now()
+			if err := tx.Model(&person).Select(append(columns, "updated_at")).Updates(&person).Error; err != nil {
+				return err
+			}
+			if err := indexPersonName(tx, &person); err != nil {
+				return err
+			}
+			if err := RecordPersonRevision(tx, &before, &person, reviewerID, models.RevisionProposal, proposal.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, edge := range edges {
+			if edge.Action == "remove" {
+				// Already gone is fine; the reviewer wanted it removed
+				if err := tx.Delete(&models.Relationship{}, "id = ? AND family_tree_id = ?", edge.RelationshipID, treeID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			rel := models.Relationship{
+				PersonID:        edge.PersonID,
+				RelatedPersonID: edge.RelatedPersonID,
+				Type:            edge.Type,
+				Qualifier:       edge.Qualifier,
+				StartDate:       edge.StartDate,
+				EndDate:         edge.EndDate,
+			}
+			if err := AddRelationship(tx, &rel); err != nil {
+				return err
+			}
+		}
+
+		proposal.Status = proposalOutcome(proposal.Changes)
+		if proposal.Status != models.ProposalPending {
+			now := time.Now()
+			proposal.ReviewedBy = reviewerID
+			proposal.ReviewedAt = &now
+		}
+		proposal.UpdatedAt = time.Now()
+		return tx.Save(&proposal).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// proposalOutcome is pending while any change is undecided
+func proposalOutcome(changes models.ProposalChanges) models.ProposalStatus {
+	accepted := false
+	for _, change := range changes {
+		switch change.Status {
+		case models.ChangePending:
+			return models.ProposalPending
+		case models.ChangeAccepted:
+			accepted = true
+		}
+	}
+	if accepted {
+		return models.ProposalApplied
+	}
+	return models.ProposalRejected
+}
+
+// WithdrawEditProposal lets the proposer take back a pending proposal
+func WithdrawEditProposal(db *gorm.DB, proposal *models.EditProposal) error {
+	if proposal.Status != models.ProposalPending {
+		return ErrProposalClosed
+	}
+	proposal.Status = models.ProposalWithdrawn
+	proposal.UpdatedAt = time.Now()
+	return db.Model(proposal).Updates(map[string]interface{}{
+		"status":     proposal.Status,
+		"updated_at": proposal.UpdatedAt,
+	}).Error
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+)
+
+// Proposing a field's current value must not tell a proposer who can't see
+// the field what it holds
+func TestCreateEditProposalHidesUnchangedValues(t *testing.T) {
+	db := testDB(t, &models.EditProposal{})
+	person := &models.Person{
+		ID:           "p1",
+		FamilyTreeID: "tree-1",
+		FirstName:    "Ada",
+		Bio:          "Mathematician",
+		FieldPrivacy: models.FieldPrivacy{models.FieldBirthDate: models.PrivacyPrivate},
+	}
+	birth, err := gendate.Parse("1815-12-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	person.BirthDate = birth
+	member := Viewer{UserID: "u2", FamilyTreeID: "tree-1"}
+
+	tests := []struct {
+		name    string
+		person  models.PersonPrivacy
+		fields  map[string]string
+		want    []string // Fields of the changes recorded
+		wantErr error
+	}{
+		{"visible and unchanged", models.PrivacyMembers, map[string]string{"bio": `"Mathematician"`}, nil, ErrProposalEmpty},
+		{"visible and changed", models.PrivacyMembers, map[string]string{"bio": `"Poet"`}, []string{"bio"}, nil},
+		{"hidden field, unchanged", models.PrivacyMembers, map[string]string{"birthDate": `"1815-12-10"`}, []string{"birthDate"}, nil},
+		{"hidden field, changed", models.PrivacyMembers, map[string]string{"birthDate": `"1816"`}, []string{"birthDate"}, nil},
+		{"hidden person, unchanged", models.PrivacyPrivate, map[string]string{"bio": `"Mathematician"`, "firstName": `"Ada"`}, []string{"bio"}, nil},
+	}
+	for _, tt := range tests {
+		p := *person
+		p.Privacy = tt.person
+		input := ProposalInput{Fields: map[string]json.RawMessage{}}
+		for name, value := range tt.fields {
+			input.Fields[name] = json.RawMessage(value)
+		}
+		proposal, err := CreateEditProposal(db, member, &p, input)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, change := range proposal.Changes {
+			got = append(got, change.Field)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s: changes to %v, want %v", tt.name, got, tt.want)
+		}
+		if proposal.ProposedBy != member.UserID {
+			t.Errorf("%s: proposedBy = %q", tt.name, proposal.ProposedBy)
+		}
+	}
+}
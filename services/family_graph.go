@@ -0,0 +1,294 @@
+package services
+
+import (
+	"sort"
+
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxTraversalDepth bounds how many generations a traversal may walk
+const MaxTraversalDepth = 25
+
+// FamilyGraph is an in-memory view of one family tree, used for traversals
+// that would take one query per generation if done against the database.
+type FamilyGraph struct {
+	Persons  map[string]*models.Person
+	Parents  map[string][]models.Relationship // keyed by child ID
+	Children map[string][]models.Relationship // keyed by parent ID
+	Spouses  map[string][]models.Relationship // keyed by either spouse
+	Siblings map[string][]models.Relationship // explicit sibling edges, keyed by either sibling
+}
+
+// LoadFamilyGraph loads every person and edge of a family tree
+func LoadFamilyGraph(db *gorm.DB, familyTreeID string) (*FamilyGraph, error) {
+	var persons []models.Person
+	if err := db.Where("family_tree_id = ?", familyTreeID).Find(&persons).Error; err != nil {
+		return nil, err
+	}
+
+	var edges []models.Relationship
+	if err := db.Where("family_tree_id = ?", familyTreeID).Find(&edges).Error; err != nil {
+		return nil, err
+	}
+
+	return NewFamilyGraph(persons, edges), nil
+}
+
+// NewFamilyGraph indexes persons and edges. Edges pointing at persons that
+// are not in the list are kept so callers can report them.
+func NewFamilyGraph(persons []models.Person, edges []models.Relationship) *FamilyGraph {
+	g := &FamilyGraph{
+		Persons:  make(map[string]*models.Person, len(persons)),
+		Parents:  map[string][]models.Relationship{},
+		Children: map[string][]models.Relationship{},
+		Spouses:  map[string][]models.Relationship{},
+		Siblings: map[string][]models.Relationship{},
+	}
+	for i := range persons {
+		g.Persons[persons[i].ID] = &persons[i]
+	}
+	for _, e := range edges {
+		switch e.Type {
+		case models.RelationshipParentChild:
+			g.Parents[e.RelatedPersonID] = append(g.Parents[e.RelatedPersonID], e)
+			g.Children[e.PersonID] = append(g.Children[e.PersonID], e)
+		case models.RelationshipSpouse:
+			g.Spouses[e.PersonID] = append(g.Spouses[e.PersonID], e)
+			g.Spouses[e.RelatedPersonID] = append(g.Spouses[e.RelatedPersonID], e)
+		case models.RelationshipSibling:
+			g.Siblings[e.PersonID] = append(g.Siblings[e.PersonID], e)
+			g.Siblings[e.RelatedPersonID] = append(g.Siblings[e.RelatedPersonID], e)
+		}
+	}
+	return g
+}
+
+// ParentIDs returns the IDs of a person's parents
+func (g *FamilyGraph) ParentIDs(personID string) []string {
+	ids := make([]string, 0, len(g.Parents[personID]))
+	for _, e := range g.Parents[personID] {
+		ids = append(ids, e.PersonID)
+	}
+	return ids
+}
+
+// ChildIDs returns the IDs of a person's children
+func (g *FamilyGraph) ChildIDs(personID string) []string {
+	ids := make([]string, 0, len(g.Children[personID]))
+	for _, e := range g.Children[personID] {
+		ids = append(ids, e.RelatedPersonID)
+	}
+	return ids
+}
+
+// SpouseIDs returns the IDs of a person's spouses
+func (g *FamilyGraph) SpouseIDs(personID string) []string {
+	ids := make([]string, 0, len(g.Spouses[personID]))
+	for _, e := range g.Spouses[personID] {
+		ids = append(ids, e.Other(personID))
+	}
+	return ids
+}
+
+// SiblingIDs returns explicit siblings plus everyone sharing a parent
+func (g *FamilyGraph) SiblingIDs(personID string) []string {
+	set := map[string]bool{}
+	for _, e := range g.Siblings[personID] {
+		set[e.Other(personID)] = true
+	}
+	for _, parentID := range g.ParentIDs(personID) {
+		for _, childID := range g.ChildIDs(parentID) {
+			if childID != personID {
+				set[childID] = true
+			}
+		}
+	}
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Relationships builds the person-level view of the graph for one person
+func (g *FamilyGraph) Relationships(personID string) models.Relationships {
+	rels := models.Relationships{
+		ParentIDs:   g.ParentIDs(personID),
+		Spouses:     []models.RelationshipConnection{},
+		ChildrenIDs: g.ChildIDs(personID),
+		SiblingIDs:  g.SiblingIDs(personID),
+	}
+	for _, e := range g.Spouses[personID] {
+		rels.Spouses = append(rels.Spouses, models.RelationshipConnection{
+			PersonID:  e.Other(personID),
+			Type:      e.Qualifier,
+			StartDate: e.StartDate,
+			EndDate:   e.EndDate,
+		})
+	}
+	return rels
+}
+
+// Person returns a copy of a person with relationships filled in
+func (g *FamilyGraph) Person(personID string) *models.Person {
+	p, ok := g.Persons[personID]
+	if !ok {
+		return nil
+	}
+	person := *p
+	person.Relationships = g.Relationships(personID)
+	return &person
+}
+
+// Generations numbers everyone connected to a person by generation relative
+// to them: parents are -1, children 1, and spouses and siblings share a
+// generation. Where paths disagree, as after a marriage between
+// generations, the shortest one wins.
+func (g *FamilyGraph) Generations(rootID string) map[string]int {
+	generations := map[string]int{rootID: 0}
+	queue := []string{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visit := func(ids []string, step int) {
+			for _, next := range ids {
+				if _, seen := generations[next]; !seen {
+					generations[next] = generations[id] + step
+					queue = append(queue, next)
+				}
+			}
+		}
+		visit(g.ParentIDs(id), -1)
+		visit(g.ChildIDs(id), 1)
+		visit(g.SpouseIDs(id), 0)
+		visit(g.SiblingIDs(id), 0)
+	}
+	return generations
+}
+
+// TreeNode is one person in a nested ancestor or descendant tree
+type TreeNode struct {
+	Person     *models.Person `json:"person"`
+	Generation int            `json:"generation"`
+	Qualifier  string         `json:"qualifier,omitempty"` // how this node is linked to the previous generation
+	Repeated   bool           `json:"repeated,omitempty"`  // already expanded elsewhere (pedigree collapse)
+	Parents    []*TreeNode    `json:"parents,omitempty"`
+	Children   []*TreeNode    `json:"children,omitempty"`
+}
+
+// GenerationEntry is one person in a flat traversal result
+type GenerationEntry struct {
+	Person     *models.Person `json:"person"`
+	Generation int            `json:"generation"`
+}
+
+// AncestorTree returns the nested pedigree of a person up to depth generations
+func (g *FamilyGraph) AncestorTree(rootID string, depth int) *TreeNode {
+	return g.buildTree(rootID, depth, true)
+}
+
+// DescendantTree returns the nested descendants of a person up to depth generations
+func (g *FamilyGraph) DescendantTree(rootID string, depth int) *TreeNode {
+	return g.buildTree(rootID, depth, false)
+}
+
+func (g *FamilyGraph) buildTree(rootID string, depth int, up bool) *TreeNode {
+	if depth > MaxTraversalDepth {
+		depth = MaxTraversalDepth
+	}
+	expanded := map[string]bool{}
+	onPath := map[string]bool{}
+
+	var walk func(id string, generation int, qualifier string) *TreeNode
+	walk = func(id string, generation int, qualifier string) *TreeNode {
+		person := g.Person(id)
+		if person == nil {
+			return nil
+		}
+		node := &TreeNode{Person: person, Generation: generation, Qualifier: qualifier}
+		if expanded[id] {
+			node.Repeated = true
+			return node
+		}
+		expanded[id] = true
+		if generation >= depth {
+			return node
+		}
+
+		onPath[id] = true
+		defer delete(onPath, id)
+
+		edges := g.Children[id]
+		if up {
+			edges = g.Parents[id]
+		}
+		for _, e := range edges {
+			next := e.RelatedPersonID
+			if up {
+				next = e.PersonID
+			}
+			// Cycle protection: never walk back into the current path
+			if onPath[next] {
+				continue
+			}
+			child := walk(next, generation+1, e.Qualifier)
+			if child == nil {
+				continue
+			}
+			if up {
+				node.Parents = append(node.Parents, child)
+			} else {
+				node.Children = append(node.Children, child)
+			}
+		}
+		return node
+	}
+
+	return walk(rootID, 0, "")
+}
+
+// Ancestors returns a flat list of ancestors with generation numbers
+// (1 = parents, 2 = grandparents, ...)
+func (g *FamilyGraph) Ancestors(rootID string, depth int) []GenerationEntry {
+	return g.walkGenerations(rootID, depth, g.ParentIDs)
+}
+
+// Descendants returns a flat list of descendants with generation numbers
+// (1 = children, 2 = grandchildren, ...)
+func (g *FamilyGraph) Descendants(rootID string, depth int) []GenerationEntry {
+	return g.walkGenerations(rootID, depth, g.ChildIDs)
+}
+
+// walkGenerations is a breadth-first walk, so each person is listed once at
+// the closest generation even when reachable by several paths.
+func (g *FamilyGraph) walkGenerations(rootID string, depth int, next func(string) []string) []GenerationEntry {
+	if depth > MaxTraversalDepth {
+		depth = MaxTraversalDepth
+	}
+	entries := []GenerationEntry{}
+	visited := map[string]bool{rootID: true}
+	frontier := []string{rootID}
+
+	for generation := 1; generation <= depth && len(frontier) > 0; generation++ {
+		var nextFrontier []string
+		for _, id := range frontier {
+			for _, relatedID := range next(id) {
+				if visited[relatedID] {
+					continue
+				}
+				visited[relatedID] = true
+				person := g.Person(relatedID)
+				if person == nil {
+					continue
+				}
+				entries = append(entries, GenerationEntry{Person: person, Generation: generation})
+				nextFrontier = append(nextFrontier, relatedID)
+			}
+		}
+		frontier = nextFrontier
+	}
+	return entries
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyMember = errors.New("user is already a member of this family tree")
+	ErrNotMember     = errors.New("user is not a member of this family tree")
+	ErrLastOwner     = errors.New("a family tree must keep at least one owner")
+)
+
+// Tables whose rows carry a family_tree_id, used to find trees that existed
+// before the family_trees table
+var treeScopedTables = []string{"users", "people", "posts", "messages", "events", "link_requests", "relationships"}
+
+// CreateFamilyTree stores a new tree with ownerID as its owner. The tree
+// becomes the owner's current tree if they don't have one yet.
+func CreateFamilyTree(db *gorm.DB, tree *models.FamilyTree, ownerID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tree.ID == "" {
+			tree.ID = uuid.New().String()
+		}
+		tree.CreatedBy = ownerID
+		tree.CreatedAt = time.Now()
+		tree.UpdatedAt = time.Now()
+		if err := tx.Create(tree).Error; err != nil {
+			return err
+		}
+
+		if _, err := AddTreeMember(tx, tree.ID, ownerID, models.TreeRoleOwner); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND (family_tree_id = '' OR family_tree_id IS NULL)", ownerID).
+			Update("family_tree_id", tree.ID).Error
+	})
+}
+
+// AddTreeMember grants userID a role in a tree
+func AddTreeMember(tx *gorm.DB, treeID, userID string, role models.TreeRole) (*models.TreeMembership, error) {
+	var count int64
+	if err := tx.Model(&models.TreeMembership{}).Where("family_tree_id = ? AND user_id = ?", treeID, userID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	membership := models.TreeMembership{
+		ID:           uuid.New().String(),
+		FamilyTreeID: treeID,
+		UserID:       userID,
+		Role:         role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := tx.Create(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ensureOwnerRemains fails if the change would leave a tree without owners
+func ensureOwnerRemains(tx *gorm.DB, membership *models.TreeMembership, newRole models.TreeRole) error {
+	if membership.Role != models.TreeRoleOwner || newRole == models.TreeRoleOwner {
+		return nil
+	}
+	var owners int64
+	if err := tx.Model(&models.TreeMembership{}).
+		Where("family_tree_id = ? AND role = ?", membership.FamilyTreeID, models.TreeRoleOwner).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// ChangeTreeMemberRole updates a member's role, keeping at least one owner
+func ChangeTreeMemberRole(db *gorm.DB, membership *models.TreeMembership, role models.TreeRole) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureOwnerRemains(tx, membership, role); err != nil {
+			return err
+		}
+		membership.Role = role
+		membership.UpdatedAt = time.Now()
+		return tx.Save(membership).Error
+	})
+}
+
+// RemoveTreeMember revokes a membership and clears the tree as the user's
+// current tree
+func RemoveTreeMember(db *gorm.DB, membership *models.TreeMembership) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureOwnerRemains(tx, membership, ""); err != nil {
+			return err
+		}
+		if err := tx.Delete(membership).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND family_tree_id = ?", membership.UserID, membership.FamilyTreeID).
+			Update("family_tree_id", "").Error
+	})
+}
+
+// TreeMemberIDs lists the user IDs of everyone in a tree
+func TreeMemberIDs(db *gorm.DB, treeID string) ([]string, error) {
+	var ids []string
+	err := db.Model(&models.TreeMembership{}).Where("family_tree_id = ?", treeID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// BootstrapFamilyTrees creates FamilyTree rows for tree IDs that were used
+// before trees were entities, and memberships for the users pointing at
+// them. Global admins become tree admins, everyone else a member. Existing
+// trees stay publicly readable so the demo page keeps working.
+func BootstrapFamilyTrees(db *gorm.DB) error {
+	known := map[string]bool{}
+	var existing []string
+	if err := db.Model(&models.FamilyTree{}).Unscoped().Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	for _, id := range existing {
+		known[id] = true
+	}
+
+	for _, table := range treeScopedTables {
+		if !db.Migrator().HasTable(table) {
+			continue
+		}
+		var ids []string
+		if err := db.Table(table).Distinct("family_tree_id").Where("family_tree_id <> ''").Pluck("family_tree_id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if known[id] {
+				continue
+			}
+			known[id] = true
+			tree := models.FamilyTree{
+				ID:        id,
+				Name:      "Family Tree",
+				IsPublic:  true,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}
+			if err := db.Create(&tree).Error; err != nil {
+				return err
+			}
+			log.Printf("Created family tree %s for existing data", id)
+		}
+	}
+
+	var users []models.User
+	if err := db.Where("family_tree_id <> ''").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		role := models.TreeRoleMember
+		if user.IsAdmin() {
+			role = models.TreeRoleAdmin
+		}
+		if _, err := AddTreeMember(db, user.FamilyTreeID, user.ID, role); err != nil && !errors.Is(err, ErrAlreadyMember) {
+			return err
+		}
+	}
+	return nil
+}
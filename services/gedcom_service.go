@@ -0,0 +1,70 @@
+package services
+
+import (
+	"time"
+
+	"family-tree-backend/gedcom"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const gedcomBatchSize = 200
+
+// SaveGedcomImport stores the persons and edges of an import in one
+// transaction, so a failed import leaves the tree untouched. Each person
+// starts its history with an import revision by actorID.
+func SaveGedcomImport(db *gorm.DB, result *gedcom.ImportResult, actorID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(result.Persons) > 0 {
+			for i := range result.Persons {
+				result.Persons[i].SearchText = PersonSearchText(&result.Persons[i])
+			}
+			if err := tx.CreateInBatches(result.Persons, gedcomBatchSize).Error; err != nil {
+				return err
+			}
+			revisions := make([]models.PersonRevision, 0, len(result.Persons))
+			for i := range result.Persons {
+				changes, err := DiffPersons(nil, &result.Persons[i])
+				if err != nil {
+					return err
+				}
+				revisions = append(revisions, models.PersonRevision{
+					ID:           uuid.New().String(),
+					FamilyTreeID: result.Persons[i].FamilyTreeID,
+					PersonID:     result.Persons[i].ID,
+					Action:       models.RevisionImport,
+					ActorID:      actorID,
+					Changes:      changes,
+					CreatedAt:    time.Now(),
+				})
+			}
+			if err := tx.CreateInBatches(revisions, gedcomBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(result.Relationships) > 0 {
+			if err := tx.CreateInBatches(result.Relationships, gedcomBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(result.Sources) > 0 {
+			for i := range result.Sources {
+				result.Sources[i].CreatedBy = actorID
+			}
+			if err := tx.CreateInBatches(result.Sources, gedcomBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(result.Citations) > 0 {
+			for i := range result.Citations {
+				result.Citations[i].CreatedBy = actorID
+			}
+			if err := tx.CreateInBatches(result.Citations, gedcomBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvitationInvalid   = errors.New("invitation is no longer valid")
+	ErrPersonAlreadyLinked = errors.New("person is already linked to another account")
+	ErrInvitationEmail     = errors.New("invitation was sent to another email address; sign in with that address and verify it")
+)
+
+// Letters and digits that can't be confused when read aloud or typed
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const inviteCodeLength = 10
+
+// NewInviteCode returns a random code like "K7QM2XH9TA"
+func NewInviteCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(inviteAlphabet)))
+	for i := 0; i < inviteCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(inviteAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// NormalizeInviteCode makes codes typed by hand match, e.g. "k7qm-2xh9-ta"
+func NormalizeInviteCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// CreateInvitation fills in the code and timestamps and stores the invitation.
+// Invitations bound to a person can only be used once.
+func CreateInvitation(db *gorm.DB, inv *models.Invitation) error {
+	if inv.PersonID != "" {
+		var count int64
+		if err := db.Model(&models.Person{}).Where("id = ? AND family_tree_id = ?", inv.PersonID, inv.FamilyTreeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrPersonNotFound
+		}
+		inv.MaxUses = 1
+	}
+
+	code, err := NewInviteCode()
+	if err != nil {
+		return err
+	}
+	inv.ID = uuid.New().String()
+	inv.Code = code
+	inv.UseCount = 0
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = time.Now()
+	return db.Create(inv).Error
+}
+
+// FindInvitation looks up an invitation by its code
+func FindInvitation(db *gorm.DB, code string) (*models.Invitation, error) {
+	var inv models.Invitation
+	if err := db.Where("code = ?", NormalizeInviteCode(code)).First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// RedeemInvitation adds the user to the invitation's tree, links them to the
+// invited person if there is one, and records the redemption. Existing
+// members can only redeem invitations bound to a person. The tree
+// becomes the user's current tree. Pass a transaction.
+func RedeemInvitation(tx *gorm.DB, code string, user *models.User) (*models.InvitationRedemption, error) {
+	var inv models.Invitation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", NormalizeInviteCode(code)).First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	if inv.Status(time.Now()) != models.InvitationActive {
+		return nil, ErrInvitationInvalid
+	}
+	if inv.Email != "" && (!user.EmailVerified || !strings.EqualFold(user.Email, inv.Email)) {
+		return nil, ErrInvitationEmail
+	}
+
+	// Members can still use an invitation bound to a person to link their
+	// profile; their role stays as it is
+	if _, err := AddTreeMember(tx, inv.FamilyTreeID, user.ID, inv.Role); err != nil {
+		if !errors.Is(err, ErrAlreadyMember) || inv.PersonID == "" {
+			return nil, err
+		}
+	}
+
+	if inv.PersonID != "" {
+		var person models.Person
+		if err := tx.First(&person, "id = ? AND family_tree_id = ?", inv.PersonID, inv.FamilyTreeID).Error; err != nil {
+			return nil, ErrPersonNotFound
+		}
+		if person.AuthUserID != "" && person.AuthUserID != user.ID {
+			return nil, ErrPersonAlreadyLinked
+		}
+		before := person
+		if err := tx.Model(&person).Update("auth_user_id", user.ID).Error; err != nil {
+			return nil, err
+		}
+		if err := RecordPersonRevision(tx, &before, &person, user.ID, models.RevisionLink, inv.ID); err != nil {
+			return nil, err
+		}
+		// Same effect as an approved link request
+		if err := tx.Model(user).Update("is_verified", true).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(user).Update("family_tree_id", inv.FamilyTreeID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&inv).Updates(map[string]interface{}{
+		"use_count":  gorm.Expr("use_count + 1"),
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	redemption := models.InvitationRedemption{
+		ID:           uuid.New().String(),
+		InvitationID: inv.ID,
+		FamilyTreeID: inv.FamilyTreeID,
+		UserID:       user.ID,
+		PersonID:     inv.PersonID,
+		RedeemedAt:   time.Now(),
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"sort"
+
+	"family-tree-backend/models"
+)
+
+// KinshipKind is the shape of the blood relation between two persons
+type KinshipKind string
+
+const (
+	KinshipSelf        KinshipKind = "self"
+	KinshipAncestor    KinshipKind = "ancestor"
+	KinshipDescendant  KinshipKind = "descendant"
+	KinshipSibling     KinshipKind = "sibling"
+	KinshipAuntUncle   KinshipKind = "aunt_uncle"
+	KinshipNieceNephew KinshipKind = "niece_nephew"
+	KinshipCousin      KinshipKind = "cousin"
+	KinshipSpouse      KinshipKind = "spouse"
+	KinshipNotRelated  KinshipKind = "not_related"
+)
+
+// MarriageLink describes how a marriage connects two persons who are not
+// blood relatives
+type MarriageLink string
+
+const (
+	MarriageNone             MarriageLink = ""
+	MarriageSpouseOfRelative MarriageLink = "spouse_of_relative" // e.g. a sister's husband
+	MarriageRelativeOfSpouse MarriageLink = "relative_of_spouse" // e.g. a wife's brother
+)
+
+// Kinship describes how the second person is related to the first. For
+// marriage links, Base holds the blood relation on the other side of the
+// marriage.
+type Kinship struct {
+	Kind            KinshipKind  `json:"kind"`
+	GenerationsUp   int          `json:"generationsUp"`   // first person up to the common ancestor
+	GenerationsDown int          `json:"generationsDown"` // common ancestor down to the second person
+	CousinDegree    int          `json:"cousinDegree,omitempty"`
+	Removed         int          `json:"removed,omitempty"`
+	Half            bool         `json:"half,omitempty"`
+	Qualifier       string       `json:"qualifier,omitempty"` // step/adoptive/foster when a non-biological link is on the path
+	Marriage        MarriageLink `json:"marriage,omitempty"`
+	Path            []string     `json:"path"`
+	CommonAncestors []string     `json:"commonAncestors"`
+	Base            *Kinship     `json:"-"`
+
+	genders            []string // gender of each person on the blood path
+	sharedParentGender string   // for half siblings
+	spouseGender       string   // gender of the spouse forming a marriage link
+}
+
+// Gender of the second person
+func (k *Kinship) Gender() string {
+	if len(k.genders) == 0 {
+		return ""
+	}
+	return k.genders[len(k.genders)-1]
+}
+
+// genderAt returns the gender of the n-th person on the path, or "" if out of range
+func (k *Kinship) genderAt(n int) string {
+	if n < 0 || n >= len(k.genders) {
+		return ""
+	}
+	return k.genders[n]
+}
+
+type ancestorStep struct {
+	distance  int
+	child     string // next person on the way back down to the origin
+	qualifier string
+}
+
+// ancestorSteps walks up from a person breadth-first so each ancestor is
+// recorded at its shortest distance
+func (g *FamilyGraph) ancestorSteps(personID string) map[string]ancestorStep {
+	steps := map[string]ancestorStep{personID: {distance: 0}}
+	frontier := []string{personID}
+	for len(frontier) > 0 {
+		var next []string
+		for _, id := range frontier {
+			for _, e := range g.Parents[id] {
+				if _, seen := steps[e.PersonID]; seen {
+					continue
+				}
+				steps[e.PersonID] = ancestorStep{distance: steps[id].distance + 1, child: id, qualifier: e.Qualifier}
+				next = append(next, e.PersonID)
+			}
+		}
+		frontier = next
+	}
+	return steps
+}
+
+func (g *FamilyGraph) gender(personID string) string {
+	if p, ok := g.Persons[personID]; ok {
+		return p.Gender
+	}
+	return ""
+}
+
+// BloodKinship finds the lowest common ancestors of two persons and derives
+// the relation of b to a. It returns nil when they share no ancestor.
+func (g *FamilyGraph) BloodKinship(a, b string) *Kinship {
+	if a == b {
+		return &Kinship{Kind: KinshipSelf, Path: []string{a}, CommonAncestors: []string{}, genders: []string{g.gender(a)}}
+	}
+
+	stepsA := g.ancestorSteps(a)
+	stepsB := g.ancestorSteps(b)
+
+	best := ""
+	bestUp, bestDown := 0, 0
+	for id, sa := range stepsA {
+		sb, ok := stepsB[id]
+		if !ok {
+			continue
+		}
+		if best == "" || sa.distance+sb.distance < bestUp+bestDown ||
+			(sa.distance+sb.distance == bestUp+bestDown && (sa.distance < bestUp || (sa.distance == bestUp && id < best))) {
+			best, bestUp, bestDown = id, sa.distance, sb.distance
+		}
+	}
+	if best == "" {
+		return nil
+	}
+
+	k := &Kinship{GenerationsUp: bestUp, GenerationsDown: bestDown, CommonAncestors: []string{}}
+	for id, sa := range stepsA {
+		if sb, ok := stepsB[id]; ok && sa.distance == bestUp && sb.distance == bestDown {
+			k.CommonAncestors = append(k.CommonAncestors, id)
+		}
+	}
+	sort.Strings(k.CommonAncestors)
+
+	// Path: a up to the common ancestor, then down to b
+	var up []string
+	for id := best; ; id = stepsA[id].child {
+		up = append(up, id)
+		if id == a {
+			break
+		}
+		if q := stepsA[id].qualifier; q != "" && q != models.ParentBiological && k.Qualifier == "" {
+			k.Qualifier = q
+		}
+	}
+	for i := len(up) - 1; i >= 0; i-- {
+		k.Path = append(k.Path, up[i])
+	}
+	for id := best; id != b; id = stepsB[id].child {
+		if q := stepsB[id].qualifier; q != "" && q != models.ParentBiological && k.Qualifier == "" {
+			k.Qualifier = q
+		}
+		k.Path = append(k.Path, stepsB[id].child)
+	}
+	for _, id := range k.Path {
+		k.genders = append(k.genders, g.gender(id))
+	}
+
+	switch {
+	case bestUp == 0:
+		k.Kind = KinshipDescendant
+	case bestDown == 0:
+		k.Kind = KinshipAncestor
+	case bestUp == 1 && bestDown == 1:
+		k.Kind = KinshipSibling
+		if len(k.CommonAncestors) == 1 && len(g.Parents[a]) > 1 && len(g.Parents[b]) > 1 {
+			k.Half = true
+			k.sharedParentGender = g.gender(k.CommonAncestors[0])
+		}
+	case bestDown == 1:
+		k.Kind = KinshipAuntUncle
+	case bestUp == 1:
+		k.Kind = KinshipNieceNephew
+	default:
+		k.Kind = KinshipCousin
+		k.CousinDegree = min(bestUp, bestDown) - 1
+		k.Removed = max(bestUp, bestDown) - min(bestUp, bestDown)
+	}
+	return k
+}
+
+// marriageKinship wraps a blood relation found on the other side of a marriage
+func marriageKinship(base *Kinship, link MarriageLink, path []string, spouseGender string) *Kinship {
+	k := *base
+	k.Marriage = link
+	k.Path = path
+	k.Base = base
+	k.spouseGender = spouseGender
+	return &k
+}
+
+// Kinship finds how b is related to a, falling back to relations through a
+// single marriage (in-laws, step relatives) when there is no blood link.
+func (g *FamilyGraph) Kinship(a, b string) *Kinship {
+	if k := g.BloodKinship(a, b); k != nil {
+		return k
+	}
+
+	for _, spouseID := range g.SpouseIDs(a) {
+		if spouseID == b {
+			return &Kinship{
+				Kind:            KinshipSpouse,
+				Path:            []string{a, b},
+				CommonAncestors: []string{},
+				genders:         []string{g.gender(a), g.gender(b)},
+			}
+		}
+	}
+
+	var best *Kinship
+
+	// b is married to a blood relative of a
+	for _, spouseID := range g.SpouseIDs(b) {
+		base := g.BloodKinship(a, spouseID)
+		if base == nil {
+			continue
+		}
+		k := marriageKinship(base, MarriageSpouseOfRelative, append(append([]string{}, base.Path...), b), g.gender(b))
+		k.genders = append(append([]string{}, base.genders...), g.gender(b))
+		if best == nil || len(k.Path) < len(best.Path) {
+			best = k
+		}
+	}
+
+	// b is a blood relative of a's spouse
+	for _, spouseID := range g.SpouseIDs(a) {
+		base := g.BloodKinship(spouseID, b)
+		if base == nil {
+			continue
+		}
+		k := marriageKinship(base, MarriageRelativeOfSpouse, append([]string{a}, base.Path...), g.gender(spouseID))
+		k.genders = append([]string{g.gender(a)}, base.genders...)
+		if best == nil || len(k.Path) < len(best.Path) {
+			best = k
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+	return &Kinship{Kind: KinshipNotRelated, Path: []string{}, CommonAncestors: []string{}}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"family-tree-backend/models"
+)
+
+// Languages supported for kinship labels
+const (
+	LangEnglish = "en"
+	LangArabic  = "ar"
+)
+
+var KinshipLanguages = []string{LangEnglish, LangArabic}
+
+// KinshipLabel renders a kinship in the given language, falling back to English
+func KinshipLabel(k *Kinship, lang string) string {
+	if lang == LangArabic {
+		return arabicLabel(k)
+	}
+	return englishLabel(k)
+}
+
+// KinshipLabels renders a kinship in every supported language
+func KinshipLabels(k *Kinship) map[string]string {
+	labels := make(map[string]string, len(KinshipLanguages))
+	for _, lang := range KinshipLanguages {
+		labels[lang] = KinshipLabel(k, lang)
+	}
+	return labels
+}
+
+func byGender(gender, male, female, neutral string) string {
+	switch gender {
+	case "male":
+		return male
+	case "female":
+		return female
+	default:
+		return neutral
+	}
+}
+
+// ===== ENGLISH =====
+
+var englishOrdinals = []string{"", "first", "second", "third", "fourth", "fifth", "sixth", "seventh", "eighth", "ninth", "tenth"}
+
+func englishOrdinal(n int) string {
+	if n < len(englishOrdinals) {
+		return englishOrdinals[n]
+	}
+	return englishNumericOrdinal(n)
+}
+
+func englishNumericOrdinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// englishGreats prefixes a word with the right number of "great-"s, using
+// "3rd great-" style once it gets long
+func englishGreats(greats int, word string) string {
+	switch {
+	case greats <= 0:
+		return word
+	case greats <= 2:
+		return strings.Repeat("great-", greats) + word
+	default:
+		return englishNumericOrdinal(greats) + " great-" + word
+	}
+}
+
+// englishLineal labels a direct ancestor or descendant n generations away
+func englishLineal(n int, gender string, up bool) string {
+	if up {
+		if n == 1 {
+			return byGender(gender, "father", "mother", "parent")
+		}
+		return englishGreats(n-2, byGender(gender, "grandfather", "grandmother", "grandparent"))
+	}
+	if n == 1 {
+		return byGender(gender, "son", "daughter", "child")
+	}
+	return englishGreats(n-2, byGender(gender, "grandson", "granddaughter", "grandchild"))
+}
+
+func englishBloodLabel(k *Kinship) string {
+	gender := k.Gender()
+	switch k.Kind {
+	case KinshipSelf:
+		return "self"
+	case KinshipAncestor, KinshipDescendant:
+		up := k.Kind == KinshipAncestor
+		n := k.GenerationsDown
+		if up {
+			n = k.GenerationsUp
+		}
+		label := englishLineal(n, gender, up)
+		switch k.Qualifier {
+		case models.ParentStep:
+			if n == 1 {
+				return "step" + label
+			}
+			return "step-" + label
+		case models.ParentAdoptive:
+			if up {
+				return "adoptive " + label
+			}
+			return "adopted " + label
+		case models.ParentFoster:
+			return "foster " + label
+		}
+		return label
+	case KinshipSibling:
+		label := byGender(gender, "brother", "sister", "sibling")
+		if k.Half {
+			return "half-" + label
+		}
+		if k.Qualifier == models.ParentStep {
+			return "step" + label
+		}
+		if k.Qualifier == models.ParentAdoptive {
+			return "adoptive " + label
+		}
+		return label
+	case KinshipAuntUncle:
+		return englishGreats(k.GenerationsUp-2, byGender(gender, "uncle", "aunt", "aunt/uncle"))
+	case KinshipNieceNephew:
+		return englishGreats(k.GenerationsDown-2, byGender(gender, "nephew", "niece", "niece/nephew"))
+	case KinshipCousin:
+		label := englishOrdinal(k.CousinDegree) + " cousin"
+		switch k.Removed {
+		case 0:
+		case 1:
+			label += " once removed"
+		case 2:
+			label += " twice removed"
+		default:
+			label += fmt.Sprintf(" %d times removed", k.Removed)
+		}
+		return label
+	case KinshipSpouse:
+		return byGender(gender, "husband", "wife", "spouse")
+	}
+	return "not related"
+}
+
+func englishLabel(k *Kinship) string {
+	gender := k.Gender()
+	switch k.Marriage {
+	case MarriageSpouseOfRelative:
+		base := k.Base
+		switch {
+		case base.Kind == KinshipSibling:
+			return byGender(gender, "brother-in-law", "sister-in-law", "sibling-in-law")
+		case base.Kind == KinshipDescendant && base.GenerationsDown == 1:
+			return byGender(gender, "son-in-law", "daughter-in-law", "child-in-law")
+		case base.Kind == KinshipAncestor && base.GenerationsUp == 1:
+			return byGender(gender, "stepfather", "stepmother", "step-parent")
+		case base.Kind == KinshipAncestor:
+			return "step-" + englishLineal(base.GenerationsUp, gender, true)
+		case base.Kind == KinshipAuntUncle:
+			return englishGreats(base.GenerationsUp-2, byGender(gender, "uncle", "aunt", "aunt/uncle")) + " by marriage"
+		}
+		return englishBloodLabel(base) + "'s " + byGender(gender, "husband", "wife", "spouse")
+	case MarriageRelativeOfSpouse:
+		base := k.Base
+		switch {
+		case base.Kind == KinshipSibling:
+			return byGender(gender, "brother-in-law", "sister-in-law", "sibling-in-law")
+		case base.Kind == KinshipAncestor:
+			return englishLineal(base.GenerationsUp, gender, true) + "-in-law"
+		case base.Kind == KinshipDescendant && base.GenerationsDown == 1:
+			return byGender(gender, "stepson", "stepdaughter", "stepchild")
+		case base.Kind == KinshipDescendant:
+			return "step-" + englishLineal(base.GenerationsDown, gender, false)
+		}
+		return byGender(k.spouseGender, "husband", "wife", "spouse") + "'s " + englishBloodLabel(base)
+	}
+	return englishBloodLabel(k)
+}
+
+// ===== ARABIC =====
+//
+// Arabic kinship terms distinguish the paternal and maternal side, so labels
+// are built as a construct chain (idafa) walking the path, e.g.
+// "ابن عم الأب" (son of the father's paternal uncle). Only the last noun of a
+// chain takes the definite article.
+
+func arabicDefinite(noun string) string {
+	return "ال" + noun
+}
+
+func arabicChain(nouns []string) string {
+	if len(nouns) == 0 {
+		return ""
+	}
+	if len(nouns) == 1 {
+		return nouns[0]
+	}
+	parts := append([]string{}, nouns[:len(nouns)-1]...)
+	parts = append(parts, arabicDefinite(nouns[len(nouns)-1]))
+	return strings.Join(parts, " ")
+}
+
+// arabicUncle picks عم/عمة (father's side) or خال/خالة (mother's side)
+func arabicUncle(sideGender, gender string) string {
+	if sideGender == "female" {
+		return byGender(gender, "خال", "خالة", "خال")
+	}
+	return byGender(gender, "عم", "عمة", "عم")
+}
+
+func arabicChild(gender string) string {
+	return byGender(gender, "ابن", "ابنة", "ابن")
+}
+
+// arabicAncestorChain describes path[n] as an ancestor of path[0]
+func arabicAncestorChain(k *Kinship, n int) []string {
+	switch {
+	case n <= 0:
+		return nil
+	case n == 1:
+		return []string{byGender(k.genderAt(1), "أب", "أم", "والد")}
+	case n == 2:
+		return []string{byGender(k.genderAt(2), "جد", "جدة", "جد")}
+	}
+	return append([]string{byGender(k.genderAt(n), "جد", "جدة", "جد")}, arabicAncestorChain(k, n-2)...)
+}
+
+// arabicDescendantChain describes path[idx] as a descendant n generations
+// below the start of the path
+func arabicDescendantChain(k *Kinship, idx, n int) []string {
+	switch {
+	case n <= 0:
+		return nil
+	case n == 1:
+		return []string{arabicChild(k.genderAt(idx))}
+	case n == 2:
+		return []string{byGender(k.genderAt(idx), "حفيد", "حفيدة", "حفيد")}
+	}
+	return append([]string{byGender(k.genderAt(idx), "حفيد", "حفيدة", "حفيد")}, arabicDescendantChain(k, idx-2, n-2)...)
+}
+
+// arabicBloodChain builds the construct chain for a blood relation
+func arabicBloodChain(k *Kinship) []string {
+	up, down := k.GenerationsUp, k.GenerationsDown
+	last := len(k.Path) - 1
+
+	switch k.Kind {
+	case KinshipAncestor:
+		return arabicAncestorChain(k, up)
+	case KinshipDescendant:
+		return arabicDescendantChain(k, last, down)
+	case KinshipSibling, KinshipAuntUncle, KinshipNieceNephew, KinshipCousin:
+		// Walk down from the second person to the common ancestor's child
+		// (the branch), name the branch relative to one of the first
+		// person's ancestors, then name that ancestor.
+		var nouns []string
+		branch := up + 1
+		for idx := last; idx > branch; idx-- {
+			nouns = append(nouns, arabicChild(k.genderAt(idx)))
+		}
+		if up == 1 {
+			nouns = append(nouns, byGender(k.genderAt(branch), "أخ", "أخت", "أخ"))
+		} else {
+			nouns = append(nouns, arabicUncle(k.genderAt(up-1), k.genderAt(branch)))
+		}
+		return append(nouns, arabicAncestorChain(k, up-2)...)
+	}
+	return nil
+}
+
+func arabicBloodLabel(k *Kinship) string {
+	gender := k.Gender()
+	switch k.Kind {
+	case KinshipSelf:
+		return "نفس الشخص"
+	case KinshipSpouse:
+		return byGender(gender, "زوج", "زوجة", "زوج")
+	case KinshipNotRelated:
+		return "لا توجد صلة قرابة"
+	case KinshipSibling:
+		if k.Half {
+			side := byGender(k.sharedParentGender, "لأب", "لأم", "غير شقيق")
+			return byGender(gender, "أخ", "أخت", "أخ") + " " + side
+		}
+		if len(k.CommonAncestors) > 1 {
+			return byGender(gender, "أخ شقيق", "أخت شقيقة", "أخ شقيق")
+		}
+	case KinshipAncestor:
+		if k.Qualifier == models.ParentStep && k.GenerationsUp == 1 {
+			return byGender(gender, "زوج الأم", "زوجة الأب", "زوج الوالد")
+		}
+	case KinshipDescendant:
+		if k.Qualifier == models.ParentStep && k.GenerationsDown == 1 {
+			return byGender(gender, "ربيب", "ربيبة", "ربيب")
+		}
+	}
+
+	label := arabicChain(arabicBloodChain(k))
+	switch k.Qualifier {
+	case models.ParentAdoptive:
+		label += " بالتبني"
+	case models.ParentFoster:
+		label += " بالرعاية"
+	}
+	return label
+}
+
+func arabicLabel(k *Kinship) string {
+	gender := k.Gender()
+	switch k.Marriage {
+	case MarriageSpouseOfRelative:
+		// e.g. زوج الأخت (sister's husband), زوجة ابن العم
+		nouns := append([]string{byGender(gender, "زوج", "زوجة", "زوج")}, arabicBloodChain(k.Base)...)
+		return arabicChain(nouns)
+	case MarriageRelativeOfSpouse:
+		// e.g. أخ الزوجة (wife's brother), أم الزوج
+		nouns := append(arabicBloodChain(k.Base), byGender(k.spouseGender, "زوج", "زوجة", "زوج"))
+		return arabicChain(nouns)
+	}
+	return arabicBloodLabel(k)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMergeSamePerson    = errors.New("a person can't be merged with themselves")
+	ErrMergeLinkedPersons = errors.New("both persons are linked to different accounts")
+)
+
+// MergePersons folds duplicate into keep. keep's values win except for the
+// fields named in take, which come from duplicate; fields keep lacks are
+// filled from duplicate and photos and life events are combined. Every
+// reference to duplicate moves to keep, then duplicate is deleted. Both
+// persons get a merge revision.
+func MergePersons(db *gorm.DB, treeID, keepID, duplicateID string, take []string, actorID string) (*models.Person, error) {
+	if keepID == duplicateID {
+		return nil, ErrMergeSamePerson
+	}
+	for _, name := range take {
+		if !personFieldNames[name] || unrevisionedFields[name] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+	}
+
+	var merged models.Person
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var persons []models.Person
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND family_tree_id = ?", []string{keepID, duplicateID}, treeID).
+			Find(&persons).Error; err != nil {
+			return err
+		}
+		if len(persons) != 2 {
+			return ErrPersonNotFound
+		}
+		keep, duplicate := persons[0], persons[1]
+		if keep.ID != keepID {
+			keep, duplicate = duplicate, keep
+		}
+		if keep.AuthUserID != "" && duplicate.AuthUserID != "" && keep.AuthUserID != duplicate.AuthUserID {
+			return ErrMergeLinkedPersons
+		}
+
+		if err := mergeFields(&keep, &duplicate, take, &merged); err != nil {
+			return err
+		}
+		merged.SearchText = PersonSearchText(&merged)
+		if err := tx.Save(&merged).Error; err != nil {
+			return err
+		}
+
+		if err := moveRelationships(tx, keep.ID, duplicate.ID); err != nil {
+			return err
+		}
+		for _, ref := range []interface{}{&models.LinkRequest{}, &models.EditProposal{}, &models.Invitation{}, &models.Citation{}} {
+			if err := tx.Model(ref).Where("person_id = ?", duplicate.ID).Update("person_id", keep.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&duplicate).Error; err != nil {
+			return err
+		}
+		if err := RecordPersonRevision(tx, &keep, &merged, actorID, models.RevisionMerge, duplicate.ID); err != nil {
+			return err
+		}
+		return RecordPersonRevision(tx, &duplicate, nil, actorID, models.RevisionMerge, keep.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// mergeFields builds the merged person from keep and duplicate
+func mergeFields(keep, duplicate *models.Person, take []string, merged *models.Person) error {
+	fields, err := personFields(keep)
+	if err != nil {
+		return err
+	}
+	other, err := personFields(duplicate)
+	if err != nil {
+		return err
+	}
+	for name, value := range other {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	for _, name := range take {
+		if value, ok := other[name]; ok {
+			fields[name] = value
+		} else {
+			delete(fields, name)
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return err
+	}
+
+	merged.Photos = unionStrings(keep.Photos, duplicate.Photos)
+	merged.LifeEvents = append(models.LifeEvents{}, keep.LifeEvents...)
+	seen := map[string]bool{}
+	for _, e := range keep.LifeEvents {
+		seen[e.ID] = true
+	}
+	for _, e := range duplicate.LifeEvents {
+		if !seen[e.ID] {
+			merged.LifeEvents = append(merged.LifeEvents, e)
+		}
+	}
+
+	merged.ID = keep.ID
+	merged.FamilyTreeID = keep.FamilyTreeID
+	merged.CreatedAt = keep.CreatedAt
+	if duplicate.CreatedAt.Before(keep.CreatedAt) {
+		merged.CreatedAt = duplicate.CreatedAt
+	}
+	merged.UpdatedAt = time.Now()
+
+	// Field privacy isn't in the revisioned fields; keep the choices of both,
+	// the kept person's where they differ
+	for _, fp := range []models.FieldPrivacy{duplicate.FieldPrivacy, keep.FieldPrivacy} {
+		for field, level := range fp {
+			if merged.FieldPrivacy == nil {
+				merged.FieldPrivacy = models.FieldPrivacy{}
+			}
+			merged.FieldPrivacy[field] = level
+		}
+	}
+	return nil
+}
+
+func unionStrings(a, b models.JSONStringArray) models.JSONStringArray {
+	out := models.JSONStringArray{}
+	seen := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// moveRelationships points duplicate's edges at keep. Edges between the two
+// and edges keep already has are dropped.
+func moveRelationships(tx *gorm.DB, keepID, duplicateID string) error {
+	var edges []models.Relationship
+	if err := tx.Where("person_id = ? OR related_person_id = ?", duplicateID, duplicateID).Find(&edges).Error; err != nil {
+		return err
+	}
+
+	for i := range edges {
+		edge := &edges[i]
+		if edge.Involves(keepID) {
+			if err := tx.Delete(edge).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if edge.PersonID == duplicateID {
+			edge.PersonID = keepID
+		} else {
+			edge.RelatedPersonID = keepID
+		}
+
+		exists, err := relationshipExists(tx, edge)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := tx.Delete(edge).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if edge.Type == models.RelationshipParentChild {
+			cyclic, err := isAncestor(tx, edge.RelatedPersonID, edge.PersonID)
+			if err != nil {
+				return err
+			}
+			if cyclic {
+				return ErrRelationshipCycle
+			}
+		}
+
+		edge.UpdatedAt = time.Now()
+		if err := tx.Model(edge).Select("person_id", "related_person_id", "updated_at").Updates(edge).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"family-tree-backend/auth"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MFAIssuer is the account name shown in authenticator apps
+const MFAIssuer = "Family Tree"
+
+const (
+	recoveryCodeCount = 10
+	// Wrong codes allowed before verification is paused, so the six digits
+	// can't be guessed
+	maxMFAFailures = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFACodeInvalid    = errors.New("invalid verification code")
+	ErrMFALocked         = errors.New("too many wrong codes; try again later")
+)
+
+// StartMFAEnrollment creates a new authenticator secret for the user. It is
+// not used until ConfirmMFAEnrollment, so starting over is harmless.
+func StartMFAEnrollment(db *gorm.DB, user *models.User) (secret, uri string, err error) {
+	if user.MFAEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err = auth.NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	record := models.MFASecret{UserID: user.ID, Secret: secret, CreatedAt: now, UpdatedAt: now}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_step", "enabled_at", "created_at", "updated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Name
+	}
+	return secret, auth.TOTPURI(MFAIssuer, account, secret), nil
+}
+
+// ConfirmMFAEnrollment turns on two-factor authentication once the user
+// enters a code from their app, and returns their recovery codes
+func ConfirmMFAEnrollment(db *gorm.DB, user *models.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.MFASecret
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, "user_id = ?", user.ID).Error; err != nil {
+			return ErrMFANotEnabled
+		}
+		step, ok := auth.ValidateTOTP(record.Secret, code, time.Now())
+		if !ok {
+			return ErrMFACodeInvalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&record).Updates(map[string]interface{}{
+			"last_step":  step,
+			"enabled_at": now,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.MFAEnabled = true
+	return codes, nil
+}
+
+// VerifyMFA checks a code from the user's authenticator app or one of their
+// recovery codes. Each TOTP step and recovery code is accepted only once, and
+// repeated wrong codes pause verification for a while.
+func VerifyMFA(db *gorm.DB, userID, code string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.MFASecret
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&record, "user_id = ? AND enabled_at IS NOT NULL", userID).Error
+		if err != nil {
+			return ErrMFANotEnabled
+		}
+		if record.LockedUntil != nil && time.Now().Before(*record.LockedUntil) {
+			return ErrMFALocked
+		}
+
+		verified := map[string]interface{}{
+			"failed_attempts": 0,
+			"locked_until":    nil,
+			"updated_at":      time.Now(),
+		}
+		if step, ok := auth.ValidateTOTP(record.Secret, code, time.Now()); ok {
+			if step <= record.LastStep {
+				return ErrMFACodeInvalid
+			}
+			verified["last_step"] = step
+			return tx.Model(&record).Updates(verified).Error
+		}
+
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, auth.HashToken(NormalizeInviteCode(code))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMFACodeInvalid
+		}
+		return tx.Model(&record).Updates(verified).Error
+	})
+
+	// Counted outside the transaction, which rolled back
+	if errors.Is(err, ErrMFACodeInvalid) {
+		db.Model(&models.MFASecret{}).Where("user_id = ?", userID).
+			Update("failed_attempts", gorm.Expr("failed_attempts + 1"))
+		db.Model(&models.MFASecret{}).Where("user_id = ? AND failed_attempts >= ?", userID, maxMFAFailures).
+			Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": time.Now().Add(mfaLockout)})
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes replaces all of a user's recovery codes
+func RegenerateRecoveryCodes(db *gorm.DB, userID string) ([]string, error) {
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes
+func RemainingRecoveryCodes(db *gorm.DB, userID string) int64 {
+	var count int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// DisableMFA removes the authenticator and recovery codes
+func DisableMFA(db *gorm.DB, userID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFASecret{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("mfa_enabled", false).Error
+	})
+}
+
+// MarkSessionMFAVerified records a second-factor check on a session
+func MarkSessionMFAVerified(db *gorm.DB, sessionID string) error {
+	return db.Model(&models.Session{}).Where("id = ?", sessionID).Update("mfa_verified_at", time.Now()).Error
+}
+
+// replaceRecoveryCodes deletes old recovery codes and returns new ones, formatted
+// like "K7QM2-XH9TA". They use the invite code alphabet so they are easy to
+// read off paper.
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := NewInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		records = append(records, models.RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  auth.HashToken(code),
+			CreatedAt: time.Now(),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
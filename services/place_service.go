@@ -0,0 +1,542 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/geocode"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPlaceNotFound = errors.New("place not found")
+	ErrInvalidPlace  = errors.New("invalid place")
+	ErrPlaceInUse    = errors.New("place is still referenced")
+	ErrNoGeocoder    = errors.New("no geocoder is configured")
+)
+
+// PlaceIndex holds a tree's places for walking the hierarchy
+type PlaceIndex struct {
+	Places   map[string]*models.Place
+	children map[string][]string // keyed by parent ID, "" for top-level places
+}
+
+// LoadPlaceIndex loads every place of a family tree
+func LoadPlaceIndex(db *gorm.DB, familyTreeID string) (*PlaceIndex, error) {
+	var places []models.Place
+	if err := db.Where("family_tree_id = ?", familyTreeID).Find(&places).Error; err != nil {
+		return nil, err
+	}
+	idx := &PlaceIndex{Places: map[string]*models.Place{}, children: map[string][]string{}}
+	for i := range places {
+		idx.add(&places[i])
+	}
+	return idx, nil
+}
+
+func (idx *PlaceIndex) add(p *models.Place) {
+	idx.Places[p.ID] = p
+	idx.children[p.ParentID] = append(idx.children[p.ParentID], p.ID)
+}
+
+// Path is the place followed by the places enclosing it
+func (idx *PlaceIndex) Path(id string) []*models.Place {
+	var path []*models.Place
+	for seen := map[string]bool{}; idx.Places[id] != nil && !seen[id]; id = idx.Places[id].ParentID {
+		seen[id] = true
+		path = append(path, idx.Places[id])
+	}
+	return path
+}
+
+// FullName joins the path, e.g. "Cairo, Cairo Governorate, Egypt"
+func (idx *PlaceIndex) FullName(id string) string {
+	var parts []string
+	for _, p := range idx.Path(id) {
+		parts = append(parts, p.Name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Children lists the places directly inside a place, by name
+func (idx *PlaceIndex) Children(id string) []*models.Place {
+	var children []*models.Place
+	for _, childID := range idx.children[id] {
+		children = append(children, idx.Places[childID])
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+// Within is the place and every place inside it
+func (idx *PlaceIndex) Within(id string) map[string]bool {
+	within := map[string]bool{}
+	queue := []string{id}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if within[next] {
+			continue
+		}
+		within[next] = true
+		queue = append(queue, idx.children[next]...)
+	}
+	return within
+}
+
+// Coordinates are the place's, or the nearest enclosing place's when the
+// place itself was never geocoded
+func (idx *PlaceIndex) Coordinates(id string) (lat, lon *float64) {
+	for _, p := range idx.Path(id) {
+		if p.Latitude != nil && p.Longitude != nil {
+			return p.Latitude, p.Longitude
+		}
+	}
+	return nil, nil
+}
+
+// placeKeys are the keys a place is matched on
+func placeKeys(p *models.Place) map[string]bool {
+	keys := map[string]bool{geocode.Key(p.Name): true}
+	for _, name := range p.AlternateNames {
+		keys[geocode.Key(name)] = true
+	}
+	return keys
+}
+
+// Find matches free text the way the geocoder does: the first part names
+// the place and the rest name places enclosing it. Exact names rank first.
+func (idx *PlaceIndex) Find(text string) []*models.Place {
+	parts := geocode.SplitQuery(text)
+	if len(parts) == 0 {
+		return nil
+	}
+	key := geocode.Key(parts[0])
+
+	var found []*models.Place
+	for _, p := range idx.Places {
+		if !placeKeys(p)[key] || !idx.enclosedBy(p.ID, parts[1:]) {
+			continue
+		}
+		found = append(found, p)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		ei, ej := geocode.Key(found[i].Name) == key, geocode.Key(found[j].Name) == key
+		if ei != ej {
+			return ei
+		}
+		return found[i].ID < found[j].ID
+	})
+	return found
+}
+
+// enclosedBy reports whether every part names a place enclosing id
+func (idx *PlaceIndex) enclosedBy(id string, parts []string) bool {
+	path := idx.Path(id)[1:]
+	for _, part := range parts {
+		key, found := geocode.Key(part), false
+		for _, p := range path {
+			if placeKeys(p)[key] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search lists places with a name starting with q, for autocompletion
+func (idx *PlaceIndex) Search(q string) []*models.Place {
+	prefix := geocode.Key(q)
+	var found []*models.Place
+	for _, p := range idx.Places {
+		for key := range placeKeys(p) {
+			if strings.HasPrefix(key, prefix) {
+				found = append(found, p)
+				break
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found
+}
+
+// ResolvePlace finds the tree's place for free text such as "Nablus,
+// Palestine", creating it if needed. New places are geocoded when a
+// geocoder is configured; otherwise the comma-separated parts are nested as
+// written.
+func ResolvePlace(db *gorm.DB, geocoder geocode.Geocoder, familyTreeID, text string) (*models.Place, error) {
+	idx, err := LoadPlaceIndex(db, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePlace(db, idx, geocoder, familyTreeID, text)
+}
+
+func resolvePlace(tx *gorm.DB, idx *PlaceIndex, geocoder geocode.Geocoder, familyTreeID, text string) (*models.Place, error) {
+	parts := geocode.SplitQuery(text)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidPlace)
+	}
+	if found := idx.Find(text); len(found) > 0 {
+		return found[0], nil
+	}
+
+	if geocoder != nil {
+		results, err := geocoder.Geocode(context.Background(), text)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) > 0 {
+			return createPlaceHierarchy(tx, idx, familyTreeID, results[0].Hierarchy)
+		}
+	}
+
+	levels := make([]geocode.Place, len(parts))
+	for i, part := range parts {
+		levels[i] = geocode.Place{Name: part}
+	}
+	return createPlaceHierarchy(tx, idx, familyTreeID, levels)
+}
+
+// createPlaceHierarchy creates the places of a hierarchy (most specific
+// first) that the tree doesn't have yet and returns the most specific
+func createPlaceHierarchy(tx *gorm.DB, idx *PlaceIndex, familyTreeID string, levels []geocode.Place) (*models.Place, error) {
+	var place *models.Place
+	parentID := ""
+	for i := len(levels) - 1; i >= 0; i-- {
+		level := levels[i]
+		place = idx.existing(parentID, level)
+		if place == nil {
+			place = &models.Place{
+				ID:             uuid.New().String(),
+				FamilyTreeID:   familyTreeID,
+				ParentID:       parentID,
+				Name:           level.Name,
+				Type:           placeType(level.Kind),
+				AlternateNames: models.JSONStringArray(append([]string{}, level.AlternateNames...)),
+				GeocoderID:     level.ID,
+				CreatedAt:      time.Now(),
+				UpdatedAt:      time.Now(),
+			}
+			if level.ID != "" {
+				lat, lon := level.Latitude, level.Longitude
+				place.Latitude, place.Longitude = &lat, &lon
+			}
+			if err := tx.Create(place).Error; err != nil {
+				return nil, err
+			}
+			idx.add(place)
+		}
+		parentID = place.ID
+	}
+	return place, nil
+}
+
+// existing finds a level of a hierarchy the tree already has: by geocoder
+// ID, or by name among the parent's children
+func (idx *PlaceIndex) existing(parentID string, level geocode.Place) *models.Place {
+	if level.ID != "" {
+		for _, p := range idx.Places {
+			if p.GeocoderID == level.ID {
+				return p
+			}
+		}
+	}
+	key := geocode.Key(level.Name)
+	for _, id := range idx.children[parentID] {
+		if placeKeys(idx.Places[id])[key] {
+			return idx.Places[id]
+		}
+	}
+	return nil
+}
+
+func placeType(kind string) models.PlaceType {
+	switch kind {
+	case geocode.KindCountry:
+		return models.PlaceCountry
+	case geocode.KindRegion:
+		return models.PlaceRegion
+	case geocode.KindCity:
+		return models.PlaceCity
+	}
+	return models.PlaceOther
+}
+
+// ValidatePlaceParent checks a place may be moved inside parentID: the
+// parent is in the same tree and is not the place or inside it
+func ValidatePlaceParent(db *gorm.DB, familyTreeID, placeID, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	idx, err := LoadPlaceIndex(db, familyTreeID)
+	if err != nil {
+		return err
+	}
+	if idx.Places[parentID] == nil {
+		return fmt.Errorf("%w: parent %s", ErrPlaceNotFound, parentID)
+	}
+	if placeID != "" && idx.Within(placeID)[parentID] {
+		return fmt.Errorf("%w: a place cannot be inside itself", ErrInvalidPlace)
+	}
+	return nil
+}
+
+// ResolveEventPlaces checks that the places life events refer to are in the
+// tree, and fills in the location text of events that only give a place
+func ResolveEventPlaces(db *gorm.DB, familyTreeID string, events models.LifeEvents) error {
+	linked := false
+	for _, e := range events {
+		linked = linked || e.PlaceID != ""
+	}
+	if !linked {
+		return nil
+	}
+
+	idx, err := LoadPlaceIndex(db, familyTreeID)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		e := &events[i]
+		if e.PlaceID == "" {
+			continue
+		}
+		if idx.Places[e.PlaceID] == nil {
+			return fmt.Errorf("%w: %s", ErrPlaceNotFound, e.PlaceID)
+		}
+		if e.Location == "" {
+			e.Location = idx.FullName(e.PlaceID)
+		}
+	}
+	return nil
+}
+
+// ApplyEventPlace checks an event's place is in its tree and fills in the
+// location and map link when they are empty
+func ApplyEventPlace(db *gorm.DB, event *models.Event) error {
+	if event.PlaceID == "" {
+		return nil
+	}
+	idx, err := LoadPlaceIndex(db, event.FamilyTreeID)
+	if err != nil {
+		return err
+	}
+	if idx.Places[event.PlaceID] == nil {
+		return fmt.Errorf("%w: %s", ErrPlaceNotFound, event.PlaceID)
+	}
+	if event.Location == "" {
+		event.Location = idx.FullName(event.PlaceID)
+	}
+	if lat, lon := idx.Coordinates(event.PlaceID); event.MapLink == "" && lat != nil {
+		event.MapLink = fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", *lat, *lon)
+	}
+	return nil
+}
+
+// PlaceLinkResult counts what LinkTreePlaces changed
+type PlaceLinkResult struct {
+	LifeEvents int `json:"lifeEvents"` // Life events now referencing a place
+	Events     int `json:"events"`
+	Created    int `json:"created"` // Places added to the tree
+}
+
+// LinkTreePlaces links every free-text location in a tree that has no place
+// yet, creating places as needed. Persons get an update revision by actorID.
+func LinkTreePlaces(db *gorm.DB, geocoder geocode.Geocoder, familyTreeID, actorID string) (*PlaceLinkResult, error) {
+	result := &PlaceLinkResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		idx, err := LoadPlaceIndex(tx, familyTreeID)
+		if err != nil {
+			return err
+		}
+		before := len(idx.Places)
+
+		resolved := map[string]*models.Place{}
+		resolve := func(text string) (*models.Place, error) {
+			if p, ok := resolved[text]; ok {
+				return p, nil
+			}
+			p, err := resolvePlace(tx, idx, geocoder, familyTreeID, text)
+			resolved[text] = p
+			return p, err
+		}
+
+		var persons []models.Person
+		if err := tx.Where("family_tree_id = ?", familyTreeID).Find(&persons).Error; err != nil {
+			return err
+		}
+		for i := range persons {
+			person := &persons[i]
+			old := *person
+			old.LifeEvents = append(models.LifeEvents{}, person.LifeEvents...)
+
+			changed := false
+			for j := range person.LifeEvents {
+				e := &person.LifeEvents[j]
+				if e.PlaceID != "" || strings.TrimSpace(e.Location) == "" {
+					continue
+				}
+				place, err := resolve(e.Location)
+				if err != nil {
+					return err
+				}
+				e.PlaceID = place.ID
+				changed = true
+				result.LifeEvents++
+			}
+			if !changed {
+				continue
+			}
+			if err := tx.Model(person).Update("life_events", person.LifeEvents).Error; err != nil {
+				return err
+			}
+			if err := RecordPersonRevision(tx, &old, person, actorID, models.RevisionUpdate, ""); err != nil {
+				return err
+			}
+		}
+
+		var events []models.Event
+		if err := tx.Where("family_tree_id = ? AND (place_id = '' OR place_id IS NULL) AND location <> ''", familyTreeID).Find(&events).Error; err != nil {
+			return err
+		}
+		for _, event := range events {
+			place, err := resolve(event.Location)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&event).Update("place_id", place.ID).Error; err != nil {
+				return err
+			}
+			result.Events++
+		}
+
+		result.Created = len(idx.Places) - before
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeletePlace removes a place nothing refers to: no life event, event or
+// place inside it
+func DeletePlace(db *gorm.DB, familyTreeID, placeID string) error {
+	var place models.Place
+	if err := db.First(&place, "id = ? AND family_tree_id = ?", placeID, familyTreeID).Error; err != nil {
+		return ErrPlaceNotFound
+	}
+
+	var children, events, persons int64
+	if err := db.Model(&models.Place{}).Where("parent_id = ?", placeID).Count(&children).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.Event{}).Where("place_id = ?", placeID).Count(&events).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.Person{}).Where("family_tree_id = ? AND life_events LIKE ?", familyTreeID, `%"placeId":"`+placeID+`"%`).Count(&persons).Error; err != nil {
+		return err
+	}
+	if children+events+persons > 0 {
+		return fmt.Errorf("%w: %d places inside it, %d events, %d persons", ErrPlaceInUse, children, events, persons)
+	}
+	return db.Delete(&place).Error
+}
+
+// PlaceVisit is a life event at a place
+type PlaceVisit struct {
+	PersonID   string        `json:"personId"`
+	PersonName string        `json:"personName"`
+	EventID    string        `json:"eventId"`
+	EventTitle string        `json:"eventTitle"`
+	Date       *gendate.Date `json:"date,omitempty"`
+	PlaceID    string        `json:"placeId"`
+	PlaceName  string        `json:"placeName"`
+	Latitude   *float64      `json:"latitude,omitempty"`
+	Longitude  *float64      `json:"longitude,omitempty"`
+}
+
+func placeVisit(idx *PlaceIndex, p *models.Person, e models.LifeEvent) PlaceVisit {
+	lat, lon := idx.Coordinates(e.PlaceID)
+	return PlaceVisit{
+		PersonID:   p.ID,
+		PersonName: p.FullName(),
+		EventID:    e.ID,
+		EventTitle: e.Title,
+		Date:       e.Date,
+		PlaceID:    e.PlaceID,
+		PlaceName:  idx.FullName(e.PlaceID),
+		Latitude:   lat,
+		Longitude:  lon,
+	}
+}
+
+// sortVisits orders visits by date; undated ones keep their order at the end
+func sortVisits(visits []PlaceVisit) {
+	sort.SliceStable(visits, func(i, j int) bool {
+		if visits[i].Date.IsZero() || visits[j].Date.IsZero() {
+			return !visits[i].Date.IsZero() && visits[j].Date.IsZero()
+		}
+		return gendate.Compare(visits[i].Date, visits[j].Date) < 0
+	})
+}
+
+// PersonsAtPlace lists the life events at a place or anywhere inside it,
+// e.g. everyone born in Egypt. A non-empty title keeps only events with that
+// title, such as "Birth". Events hidden from the viewer are left out.
+func PersonsAtPlace(db *gorm.DB, viewer Viewer, familyTreeID, placeID, title string) ([]PlaceVisit, error) {
+	idx, err := LoadPlaceIndex(db, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	if idx.Places[placeID] == nil {
+		return nil, ErrPlaceNotFound
+	}
+	within := idx.Within(placeID)
+
+	var persons []models.Person
+	if err := db.Where("family_tree_id = ? AND life_events LIKE ?", familyTreeID, `%"placeId"%`).Find(&persons).Error; err != nil {
+		return nil, err
+	}
+	RedactPersons(viewer, persons)
+	visits := []PlaceVisit{}
+	for i := range persons {
+		for _, e := range persons[i].LifeEvents {
+			if within[e.PlaceID] && (title == "" || strings.EqualFold(e.Title, title)) {
+				visits = append(visits, placeVisit(idx, &persons[i], e))
+			}
+		}
+	}
+	sortVisits(visits)
+	return visits, nil
+}
+
+// PersonPlaces lists the places of a person's life in date order, for
+// drawing their moves on a map
+func PersonPlaces(db *gorm.DB, person *models.Person) ([]PlaceVisit, error) {
+	idx, err := LoadPlaceIndex(db, person.FamilyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	visits := []PlaceVisit{}
+	for _, e := range person.LifeEvents {
+		if idx.Places[e.PlaceID] != nil {
+			visits = append(visits, placeVisit(idx, person, e))
+		}
+	}
+	sortVisits(visits)
+	return visits, nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	"family-tree-backend/geocode"
+	"family-tree-backend/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens an empty in-memory database with the given tables
+func testDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestResolvePlaceWithGazetteer(t *testing.T) {
+	db := testDB(t, &models.Place{})
+	g, err := geocode.LoadGazetteer("../geocode/gazetteer.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(text string) *models.Place {
+		t.Helper()
+		p, err := ResolvePlace(db, g, "tree-1", text)
+		if err != nil {
+			t.Fatalf("ResolvePlace(%q): %v", text, err)
+		}
+		return p
+	}
+
+	egypt := resolve("Alexandria, Egypt")
+	virginia := resolve("Alexandria, Virginia")
+	if egypt.ID == virginia.ID {
+		t.Fatal("both Alexandrias resolved to one place")
+	}
+	if egypt.GeocoderID != "eg-alexandria" || virginia.GeocoderID != "us-alexandria" {
+		t.Errorf("geocoder IDs = %q, %q", egypt.GeocoderID, virginia.GeocoderID)
+	}
+
+	idx, err := LoadPlaceIndex(db, "tree-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.FullName(virginia.ID); got != "Alexandria, Virginia, United States" {
+		t.Errorf("FullName = %q", got)
+	}
+
+	// Other spellings and scripts find the place already in the tree
+	for _, text := range []string{"الإسكندرية", "الإسكندرية، مصر", "Al-Iskandariyah, Misr", "alexandria, egypt"} {
+		if p := resolve(text); p.ID != egypt.ID {
+			t.Errorf("ResolvePlace(%q) = %s (%s), want %s", text, p.ID, p.Name, egypt.ID)
+		}
+	}
+	if p := resolve("Alexandria, VA"); p.ID != virginia.ID {
+		t.Errorf("ResolvePlace(%q) = %s, want %s", "Alexandria, VA", p.ID, virginia.ID)
+	}
+
+	var count int64
+	db.Model(&models.Place{}).Count(&count)
+	if count != 6 { // Two cities, a governorate, a state and two countries
+		t.Errorf("%d places, want 6", count)
+	}
+}
+
+func TestResolvePlaceWithoutGeocoder(t *testing.T) {
+	db := testDB(t, &models.Place{})
+
+	nablus, err := ResolvePlace(db, nil, "tree-1", "Nablus, Palestine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jenin, err := ResolvePlace(db, nil, "tree-1", "Jenin, Palestine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nablus.ParentID == "" || nablus.ParentID != jenin.ParentID {
+		t.Errorf("parents = %q, %q; want one shared place", nablus.ParentID, jenin.ParentID)
+	}
+	if nablus.Latitude != nil {
+		t.Error("a place that was never geocoded has coordinates")
+	}
+
+	again, err := ResolvePlace(db, nil, "tree-1", "nablus")
+	if err != nil || again.ID != nablus.ID {
+		t.Errorf("ResolvePlace(%q) = %v, %v; want %s", "nablus", again, err, nablus.ID)
+	}
+	if _, err := ResolvePlace(db, nil, "tree-1", " , "); err == nil {
+		t.Error("an empty name resolved")
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// LivingYears is how long after birth a person with no recorded death is
+// presumed to be living
+const LivingYears = 100
+
+// LivingName stands in for the first name of a living person shown outside
+// their tree
+const LivingName = "Living"
+
+// CloseFamilyDegrees is how many parent, child, spouse or sibling links away
+// a relative still counts as close family: grandparents, grandchildren,
+// in-laws, nieces and nephews are two
+const CloseFamilyDegrees = 2
+
+// Life event titles that mean a person has died
+var deathEvents = map[string]bool{"Death": true, "Burial": true, "Cremation": true}
+
+var ErrInvalidPrivacy = errors.New("invalid privacy setting")
+
+// ValidateFieldPrivacy checks every field is one of models.PrivacyFields
+// with a known setting. An empty setting removes the field's own privacy.
+func ValidateFieldPrivacy(fields models.FieldPrivacy) error {
+	for field, level := range fields {
+		known := false
+		for _, f := range models.PrivacyFields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidPrivacy, field)
+		}
+		switch level {
+		case "", models.PrivacyPublic, models.PrivacyMembers, models.PrivacyFamily, models.PrivacyPrivate:
+		default:
+			return fmt.Errorf("%w: %s can't be %q", ErrInvalidPrivacy, field, level)
+		}
+		if level == "" {
+			delete(fields, field)
+		}
+	}
+	return nil
+}
+
+// Viewer is who persons are shown to. The zero Viewer is the public.
+type Viewer struct {
+	UserID       string
+	FamilyTreeID string // The tree the viewer is a member of
+	CanEdit      bool   // person:edit in that tree; editors see everyone
+	family       *familyCircle
+}
+
+// NewViewer returns a member of a tree as a viewer. Their close family is
+// looked up the first time a field shared with family needs it.
+func NewViewer(db *gorm.DB, userID, familyTreeID string, canEdit bool) Viewer {
+	v := Viewer{UserID: userID, FamilyTreeID: familyTreeID, CanEdit: canEdit}
+	if userID != "" && familyTreeID != "" {
+		v.family = &familyCircle{db: db, userID: userID, treeID: familyTreeID}
+	}
+	return v
+}
+
+// familyCircle is the persons within CloseFamilyDegrees of the persons
+// linked to a user
+type familyCircle struct {
+	db     *gorm.DB
+	userID string
+	treeID string
+	ids    map[string]bool
+}
+
+func (f *familyCircle) has(personID string) bool {
+	if f == nil {
+		return false
+	}
+	if f.ids == nil {
+		// On a failed lookup nobody is close family, which hides more, not less
+		f.ids, _ = closeFamily(f.db, f.treeID, f.userID)
+		if f.ids == nil {
+			f.ids = map[string]bool{}
+		}
+	}
+	return f.ids[personID]
+}
+
+// closeFamily walks the tree's edges outward from the user's persons
+func closeFamily(db *gorm.DB, treeID, userID string) (map[string]bool, error) {
+	var selves []string
+	if err := db.Model(&models.Person{}).Where("family_tree_id = ? AND auth_user_id = ?", treeID, userID).Pluck("id", &selves).Error; err != nil {
+		return nil, err
+	}
+	var edges []models.Relationship
+	if err := db.Select("person_id, related_person_id").Where("family_tree_id = ?", treeID).Find(&edges).Error; err != nil {
+		return nil, err
+	}
+
+	neighbours := map[string][]string{}
+	for _, e := range edges {
+		neighbours[e.PersonID] = append(neighbours[e.PersonID], e.RelatedPersonID)
+		neighbours[e.RelatedPersonID] = append(neighbours[e.RelatedPersonID], e.PersonID)
+	}
+	seen := map[string]bool{}
+	for _, id := range selves {
+		seen[id] = true
+	}
+	frontier := selves
+	for degree := 0; degree < CloseFamilyDegrees; degree++ {
+		var next []string
+		for _, id := range frontier {
+			for _, other := range neighbours[id] {
+				if !seen[other] {
+					seen[other] = true
+					next = append(next, other)
+				}
+			}
+		}
+		frontier = next
+	}
+	return seen, nil
+}
+
+// IsLiving reports whether a person is treated as living: the explicit flag
+// when set, otherwise anyone with no recorded death who could have been born
+// within the last LivingYears. Without a birth date a person is presumed
+// living.
+func IsLiving(p *models.Person, now time.Time) bool {
+	if p.Living != nil {
+		return *p.Living
+	}
+	if !p.DeathDate.IsZero() {
+		return false
+	}
+	for _, event := range p.LifeEvents {
+		if deathEvents[event.Title] {
+			return false
+		}
+	}
+	if latest, ok := p.BirthDate.Latest(); ok && latest.AddDate(LivingYears, 0, 0).Before(now) {
+		return false
+	}
+	return true
+}
+
+// isSelf reports whether the viewer is the user linked to the person
+func (v Viewer) isSelf(p *models.Person) bool {
+	return v.UserID != "" && p.AuthUserID == v.UserID
+}
+
+func (v Viewer) isMember(p *models.Person) bool {
+	return v.FamilyTreeID != "" && v.FamilyTreeID == p.FamilyTreeID
+}
+
+// CanSeeDetails reports whether the viewer may see a person's details.
+// Editors of the tree and the person themselves always may; a private person
+// is hidden from everyone else. Otherwise the deceased and public persons are
+// shown to all, and the living to members of their tree. Fields with their
+// own privacy are decided by CanSeeField.
+func CanSeeDetails(v Viewer, p *models.Person) bool {
+	switch {
+	case v.isMember(p) && v.CanEdit, v.isSelf(p):
+		return true
+	case p.Privacy == models.PrivacyPrivate:
+		return false
+	case p.Privacy == models.PrivacyPublic, !IsLiving(p, time.Now()):
+		return true
+	}
+	return v.isMember(p)
+}
+
+// CanSeeField reports whether the viewer may see one of a person's
+// PrivacyFields. A field the person set a privacy for follows that setting,
+// which editors can't see past; other fields follow CanSeeDetails.
+func CanSeeField(v Viewer, p *models.Person, field string) bool {
+	level, ok := p.FieldPrivacy[field]
+	if !ok || level == "" {
+		return CanSeeDetails(v, p)
+	}
+	if v.isSelf(p) {
+		return true
+	}
+	switch level {
+	case models.PrivacyPublic:
+		return true
+	case models.PrivacyMembers:
+		return v.isMember(p)
+	case models.PrivacyFamily:
+		return v.isMember(p) && v.family.has(p.ID)
+	}
+	return false
+}
+
+// RedactPerson hides what the viewer may not see. A person whose details
+// are hidden keeps only the name, gender and relationships, so the tree can
+// still be drawn; outside the tree the first name is replaced with
+// LivingName. Fields with their own privacy are then shown or hidden one by
+// one and listed in HiddenFields.
+func RedactPerson(v Viewer, p *models.Person) {
+	original := *p
+	if !CanSeeDetails(v, p) {
+		*p = models.Person{
+			ID:            original.ID,
+			FamilyTreeID:  original.FamilyTreeID,
+			FirstName:     original.FirstName,
+			LastName:      original.LastName,
+			Gender:        original.Gender,
+			Photos:        models.JSONStringArray{},
+			LifeEvents:    models.LifeEvents{},
+			Privacy:       original.Privacy,
+			Relationships: original.Relationships,
+			Redacted:      true,
+			CreatedAt:     original.CreatedAt,
+			UpdatedAt:     original.UpdatedAt,
+		}
+		if !v.isMember(&original) {
+			p.FirstName = LivingName
+		}
+	}
+
+	for _, field := range models.PrivacyFields {
+		if _, ok := original.FieldPrivacy[field]; !ok {
+			continue
+		}
+		if CanSeeField(v, &original, field) {
+			showField(p, &original, field)
+		} else {
+			hideField(p, field)
+			p.HiddenFields = append(p.HiddenFields, field)
+		}
+	}
+
+	// A Birth life event would give a hidden birth date away
+	if p.BirthDate.IsZero() && !original.BirthDate.IsZero() && len(p.LifeEvents) > 0 {
+		events := make(models.LifeEvents, len(p.LifeEvents))
+		for i, event := range p.LifeEvents {
+			if event.Title == "Birth" {
+				event.Date = nil
+			}
+			events[i] = event
+		}
+		p.LifeEvents = events
+	}
+
+	p.Citations = visibleCitations(p, p.Citations)
+	if !v.isSelf(&original) && !v.CanEdit {
+		p.FieldPrivacy = nil
+	}
+}
+
+func showField(p, original *models.Person, field string) {
+	switch field {
+	case models.FieldBirthDate:
+		p.BirthDate = original.BirthDate
+	case models.FieldBio:
+		p.Bio = original.Bio
+	case models.FieldPhotos:
+		p.ProfilePhotoURL, p.Photos = original.ProfilePhotoURL, original.Photos
+	case models.FieldLifeEvents:
+		p.LifeEvents = original.LifeEvents
+	case models.FieldContact:
+		p.Email, p.Phone = original.Email, original.Phone
+	}
+}
+
+func hideField(p *models.Person, field string) {
+	switch field {
+	case models.FieldBirthDate:
+		p.BirthDate = nil
+	case models.FieldBio:
+		p.Bio = ""
+	case models.FieldPhotos:
+		p.ProfilePhotoURL, p.Photos = "", models.JSONStringArray{}
+	case models.FieldLifeEvents:
+		p.LifeEvents = models.LifeEvents{}
+	case models.FieldContact:
+		p.Email, p.Phone = "", ""
+	}
+}
+
+// PreserveHiddenFields keeps the stored values of fields hidden from the
+// viewer in an update, so saving a redacted person doesn't erase them
+func PreserveHiddenFields(v Viewer, stored, update *models.Person) {
+	for _, field := range models.PrivacyFields {
+		if CanSeeField(v, stored, field) {
+			continue
+		}
+		showField(update, stored, field)
+		if field != models.FieldBirthDate {
+			continue
+		}
+		// Birth events came without their date too
+		dates := map[string]*gendate.Date{}
+		for _, event := range stored.LifeEvents {
+			if event.Title == "Birth" {
+				dates[event.ID] = event.Date
+			}
+		}
+		for i, event := range update.LifeEvents {
+			if event.Title == "Birth" && event.Date == nil {
+				update.LifeEvents[i].Date = dates[event.ID]
+			}
+		}
+	}
+}
+
+// visibleCitations drops the citations of facts hidden on a redacted person
+func visibleCitations(p *models.Person, citations []models.Citation) []models.Citation {
+	if p.Redacted {
+		return nil
+	}
+	hidden := map[models.CitationFact]bool{}
+	for _, field := range p.HiddenFields {
+		switch field {
+		case models.FieldBirthDate:
+			hidden[models.CitationBirthDate] = true
+		case models.FieldLifeEvents:
+			hidden[models.CitationLifeEvent] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return citations
+	}
+	var visible []models.Citation
+	for _, c := range citations {
+		if c.PersonID != p.ID || !hidden[c.Fact] {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+// VisibleCitations drops the citations of facts hidden on the given redacted
+// persons
+func VisibleCitations(persons []models.Person, citations []models.Citation) []models.Citation {
+	byID := make(map[string]*models.Person, len(persons))
+	for i := range persons {
+		byID[persons[i].ID] = &persons[i]
+	}
+	visible := make([]models.Citation, 0, len(citations))
+	for _, c := range citations {
+		p := byID[c.PersonID]
+		if p == nil || len(visibleCitations(p, []models.Citation{c})) > 0 {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+// RedactPersons applies RedactPerson to each person
+func RedactPersons(v Viewer, persons []models.Person) {
+	for i := range persons {
+		RedactPerson(v, &persons[i])
+	}
+}
+
+// RedactRevisions hides the history of a person the viewer may not see, and
+// the old and new values of fields hidden from them
+func RedactRevisions(v Viewer, p *models.Person, revisions []models.PersonRevision) []models.PersonRevision {
+	if !CanSeeDetails(v, p) {
+		return []models.PersonRevision{}
+	}
+	hidden := hiddenChangeFields(v, p)
+	if len(hidden) == 0 {
+		return revisions
+	}
+	for i := range revisions {
+		changes := models.RevisionChanges{}
+		for name, change := range revisions[i].Changes {
+			if !hidden[name] {
+				changes[name] = change
+			}
+		}
+		revisions[i].Changes = changes
+	}
+	return revisions
+}
+
+// RedactProposals hides the proposals for a person the viewer may not see,
+// and the changes to fields hidden from them
+func RedactProposals(v Viewer, p *models.Person, proposals []models.EditProposal) []models.EditProposal {
+	if !CanSeeDetails(v, p) {
+		return []models.EditProposal{}
+	}
+	hidden := hiddenChangeFields(v, p)
+	if len(hidden) == 0 {
+		return proposals
+	}
+	for i := range proposals {
+		changes := models.ProposalChanges{}
+		for _, change := range proposals[i].Changes {
+			if !hidden[change.Field] {
+				changes = append(changes, change)
+			}
+		}
+		proposals[i].Changes = changes
+	}
+	return proposals
+}
+
+// changeVisible reports, by JSON field name, whether the viewer may see a
+// person's values in revisions and proposals
+func changeVisible(v Viewer, p *models.Person) func(name string) bool {
+	if !CanSeeDetails(v, p) {
+		// What RedactPerson keeps of a person with hidden details
+		member := v.isMember(p)
+		return func(name string) bool {
+			return name == "lastName" || name == "gender" || (name == "firstName" && member)
+		}
+	}
+	hidden := hiddenChangeFields(v, p)
+	return func(name string) bool { return !hidden[name] }
+}
+
+// hiddenChangeFields are the JSON field names that revisions and proposals
+// may not show the viewer the values of
+func hiddenChangeFields(v Viewer, p *models.Person) map[string]bool {
+	redacted := *p
+	RedactPerson(v, &redacted)
+	hidden := map[string]bool{}
+	for _, field := range redacted.HiddenFields {
+		switch field {
+		case models.FieldPhotos:
+			hidden["photos"], hidden["profilePhotoUrl"] = true, true
+		case models.FieldContact:
+			hidden["email"], hidden["phone"] = true, true
+		case models.FieldBirthDate:
+			// A Birth life event in the changes would give the date away
+			hidden[field], hidden[models.FieldLifeEvents] = true, true
+		default:
+			hidden[field] = true
+		}
+	}
+	return hidden
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"testing"
+
+	"family-tree-backend/models"
+)
+
+func TestRedactProposals(t *testing.T) {
+	living := true
+	person := models.Person{
+		ID:           "p1",
+		FamilyTreeID: "tree-1",
+		FirstName:    "Ada",
+		Living:       &living,
+		FieldPrivacy: models.FieldPrivacy{models.FieldBirthDate: models.PrivacyFamily, models.FieldContact: models.PrivacyPrivate},
+	}
+	proposals := func() []models.EditProposal {
+		return []models.EditProposal{{
+			ID:       "proposal-1",
+			PersonID: person.ID,
+			Changes: models.ProposalChanges{
+				{ID: "c1", Field: "firstName"},
+				{ID: "c2", Field: "birthDate"},
+				{ID: "c3", Field: "lifeEvents"},
+				{ID: "c4", Field: "email"},
+				{ID: "c5", Field: "bio"},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		viewer  Viewer
+		privacy models.PersonPrivacy
+		want    []string // IDs of the changes left, nil for no proposals at all
+	}{
+		{"public", Viewer{}, models.PrivacyMembers, nil},
+		{"member", Viewer{UserID: "u2", FamilyTreeID: "tree-1"}, models.PrivacyMembers, []string{"c1", "c5"}},
+		{"editor", Viewer{UserID: "u2", FamilyTreeID: "tree-1", CanEdit: true}, models.PrivacyMembers, []string{"c1", "c5"}},
+		{"member of another tree", Viewer{UserID: "u2", FamilyTreeID: "tree-2"}, models.PrivacyPublic, []string{"c1", "c5"}},
+		{"member, private person", Viewer{UserID: "u2", FamilyTreeID: "tree-1"}, models.PrivacyPrivate, nil},
+		{"the person", Viewer{UserID: "u1", FamilyTreeID: "tree-1"}, models.PrivacyPrivate, []string{"c1", "c2", "c3", "c4", "c5"}},
+	}
+	for _, tt := range tests {
+		p := person
+		p.Privacy = tt.privacy
+		if tt.viewer.UserID == "u1" {
+			p.AuthUserID = "u1"
+		}
+		got := RedactProposals(tt.viewer, &p, proposals())
+		if tt.want == nil {
+			if len(got) != 0 {
+				t.Errorf("%s: %d proposals, want none", tt.name, len(got))
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Fatalf("%s: %d proposals, want 1", tt.name, len(got))
+		}
+		var ids []string
+		for _, change := range got[0].Changes {
+			ids = append(ids, change.ID)
+		}
+		if len(ids) != len(tt.want) {
+			t.Errorf("%s: changes %v, want %v", tt.name, ids, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("%s: changes %v, want %v", tt.name, ids, tt.want)
+				break
+			}
+		}
+	}
+}
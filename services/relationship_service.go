@@ -0,0 +1,433 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRelationship = errors.New("invalid relationship")
+	ErrRelationshipExists  = errors.New("relationship already exists")
+	ErrRelationshipCycle   = errors.New("relationship would make a person their own ancestor")
+	ErrPersonNotFound      = errors.New("person not found")
+)
+
+var parentQualifiers = map[string]bool{
+	models.ParentBiological: true,
+	models.ParentAdoptive:   true,
+	models.ParentStep:       true,
+	models.ParentFoster:     true,
+}
+
+// ValidateQualifier checks a qualifier against the edge type. Spouse
+// qualifiers are free text so custom unions can be recorded.
+func ValidateQualifier(relType models.RelationshipType, qualifier string) error {
+	if relType == models.RelationshipParentChild && !parentQualifiers[qualifier] {
+		return fmt.Errorf("%w: unknown parent qualifier %q", ErrInvalidRelationship, qualifier)
+	}
+	return nil
+}
+
+// AddRelationship validates and stores a single edge. Pass a transaction when
+// the edge is part of a larger change.
+func AddRelationship(tx *gorm.DB, rel *models.Relationship) error {
+	if rel.PersonID == "" || rel.RelatedPersonID == "" {
+		return fmt.Errorf("%w: both persons are required", ErrInvalidRelationship)
+	}
+	if rel.PersonID == rel.RelatedPersonID {
+		return fmt.Errorf("%w: a person cannot be related to themselves", ErrInvalidRelationship)
+	}
+
+	switch rel.Type {
+	case models.RelationshipParentChild:
+		if rel.Qualifier == "" {
+			rel.Qualifier = models.ParentBiological
+		}
+		if err := ValidateQualifier(rel.Type, rel.Qualifier); err != nil {
+			return err
+		}
+		if rel.StartDate != nil || rel.EndDate != nil {
+			return fmt.Errorf("%w: only spouse relationships have dates", ErrInvalidRelationship)
+		}
+	case models.RelationshipSpouse:
+		if rel.Qualifier == "" {
+			rel.Qualifier = models.SpouseMarried
+		}
+	case models.RelationshipSibling:
+		rel.StartDate = nil
+		rel.EndDate = nil
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidRelationship, rel.Type)
+	}
+
+	var persons []models.Person
+	if err := tx.Select("id", "family_tree_id").Where("id IN ?", []string{rel.PersonID, rel.RelatedPersonID}).Find(&persons).Error; err != nil {
+		return err
+	}
+	if len(persons) != 2 {
+		return ErrPersonNotFound
+	}
+	if persons[0].FamilyTreeID != persons[1].FamilyTreeID {
+		return fmt.Errorf("%w: persons belong to different family trees", ErrInvalidRelationship)
+	}
+	rel.FamilyTreeID = persons[0].FamilyTreeID
+
+	exists, err := relationshipExists(tx, rel)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrRelationshipExists
+	}
+
+	if rel.Type == models.RelationshipParentChild {
+		cyclic, err := isAncestor(tx, rel.RelatedPersonID, rel.PersonID)
+		if err != nil {
+			return err
+		}
+		if cyclic {
+			return ErrRelationshipCycle
+		}
+	}
+
+	if rel.ID == "" {
+		rel.ID = uuid.New().String()
+	}
+	rel.CreatedAt = time.Now()
+	rel.UpdatedAt = time.Now()
+	return tx.Create(rel).Error
+}
+
+// relationshipExists checks for an existing edge between the same persons.
+// Spouse and sibling edges are symmetric, so both directions are checked.
+func relationshipExists(tx *gorm.DB, rel *models.Relationship) (bool, error) {
+	query := tx.Model(&models.Relationship{}).Where("type = ?", rel.Type)
+	if rel.Type == models.RelationshipParentChild {
+		query = query.Where("person_id = ? AND related_person_id = ?", rel.PersonID, rel.RelatedPersonID)
+	} else {
+		query = query.Where("(person_id = ? AND related_person_id = ?) OR (person_id = ? AND related_person_id = ?)",
+			rel.PersonID, rel.RelatedPersonID, rel.RelatedPersonID, rel.PersonID)
+	}
+	if rel.ID != "" {
+		query = query.Where("id <> ?", rel.ID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// isAncestor reports whether ancestorID can be reached by walking up the
+// parent edges from personID.
+func isAncestor(tx *gorm.DB, ancestorID, personID string) (bool, error) {
+	visited := map[string]bool{personID: true}
+	frontier := []string{personID}
+
+	for len(frontier) > 0 {
+		var parentIDs []string
+		if err := tx.Model(&models.Relationship{}).
+			Where("type = ? AND related_person_id IN ?", models.RelationshipParentChild, frontier).
+			Pluck("person_id", &parentIDs).Error; err != nil {
+			return false, err
+		}
+
+		frontier = frontier[:0]
+		for _, id := range parentIDs {
+			if id == ancestorID {
+				return true, nil
+			}
+			if !visited[id] {
+				visited[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return false, nil
+}
+
+// AddInitialRelationships turns the relationships submitted with a new person
+// into edges, so both sides stay consistent from the start.
+func AddInitialRelationships(tx *gorm.DB, person *models.Person) error {
+	var edges []models.Relationship
+	for _, parentID := range person.Relationships.ParentIDs {
+		edges = append(edges, models.Relationship{PersonID: parentID, RelatedPersonID: person.ID, Type: models.RelationshipParentChild})
+	}
+	for _, childID := range person.Relationships.ChildrenIDs {
+		edges = append(edges, models.Relationship{PersonID: person.ID, RelatedPersonID: childID, Type: models.RelationshipParentChild})
+	}
+	for _, spouse := range person.Relationships.Spouses {
+		edges = append(edges, models.Relationship{
+			PersonID:        person.ID,
+			RelatedPersonID: spouse.PersonID,
+			Type:            models.RelationshipSpouse,
+			Qualifier:       spouse.Type,
+			StartDate:       spouse.StartDate,
+			EndDate:         spouse.EndDate,
+		})
+	}
+	for _, siblingID := range person.Relationships.SiblingIDs {
+		edges = append(edges, models.Relationship{PersonID: person.ID, RelatedPersonID: siblingID, Type: models.RelationshipSibling})
+	}
+
+	for i := range edges {
+		if err := AddRelationship(tx, &edges[i]); err != nil && !errors.Is(err, ErrRelationshipExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRelationships fills in the Relationships field of each person from the
+// relationships table.
+func LoadRelationships(db *gorm.DB, persons []models.Person) error {
+	if len(persons) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(persons))
+	for i := range persons {
+		ids[i] = persons[i].ID
+	}
+
+	var edges []models.Relationship
+	if err := db.Where("person_id IN ? OR related_person_id IN ?", ids, ids).Find(&edges).Error; err != nil {
+		return err
+	}
+
+	// Siblings are derived from shared parents, so the parents' other
+	// children are needed as well.
+	parentSet := map[string]bool{}
+	for _, e := range edges {
+		if e.Type == models.RelationshipParentChild {
+			parentSet[e.PersonID] = true
+		}
+	}
+	if len(parentSet) > 0 {
+		parentIDs := make([]string, 0, len(parentSet))
+		for id := range parentSet {
+			parentIDs = append(parentIDs, id)
+		}
+		var childEdges []models.Relationship
+		if err := db.Where("type = ? AND person_id IN ?", models.RelationshipParentChild, parentIDs).Find(&childEdges).Error; err != nil {
+			return err
+		}
+		edges = append(edges, childEdges...)
+	}
+
+	for i := range persons {
+		persons[i].Relationships = BuildRelationships(persons[i].ID, edges)
+	}
+	return nil
+}
+
+// LoadPersonRelationships is LoadRelationships for a single person
+func LoadPersonRelationships(db *gorm.DB, person *models.Person) error {
+	persons := []models.Person{*person}
+	if err := LoadRelationships(db, persons); err != nil {
+		return err
+	}
+	person.Relationships = persons[0].Relationships
+	return nil
+}
+
+// BuildRelationships derives one person's view of the graph from a set of edges
+func BuildRelationships(personID string, edges []models.Relationship) models.Relationships {
+	rels := models.Relationships{
+		ParentIDs:   []string{},
+		Spouses:     []models.RelationshipConnection{},
+		ChildrenIDs: []string{},
+		SiblingIDs:  []string{},
+	}
+
+	seen := map[string]bool{}
+	parents := map[string]bool{}
+	siblings := map[string]bool{}
+
+	for _, e := range edges {
+		if seen[e.ID] || !e.Involves(personID) {
+			continue
+		}
+		seen[e.ID] = true
+
+		switch e.Type {
+		case models.RelationshipParentChild:
+			if e.RelatedPersonID == personID {
+				rels.ParentIDs = append(rels.ParentIDs, e.PersonID)
+				parents[e.PersonID] = true
+			} else {
+				rels.ChildrenIDs = append(rels.ChildrenIDs, e.RelatedPersonID)
+			}
+		case models.RelationshipSpouse:
+			rels.Spouses = append(rels.Spouses, models.RelationshipConnection{
+				PersonID:  e.Other(personID),
+				Type:      e.Qualifier,
+				StartDate: e.StartDate,
+				EndDate:   e.EndDate,
+			})
+		case models.RelationshipSibling:
+			siblings[e.Other(personID)] = true
+		}
+	}
+
+	for _, e := range edges {
+		if e.Type == models.RelationshipParentChild && parents[e.PersonID] && e.RelatedPersonID != personID {
+			siblings[e.RelatedPersonID] = true
+		}
+	}
+	for id := range siblings {
+		rels.SiblingIDs = append(rels.SiblingIDs, id)
+	}
+	sort.Strings(rels.SiblingIDs)
+
+	return rels
+}
+
+// MigrateLegacyRelationships converts the old per-person JSON column into
+// relationship edges. Edges listed on only one side are kept, which repairs
+// one-sided links. The old column is renamed afterwards so this runs once.
+func MigrateLegacyRelationships(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Person{}, "relationships") {
+		return nil
+	}
+
+	type legacyRow struct {
+		ID            string
+		FamilyTreeID  string
+		Relationships *string
+	}
+
+	var rows []legacyRow
+	if err := db.Table("people").Select("id, family_tree_id, relationships").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	treeOf := make(map[string]string, len(rows))
+	for _, row := range rows {
+		treeOf[row.ID] = row.FamilyTreeID
+	}
+
+	edges := map[string]*models.Relationship{}
+	addEdge := func(from, to string, relType models.RelationshipType) *models.Relationship {
+		if from == to || from == "" || to == "" {
+			return nil
+		}
+		if _, ok := treeOf[from]; !ok {
+			log.Printf("Skipping legacy relationship to unknown person %s", from)
+			return nil
+		}
+		if _, ok := treeOf[to]; !ok {
+			log.Printf("Skipping legacy relationship to unknown person %s", to)
+			return nil
+		}
+		if relType != models.RelationshipParentChild && from > to {
+			from, to = to, from
+		}
+		key := string(relType) + ":" + from + ":" + to
+		if e, ok := edges[key]; ok {
+			return e
+		}
+		e := &models.Relationship{
+			ID:              uuid.New().String(),
+			FamilyTreeID:    treeOf[from],
+			PersonID:        from,
+			RelatedPersonID: to,
+			Type:            relType,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		}
+		switch relType {
+		case models.RelationshipParentChild:
+			e.Qualifier = models.ParentBiological
+		case models.RelationshipSpouse:
+			e.Qualifier = models.SpouseMarried
+		}
+		edges[key] = e
+		return e
+	}
+
+	type siblingPair struct{ a, b string }
+	var siblingPairs []siblingPair
+
+	for _, row := range rows {
+		if row.Relationships == nil || *row.Relationships == "" {
+			continue
+		}
+		var rels models.Relationships
+		if err := json.Unmarshal([]byte(*row.Relationships), &rels); err != nil {
+			log.Printf("Skipping unreadable relationships for person %s: %v", row.ID, err)
+			continue
+		}
+		for _, parentID := range rels.ParentIDs {
+			addEdge(parentID, row.ID, models.RelationshipParentChild)
+		}
+		for _, childID := range rels.ChildrenIDs {
+			addEdge(row.ID, childID, models.RelationshipParentChild)
+		}
+		for _, spouse := range rels.Spouses {
+			e := addEdge(row.ID, spouse.PersonID, models.RelationshipSpouse)
+			if e == nil {
+				continue
+			}
+			if spouse.Type != "" {
+				e.Qualifier = spouse.Type
+			}
+			if e.StartDate == nil {
+				e.StartDate = spouse.StartDate
+			}
+			if e.EndDate == nil {
+				e.EndDate = spouse.EndDate
+			}
+		}
+		for _, siblingID := range rels.SiblingIDs {
+			siblingPairs = append(siblingPairs, siblingPair{row.ID, siblingID})
+		}
+	}
+
+	// Siblings that already share a parent need no explicit edge
+	parentsOf := map[string]map[string]bool{}
+	for _, e := range edges {
+		if e.Type == models.RelationshipParentChild {
+			if parentsOf[e.RelatedPersonID] == nil {
+				parentsOf[e.RelatedPersonID] = map[string]bool{}
+			}
+			parentsOf[e.RelatedPersonID][e.PersonID] = true
+		}
+	}
+	for _, pair := range siblingPairs {
+		shared := false
+		for parentID := range parentsOf[pair.a] {
+			if parentsOf[pair.b][parentID] {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			addEdge(pair.a, pair.b, models.RelationshipSibling)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		batch := make([]*models.Relationship, 0, len(edges))
+		for _, e := range edges {
+			batch = append(batch, e)
+		}
+		if len(batch) > 0 {
+			if err := tx.CreateInBatches(batch, 500).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("Migrated %d legacy relationship edges", len(batch))
+		return tx.Migrator().RenameColumn(&models.Person{}, "relationships", "legacy_relationships")
+	})
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRevisionNotFound      = errors.New("revision not found")
+	ErrRevisionNotRevertible = errors.New("only edits can be reverted")
+	ErrRevisionConflict      = errors.New("fields changed again after this revision")
+)
+
+// Person fields that are bookkeeping rather than content, left out of diffs
+var unrevisionedFields = map[string]bool{
+	"id":            true,
+	"familyTreeId":  true,
+	"relationships": true,
+	"citations":     true,
+	"redacted":      true,
+	"hiddenFields":  true,
+	"fieldPrivacy":  true,
+	"createdAt":     true,
+	"updatedAt":     true,
+}
+
+// personFieldNames lists every JSON field of a person
+var personFieldNames = func() map[string]bool {
+	fields := map[string]json.RawMessage{}
+	data, _ := json.Marshal(models.Person{BirthDate: gendate.FromTime(time.Time{}), DeathDate: gendate.FromTime(time.Time{})})
+	json.Unmarshal(data, &fields)
+	set := make(map[string]bool, len(fields))
+	for name := range fields {
+		set[name] = true
+	}
+	return set
+}()
+
+// personFields returns a person's content fields as JSON by field name.
+// Empty values are left out so "" and null compare equal.
+func personFields(p *models.Person) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if p == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if unrevisionedFields[name] || isEmptyJSON(value) {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(bytes.TrimSpace(value)) {
+	case "", "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// jsonOrNull keeps missing values explicit in stored diffs
+func jsonOrNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// DiffPersons lists the fields that differ between two versions of a person.
+// Either may be nil, for a person being created or deleted.
+func DiffPersons(before, after *models.Person) (models.RevisionChanges, error) {
+	old, err := personFields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := personFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := models.RevisionChanges{}
+	for name, value := range updated {
+		if !bytes.Equal(old[name], value) {
+			changes[name] = models.FieldChange{Old: jsonOrNull(old[name]), New: value}
+		}
+	}
+	for name, value := range old {
+		if _, ok := updated[name]; !ok {
+			changes[name] = models.FieldChange{Old: value, New: jsonOrNull(nil)}
+		}
+	}
+	return changes, nil
+}
+
+// RecordPersonRevision stores what changed between before and after. Pass
+// the transaction that made the change so the two are saved together. Edits
+// that changed nothing are not recorded.
+func RecordPersonRevision(tx *gorm.DB, before, after *models.Person, actorID string, action models.RevisionAction, sourceID string) error {
+	changes, err := DiffPersons(before, after)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && action != models.RevisionCreate && action != models.RevisionDelete {
+		return nil
+	}
+
+	person := after
+	if person == nil {
+		person = before
+	}
+	return tx.Create(&models.PersonRevision{
+		ID:           uuid.New().String(),
+		FamilyTreeID: person.FamilyTreeID,
+		PersonID:     person.ID,
+		Action:       action,
+		ActorID:      actorID,
+		SourceID:     sourceID,
+		Changes:      changes,
+		CreatedAt:    time.Now(),
+	}).Error
+}
+
+// UpdatePerson applies the non-empty fields of update to person and records
+// the revision. person is reloaded with the stored values.
+func UpdatePerson(db *gorm.DB, person *models.Person, update models.Person, actorID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		before := *person
+		if err := tx.Model(&before).Updates(update).Error; err != nil {
+			return err
+		}
+		// Load into a fresh value; scanning JSON columns into person would
+		// reuse the slices before still points at
+		var after models.Person
+		if err := tx.First(&after, "id = ?", person.ID).Error; err != nil {
+			return err
+		}
+		if err := indexPersonName(tx, &after); err != nil {
+			return err
+		}
+		if err := RecordPersonRevision(tx, person, &after, actorID, models.RevisionUpdate, ""); err != nil {
+			return err
+		}
+		*person = after
+		return nil
+	})
+}
+
+// PersonHistory lists a person's revisions, newest first. It works for
+// deleted persons too.
+func PersonHistory(db *gorm.DB, treeID, personID string) ([]models.PersonRevision, error) {
+	var revisions []models.PersonRevision
+	err := db.Where("family_tree_id = ? AND person_id = ?", treeID, personID).
+		Order("created_at DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// RevertPersonRevision undoes one revision by restoring the old value of each
+// field it changed, and records that as a new revision. Fields edited again
+// since fail with ErrRevisionConflict unless force is set.
+func RevertPersonRevision(db *gorm.DB, treeID, personID, revisionID, actorID string, force bool) (*models.Person, error) {
+	var restored models.Person
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var revision models.PersonRevision
+		if err := tx.First(&revision, "id = ? AND person_id = ? AND family_tree_id = ?", revisionID, personID, treeID).Error; err != nil {
+			return ErrRevisionNotFound
+		}
+		switch revision.Action {
+		case models.RevisionCreate, models.RevisionDelete, models.RevisionImport, models.RevisionMerge, models.RevisionRestore:
+			return ErrRevisionNotRevertible
+		}
+
+		var person models.Person
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&person, "id = ? AND family_tree_id = ?", personID, treeID).Error; err != nil {
+			return ErrPersonNotFound
+		}
+
+		fields, err := personFields(&person)
+		if err != nil {
+			return err
+		}
+		var conflicts []string
+		for name, change := range revision.Changes {
+			current := fields[name]
+			if isEmptyJSON(change.New) {
+				change.New = nil
+			}
+			if !bytes.Equal(current, change.New) {
+				conflicts = append(conflicts, name)
+			}
+			if isEmptyJSON(change.Old) {
+				delete(fields, name)
+			} else {
+				fields[name] = change.Old
+			}
+		}
+		if len(conflicts) > 0 && !force {
+			sort.Strings(conflicts)
+			return fmt.Errorf("%w: %s", ErrRevisionConflict, strings.Join(conflicts, ", "))
+		}
+
+		// Rebuild from JSON into a fresh value so removed fields end up empty
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &restored); err != nil {
+			return err
+		}
+		restored.ID = person.ID
+		restored.FamilyTreeID = person.FamilyTreeID
+		restored.CreatedAt = person.CreatedAt
+		restored.UpdatedAt = time.Now()
+		// The link and its privacy choices belong to the linked user, not to
+		// the history
+		restored.AuthUserID = person.AuthUserID
+		restored.FieldPrivacy = person.FieldPrivacy
+		restored.SearchText = PersonSearchText(&restored)
+
+		if err := tx.Save(&restored).Error; err != nil {
+			return err
+		}
+		return RecordPersonRevision(tx, &person, &restored, actorID, models.RevisionRevert, revision.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
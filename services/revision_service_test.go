@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+func revisionTestDB(t *testing.T) *gorm.DB {
+	return testDB(t, &models.Person{}, &models.PersonRevision{}, &models.Relationship{}, &models.LinkRequest{},
+		&models.EditProposal{}, &models.Invitation{}, &models.Citation{})
+}
+
+func createPerson(t *testing.T, db *gorm.DB, p models.Person) *models.Person {
+	t.Helper()
+	p.FamilyTreeID = "tree-1"
+	if err := db.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func TestRevertKeepsLinkAndFieldPrivacy(t *testing.T) {
+	db := revisionTestDB(t)
+	person := createPerson(t, db, models.Person{ID: "p1", FirstName: "Ada", Bio: "Mathematician"})
+	if err := UpdatePerson(db, person, models.Person{Bio: "Poet"}, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	history, err := PersonHistory(db, "tree-1", person.ID)
+	if err != nil || len(history) == 0 {
+		t.Fatalf("PersonHistory = %v, %v", history, err)
+	}
+
+	// Linked and made private after the edit, outside the revisioned fields
+	privacy := models.FieldPrivacy{models.FieldBio: models.PrivacyPrivate}
+	if err := db.Model(person).Updates(models.Person{AuthUserID: "u1", FieldPrivacy: privacy}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RevertPersonRevision(db, "tree-1", person.ID, history[0].ID, "editor", false); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Person
+	if err := db.First(&stored, "id = ?", person.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Bio != "Mathematician" {
+		t.Errorf("bio = %q, want the reverted value", stored.Bio)
+	}
+	if stored.AuthUserID != "u1" {
+		t.Errorf("authUserId = %q, want u1", stored.AuthUserID)
+	}
+	if stored.FieldPrivacy[models.FieldBio] != models.PrivacyPrivate {
+		t.Errorf("fieldPrivacy = %v, want bio private", stored.FieldPrivacy)
+	}
+}
+
+func TestMergeKeepsFieldPrivacy(t *testing.T) {
+	db := revisionTestDB(t)
+	keep := createPerson(t, db, models.Person{ID: "p1", FirstName: "Ada",
+		FieldPrivacy: models.FieldPrivacy{models.FieldBio: models.PrivacyMembers}})
+	duplicate := createPerson(t, db, models.Person{ID: "p2", FirstName: "Ada", AuthUserID: "u1",
+		FieldPrivacy: models.FieldPrivacy{models.FieldBio: models.PrivacyPrivate, models.FieldContact: models.PrivacyFamily}})
+
+	if _, err := MergePersons(db, "tree-1", keep.ID, duplicate.ID, nil, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Person
+	if err := db.First(&stored, "id = ?", keep.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := models.FieldPrivacy{models.FieldBio: models.PrivacyMembers, models.FieldContact: models.PrivacyFamily}
+	if len(stored.FieldPrivacy) != len(want) {
+		t.Fatalf("fieldPrivacy = %v, want %v", stored.FieldPrivacy, want)
+	}
+	for field, level := range want {
+		if stored.FieldPrivacy[field] != level {
+			t.Errorf("fieldPrivacy = %v, want %v", stored.FieldPrivacy, want)
+		}
+	}
+	if stored.AuthUserID != "u1" {
+		t.Errorf("authUserId = %q, want the duplicate's u1", stored.AuthUserID)
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("a role with this name already exists")
+	ErrRoleInUse         = errors.New("role is still assigned to members")
+	ErrInvalidRoleName   = errors.New("role names use lowercase letters, digits, - and _")
+	ErrBuiltInRole       = errors.New("built-in roles can't be changed")
+	ErrInvalidPermission = errors.New("unknown permission")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// RoleDefinition describes a built-in or custom role for clients
+type RoleDefinition struct {
+	Name        models.TreeRole     `json:"name"`
+	Description string              `json:"description"`
+	BuiltIn     bool                `json:"builtIn"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+var builtInRoleDescriptions = map[models.TreeRole]string{
+	models.TreeRoleOwner:  "Everything, including managing admins",
+	models.TreeRoleAdmin:  "Everything except managing owners and admins",
+	models.TreeRoleEditor: "Edit any person and relationship, post and create events",
+	models.TreeRoleMember: "Post and create events, edit own profile",
+	models.TreeRoleViewer: "Read, chat, comment and edit own profile",
+}
+
+// RolePermissions resolves a role in a tree to its permissions
+func RolePermissions(db *gorm.DB, treeID string, role models.TreeRole) (models.PermissionSet, error) {
+	if perms := models.BuiltInRolePermissions(role); perms != nil {
+		return perms, nil
+	}
+	var custom models.Role
+	if err := db.First(&custom, "family_tree_id = ? AND name = ?", treeID, role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return custom.PermissionSet(), nil
+}
+
+// TreeRoles lists the built-in roles followed by the tree's custom roles
+func TreeRoles(db *gorm.DB, treeID string) ([]RoleDefinition, error) {
+	var custom []models.Role
+	if err := db.Where("family_tree_id = ?", treeID).Order("name").Find(&custom).Error; err != nil {
+		return nil, err
+	}
+
+	roles := make([]RoleDefinition, 0, len(models.BuiltInTreeRoles)+len(custom))
+	for _, role := range models.BuiltInTreeRoles {
+		roles = append(roles, RoleDefinition{
+			Name:        role,
+			Description: builtInRoleDescriptions[role],
+			BuiltIn:     true,
+			Permissions: models.BuiltInRolePermissions(role).List(),
+		})
+	}
+	for _, role := range custom {
+		roles = append(roles, RoleDefinition{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.PermissionSet().List(),
+		})
+	}
+	return roles, nil
+}
+
+// validatePermissions rejects names that aren't tree permissions
+func validatePermissions(perms []models.Permission) (models.JSONStringArray, error) {
+	set := models.NewPermissionSet()
+	for _, p := range perms {
+		if !p.IsTreePermission() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPermission, p)
+		}
+		set[p] = true
+	}
+	list := models.JSONStringArray{}
+	for _, p := range set.List() {
+		list = append(list, string(p))
+	}
+	return list, nil
+}
+
+// CreateRole defines a custom role for a tree
+func CreateRole(db *gorm.DB, role *models.Role, perms []models.Permission) error {
+	if !roleNamePattern.MatchString(string(role.Name)) {
+		return ErrInvalidRoleName
+	}
+	if role.Name.IsBuiltIn() {
+		return ErrRoleExists
+	}
+	list, err := validatePermissions(perms)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := db.Model(&models.Role{}).Where("family_tree_id = ? AND name = ?", role.FamilyTreeID, role.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleExists
+	}
+
+	role.ID = uuid.New().String()
+	role.Permissions = list
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = time.Now()
+	return db.Create(role).Error
+}
+
+// FindRole loads a tree's custom role by name
+func FindRole(db *gorm.DB, treeID string, name models.TreeRole) (*models.Role, error) {
+	if name.IsBuiltIn() {
+		return nil, ErrBuiltInRole
+	}
+	var role models.Role
+	if err := db.First(&role, "family_tree_id = ? AND name = ?", treeID, name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole changes a custom role's description and permissions. Members
+// holding it get the new permissions on their next request.
+func UpdateRole(db *gorm.DB, role *models.Role, description *string, perms []models.Permission) error {
+	if perms != nil {
+		list, err := validatePermissions(perms)
+		if err != nil {
+			return err
+		}
+		role.Permissions = list
+	}
+	if description != nil {
+		role.Description = *description
+	}
+	role.UpdatedAt = time.Now()
+	return db.Save(role).Error
+}
+
+// DeleteRole removes a custom role nobody holds any more
+func DeleteRole(db *gorm.DB, role *models.Role) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TreeMembership{}).Where("family_tree_id = ? AND role = ?", role.FamilyTreeID, role.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Model(&models.Invitation{}).
+				Where("family_tree_id = ? AND role = ? AND revoked_at IS NULL AND use_count < max_uses AND expires_at > ?", role.FamilyTreeID, role.Name, time.Now()).
+				Count(&count).Error; err != nil {
+				return err
+			}
+		}
+		if count > 0 {
+			return ErrRoleInUse
+		}
+		return tx.Delete(role).Error
+	})
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"family-tree-backend/models"
+	"family-tree-backend/names"
+
+	"gorm.io/gorm"
+)
+
+var ErrNoGenerationRoot = errors.New("generationFrom is required when you aren't linked to a person in this tree")
+
+// searchCandidates caps the rows a search reads before the filters that
+// can't run in SQL (living, generation, privacy) are applied
+const searchCandidates = 500
+
+// trigramSearch is set once pg_trgm is available, enabling fuzzy matching
+var trigramSearch bool
+
+// PersonSearchText is the text a person is found by, stored in SearchText
+func PersonSearchText(p *models.Person) string {
+	return names.SearchText(p.FirstName + " " + p.LastName)
+}
+
+// indexPersonName brings a saved person's SearchText up to date with their
+// name, for writes that only touch some columns
+func indexPersonName(tx *gorm.DB, p *models.Person) error {
+	text := PersonSearchText(p)
+	if text == p.SearchText {
+		return nil
+	}
+	p.SearchText = text
+	return tx.Model(p).UpdateColumn("search_text", text).Error
+}
+
+// SetupPersonSearch enables pg_trgm with a trigram index on the search text
+// and fills in the search text of persons saved before it existed. Without
+// the extension, for lack of privileges, search still matches names by
+// prefix but not by similarity.
+func SetupPersonSearch(db *gorm.DB) error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("Warning: pg_trgm is not available, person search won't match similar spellings: %v", err)
+	} else if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_people_search_text ON people USING gin (search_text gin_trgm_ops)").Error; err != nil {
+		return err
+	} else {
+		trigramSearch = true
+	}
+
+	var persons []models.Person
+	return db.Select("id, first_name, last_name, search_text").
+		Where("search_text IS NULL OR search_text = ''").
+		FindInBatches(&persons, 500, func(tx *gorm.DB, batch int) error {
+			for i := range persons {
+				if err := indexPersonName(db, &persons[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// PersonSearch is a person search. Every set field narrows the results.
+type PersonSearch struct {
+	Query          string // Names or parts of names, in any spelling or script
+	Gender         string
+	BirthYearFrom  int
+	BirthYearTo    int
+	Living         *bool
+	Generation     *int   // Relative to GenerationFrom: -1 parents, 0 same, 1 children
+	GenerationFrom string // Defaults to the viewer's own person
+	Limit          int
+}
+
+type PersonSearchResult struct {
+	Person     models.Person `json:"person"`
+	Score      float64       `json:"score"` // Name similarity, 0 to one per query word
+	Generation *int          `json:"generation,omitempty"`
+}
+
+// SearchPersons finds persons in a tree by name and filters, best matches
+// first. Each query word must match the start of a name word under one of
+// its spellings (see names.QueryTerms), or be similar to one when pg_trgm is
+// available. Filters on fields hidden from the viewer leave those persons
+// out, so they can't be used to guess the hidden values.
+func SearchPersons(db *gorm.DB, viewer Viewer, familyTreeID string, search PersonSearch) ([]PersonSearchResult, error) {
+	query := db.Model(&models.Person{}).Where("family_tree_id = ?", familyTreeID)
+
+	var scores []string
+	var scoreArgs []interface{}
+	for _, word := range strings.Fields(search.Query) {
+		var conditions []string
+		var args []interface{}
+		var similarities []string
+		for _, term := range names.QueryTerms(word) {
+			conditions = append(conditions, "search_text LIKE ?")
+			args = append(args, "% "+term+"%")
+			if trigramSearch {
+				conditions = append(conditions, "? <% search_text")
+				args = append(args, term)
+				similarities = append(similarities, "word_similarity(?, search_text)")
+				scoreArgs = append(scoreArgs, term)
+			}
+		}
+		if len(conditions) == 0 {
+			continue
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		if len(similarities) > 0 {
+			scores = append(scores, "GREATEST("+strings.Join(similarities, ", ")+")")
+		}
+	}
+
+	if search.Gender != "" {
+		query = query.Where("gender = ?", search.Gender)
+	}
+	// Dates are stored after their sort day, "YYYY-MM-DD ..."
+	if search.BirthYearFrom != 0 {
+		query = query.Where("birth_date >= ?", fmt.Sprintf("%04d-01-01", search.BirthYearFrom))
+	}
+	if search.BirthYearTo != 0 {
+		query = query.Where("birth_date < ?", fmt.Sprintf("%04d-01-01", search.BirthYearTo+1))
+	}
+
+	score := "0"
+	if len(scores) > 0 {
+		score = strings.Join(scores, " + ")
+	}
+	var rows []struct {
+		models.Person
+		Score float64
+	}
+	err := query.Select("people.*, ("+score+") AS score", scoreArgs...).
+		Order("score DESC, last_name, first_name").
+		Limit(searchCandidates).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var generations map[string]int
+	if search.Generation != nil {
+		if generations, err = searchGenerations(db, viewer, familyTreeID, search.GenerationFrom); err != nil {
+			return nil, err
+		}
+	}
+
+	results := []PersonSearchResult{}
+	now := time.Now()
+	for i := range rows {
+		p := &rows[i].Person
+		if (search.BirthYearFrom != 0 || search.BirthYearTo != 0) && !CanSeeField(viewer, p, models.FieldBirthDate) {
+			continue
+		}
+		if search.Living != nil && (!CanSeeDetails(viewer, p) || IsLiving(p, now) != *search.Living) {
+			continue
+		}
+		result := PersonSearchResult{Person: *p, Score: rows[i].Score}
+		if generations != nil {
+			generation, ok := generations[p.ID]
+			if !ok || generation != *search.Generation {
+				continue
+			}
+			result.Generation = &generation
+		}
+		RedactPerson(viewer, &result.Person)
+		results = append(results, result)
+		if search.Limit > 0 && len(results) == search.Limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// searchGenerations numbers the tree's generations from a person, by
+// default the one linked to the viewer
+func searchGenerations(db *gorm.DB, viewer Viewer, familyTreeID, fromID string) (map[string]int, error) {
+	graph, err := LoadFamilyGraph(db, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	if fromID == "" {
+		for id, p := range graph.Persons {
+			if viewer.UserID != "" && p.AuthUserID == viewer.UserID {
+				fromID = id
+				break
+			}
+		}
+	}
+	if graph.Persons[fromID] == nil {
+		if fromID == "" {
+			return nil, ErrNoGenerationRoot
+		}
+		return nil, ErrPersonNotFound
+	}
+	return graph.Generations(fromID), nil
+}
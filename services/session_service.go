@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"family-tree-backend/auth"
+	"family-tree-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionTTL is how long a device stays signed in without refreshing
+const SessionTTL = 30 * 24 * time.Hour
+
+var (
+	ErrSessionInvalid = errors.New("session expired or revoked")
+	ErrSessionReuse   = errors.New("refresh token was already used; session revoked")
+)
+
+// TokenPair is what a client receives when signing in or refreshing
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // Access token lifetime in seconds
+	SessionID    string `json:"sessionId"`
+}
+
+// DeviceInfo describes where a session was started or last used
+type DeviceInfo struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
+
+func issueTokens(session *models.Session, refreshToken string) (*TokenPair, error) {
+	accessToken, err := auth.GenerateToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		SessionID:    session.ID,
+	}, nil
+}
+
+// CreateSession signs a user in on a new device
+func CreateSession(db *gorm.DB, userID string, device DeviceInfo) (*TokenPair, error) {
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		RefreshTokenHash: hash,
+		DeviceName:       device.DeviceName,
+		UserAgent:        device.UserAgent,
+		IPAddress:        device.IPAddress,
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(SessionTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return issueTokens(&session, refreshToken)
+}
+
+// RefreshSession rotates a refresh token and issues a new access token.
+// Presenting an already-rotated token means it leaked, so the whole session
+// is revoked.
+func RefreshSession(db *gorm.DB, refreshToken string, device DeviceInfo) (*TokenPair, error) {
+	hash := auth.HashToken(refreshToken)
+
+	var reused models.Session
+	if err := db.Where("previous_token_hash = ?", hash).First(&reused).Error; err == nil {
+		log.Printf("Refresh token reused on session %s, revoking it", reused.ID)
+		db.Model(&reused).Update("revoked_at", time.Now())
+		return nil, ErrSessionReuse
+	}
+
+	var pair *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("refresh_token_hash = ?", hash).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if !session.IsActive(time.Now()) {
+			return ErrSessionInvalid
+		}
+
+		newToken, newHash, err := auth.NewOpaqueToken()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		session.PreviousTokenHash = session.RefreshTokenHash
+		session.RefreshTokenHash = newHash
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(SessionTTL)
+		if device.UserAgent != "" {
+			session.UserAgent = device.UserAgent
+		}
+		if device.IPAddress != "" {
+			session.IPAddress = device.IPAddress
+		}
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		pair, err = issueTokens(&session, newToken)
+		return err
+	})
+	return pair, err
+}
+
+// RevokeSessionByToken signs out the device holding a refresh token
+func RevokeSessionByToken(db *gorm.DB, refreshToken string) error {
+	result := db.Model(&models.Session{}).
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", auth.HashToken(refreshToken)).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+// RevokeSession signs out one of a user's devices
+func RevokeSession(db *gorm.DB, userID, sessionID string) error {
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+// RevokeAllSessions signs a user out everywhere
+func RevokeAllSessions(db *gorm.DB, userID string) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// ActiveSessions lists the devices a user is signed in on, most recent first
+func ActiveSessions(db *gorm.DB, userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// SessionStatus is used by the local authenticator so revoked sessions stop
+// working before their access tokens expire. It also reports when the
+// session last passed a second-factor check.
+func SessionStatus(db *gorm.DB, sessionID string) (bool, time.Time) {
+	var session models.Session
+	if err := db.Select("id", "revoked_at", "expires_at", "mfa_verified_at").First(&session, "id = ?", sessionID).Error; err != nil {
+		return false, time.Time{}
+	}
+	var mfaVerifiedAt time.Time
+	if session.MFAVerifiedAt != nil {
+		mfaVerifiedAt = *session.MFAVerifiedAt
+	}
+	return session.IsActive(time.Now()), mfaVerifiedAt
+}
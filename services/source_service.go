@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSourceNotFound   = errors.New("source not found")
+	ErrCitationNotFound = errors.New("citation not found")
+	ErrInvalidCitation  = errors.New("invalid citation")
+	ErrSourceCited      = errors.New("source is still cited")
+)
+
+// ValidateCitation checks a citation's source and the fact it supports are
+// in its tree, and clears the target fields the fact doesn't use
+func ValidateCitation(db *gorm.DB, c *models.Citation) error {
+	var source models.Source
+	if err := db.First(&source, "id = ? AND family_tree_id = ?", c.SourceID, c.FamilyTreeID).Error; err != nil {
+		return fmt.Errorf("%w: %s", ErrSourceNotFound, c.SourceID)
+	}
+
+	switch c.Confidence {
+	case "", models.ConfidenceUnreliable, models.ConfidenceQuestionable, models.ConfidenceSecondary, models.ConfidencePrimary:
+	default:
+		return fmt.Errorf("%w: unknown confidence %q", ErrInvalidCitation, c.Confidence)
+	}
+
+	switch c.Fact {
+	case models.CitationPerson, models.CitationBirthDate, models.CitationDeathDate, models.CitationLifeEvent:
+		c.RelationshipID = ""
+		if c.Fact != models.CitationLifeEvent {
+			c.LifeEventID = ""
+		}
+		var person models.Person
+		if err := db.First(&person, "id = ? AND family_tree_id = ?", c.PersonID, c.FamilyTreeID).Error; err != nil {
+			return fmt.Errorf("%w: person %s not found", ErrInvalidCitation, c.PersonID)
+		}
+		if c.Fact == models.CitationLifeEvent && !hasLifeEvent(&person, c.LifeEventID) {
+			return fmt.Errorf("%w: life event %s not found", ErrInvalidCitation, c.LifeEventID)
+		}
+	case models.CitationRelationship:
+		c.PersonID, c.LifeEventID = "", ""
+		var edge models.Relationship
+		if err := db.First(&edge, "id = ? AND family_tree_id = ?", c.RelationshipID, c.FamilyTreeID).Error; err != nil {
+			return fmt.Errorf("%w: relationship %s not found", ErrInvalidCitation, c.RelationshipID)
+		}
+	default:
+		return fmt.Errorf("%w: unknown fact %q", ErrInvalidCitation, c.Fact)
+	}
+	return nil
+}
+
+func hasLifeEvent(person *models.Person, eventID string) bool {
+	for _, e := range person.LifeEvents {
+		if e.ID == eventID && eventID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// attachSources fills in the Source of each citation
+func attachSources(db *gorm.DB, citations []models.Citation) error {
+	ids := make([]string, 0, len(citations))
+	for _, c := range citations {
+		ids = append(ids, c.SourceID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var sources []models.Source
+	if err := db.Where("id IN ?", ids).Find(&sources).Error; err != nil {
+		return err
+	}
+	byID := make(map[string]*models.Source, len(sources))
+	for i := range sources {
+		byID[sources[i].ID] = &sources[i]
+	}
+	for i := range citations {
+		citations[i].Source = byID[citations[i].SourceID]
+	}
+	return nil
+}
+
+// LoadCitations fills in the Citations field of each person: citations of
+// the person's facts and of the edges they are part of, with their sources
+func LoadCitations(db *gorm.DB, persons []models.Person) error {
+	if len(persons) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(persons))
+	for i := range persons {
+		ids[i] = persons[i].ID
+	}
+
+	var edges []models.Relationship
+	if err := db.Select("id, person_id, related_person_id").Where("person_id IN ? OR related_person_id IN ?", ids, ids).Find(&edges).Error; err != nil {
+		return err
+	}
+	edgeIDs := make([]string, len(edges))
+	edgePersons := make(map[string][]string, len(edges))
+	for i, e := range edges {
+		edgeIDs[i] = e.ID
+		edgePersons[e.ID] = []string{e.PersonID, e.RelatedPersonID}
+	}
+
+	var citations []models.Citation
+	query := db.Where("person_id IN ?", ids)
+	if len(edgeIDs) > 0 {
+		query = db.Where("person_id IN ? OR relationship_id IN ?", ids, edgeIDs)
+	}
+	if err := query.Order("created_at").Find(&citations).Error; err != nil {
+		return err
+	}
+	if err := attachSources(db, citations); err != nil {
+		return err
+	}
+
+	byPerson := map[string][]models.Citation{}
+	for _, c := range citations {
+		if c.PersonID != "" {
+			byPerson[c.PersonID] = append(byPerson[c.PersonID], c)
+			continue
+		}
+		for _, id := range edgePersons[c.RelationshipID] {
+			byPerson[id] = append(byPerson[id], c)
+		}
+	}
+	for i := range persons {
+		persons[i].Citations = byPerson[persons[i].ID]
+	}
+	return nil
+}
+
+// LoadPersonCitations is LoadCitations for a single person
+func LoadPersonCitations(db *gorm.DB, person *models.Person) error {
+	persons := []models.Person{*person}
+	if err := LoadCitations(db, persons); err != nil {
+		return err
+	}
+	person.Citations = persons[0].Citations
+	return nil
+}
+
+// SourceCitations lists the citations of one source
+func SourceCitations(db *gorm.DB, familyTreeID, sourceID string) ([]models.Citation, error) {
+	citations := []models.Citation{}
+	err := db.Where("family_tree_id = ? AND source_id = ?", familyTreeID, sourceID).Order("created_at").Find(&citations).Error
+	return citations, err
+}
+
+// DeleteSource removes a source. A cited source is only removed with force,
+// which removes its citations too.
+func DeleteSource(db *gorm.DB, familyTreeID, sourceID string, force bool) error {
+	var source models.Source
+	if err := db.First(&source, "id = ? AND family_tree_id = ?", sourceID, familyTreeID).Error; err != nil {
+		return ErrSourceNotFound
+	}
+
+	var cited int64
+	if err := db.Model(&models.Citation{}).Where("source_id = ?", sourceID).Count(&cited).Error; err != nil {
+		return err
+	}
+	if cited > 0 && !force {
+		return fmt.Errorf("%w by %d citations", ErrSourceCited, cited)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", sourceID).Delete(&models.Citation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+}
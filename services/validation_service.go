@@ -0,0 +1,347 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"family-tree-backend/gendate"
+	"family-tree-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// MinParentAge is the youngest age at which a parent is believable
+const MinParentAge = 12
+
+// IssueSeverity says whether a problem is certainly wrong or only unlikely
+type IssueSeverity string
+
+const (
+	SeverityError   IssueSeverity = "error"
+	SeverityWarning IssueSeverity = "warning"
+)
+
+// Validation rules
+const (
+	RuleChildBornBeforeParent = "child_born_before_parent"
+	RuleYoungParent           = "young_parent"
+	RuleDeathBeforeBirth      = "death_before_birth"
+	RuleEventAfterDeath       = "event_after_death"
+	RuleOneSidedRelationship  = "one_sided_relationship"
+	RuleDeletedReference      = "deleted_person_reference"
+	RuleAncestryCycle         = "ancestry_cycle"
+	RuleTooManyParents        = "too_many_biological_parents"
+)
+
+// Issue is one problem found in a family tree
+type Issue struct {
+	Rule           string        `json:"rule"`
+	Severity       IssueSeverity `json:"severity"`
+	PersonIDs      []string      `json:"personIds,omitempty"`
+	RelationshipID string        `json:"relationshipId,omitempty"`
+	EntityType     string        `json:"entityType,omitempty"` // Set when the issue is about something other than a person or edge
+	EntityID       string        `json:"entityId,omitempty"`
+	Message        string        `json:"message"`
+}
+
+// ValidateTree checks every person and edge of a family tree, including
+// references the graph can't see, such as edges to deleted persons
+func ValidateTree(db *gorm.DB, familyTreeID string) ([]Issue, error) {
+	g, err := LoadFamilyGraph(db, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	issues := ValidateGraph(g)
+
+	refs, err := danglingReferences(db, familyTreeID, g)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, refs...)
+	sortIssues(issues)
+	return issues, nil
+}
+
+// ValidateGraph runs the rules that only need the loaded graph
+func ValidateGraph(g *FamilyGraph) []Issue {
+	var issues []Issue
+	for _, id := range g.sortedIDs() {
+		issues = append(issues, g.personIssues(id)...)
+	}
+	issues = append(issues, g.cycleIssues()...)
+	sortIssues(issues)
+	return issues
+}
+
+// ValidatePerson returns the issues that involve one person, for warnings
+// after an edit
+func ValidatePerson(g *FamilyGraph, personID string) []Issue {
+	issues := []Issue{}
+	for _, issue := range ValidateGraph(g) {
+		for _, id := range issue.PersonIDs {
+			if id == personID {
+				issues = append(issues, issue)
+				break
+			}
+		}
+	}
+	return issues
+}
+
+func (g *FamilyGraph) sortedIDs() []string {
+	ids := make([]string, 0, len(g.Persons))
+	for id := range g.Persons {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// personIssues checks one person's dates and their parent edges
+func (g *FamilyGraph) personIssues(id string) []Issue {
+	var issues []Issue
+	p := g.Persons[id]
+
+	if p.DeathDate.CertainlyBefore(p.BirthDate) {
+		issues = append(issues, Issue{
+			Rule:      RuleDeathBeforeBirth,
+			Severity:  SeverityError,
+			PersonIDs: []string{id},
+			Message:   fmt.Sprintf("%s died before they were born", p.FullName()),
+		})
+	}
+
+	if p.DeathDate != nil {
+		for _, e := range p.LifeEvents {
+			if p.DeathDate.CertainlyBefore(e.Date) {
+				issues = append(issues, Issue{
+					Rule:       RuleEventAfterDeath,
+					Severity:   SeverityWarning,
+					PersonIDs:  []string{id},
+					EntityType: "life_event",
+					EntityID:   e.ID,
+					Message:    fmt.Sprintf("%q in the life of %s is dated after their death", e.Title, p.FullName()),
+				})
+			}
+		}
+	}
+
+	biological := 0
+	for _, e := range g.Parents[id] {
+		if e.Qualifier == "" || e.Qualifier == models.ParentBiological {
+			biological++
+		}
+		parent, ok := g.Persons[e.PersonID]
+		if !ok {
+			continue
+		}
+		// Approximate dates only count against the edge when every reading
+		// of them does
+		youngest, oldest, known := gendate.Age(parent.BirthDate, p.BirthDate)
+		if !known {
+			continue
+		}
+		switch {
+		case notAfter(p.BirthDate, parent.BirthDate):
+			issues = append(issues, Issue{
+				Rule:           RuleChildBornBeforeParent,
+				Severity:       SeverityError,
+				PersonIDs:      []string{parent.ID, id},
+				RelationshipID: e.ID,
+				Message:        fmt.Sprintf("%s was born before their parent %s", p.FullName(), parent.FullName()),
+			})
+		case oldest < MinParentAge:
+			issues = append(issues, Issue{
+				Rule:           RuleYoungParent,
+				Severity:       SeverityWarning,
+				PersonIDs:      []string{parent.ID, id},
+				RelationshipID: e.ID,
+				Message: fmt.Sprintf("%s was %s when %s was born",
+					parent.FullName(), ageText(youngest, oldest), p.FullName()),
+			})
+		}
+	}
+	if biological > 2 {
+		issues = append(issues, Issue{
+			Rule:      RuleTooManyParents,
+			Severity:  SeverityError,
+			PersonIDs: append([]string{id}, g.ParentIDs(id)...),
+			Message:   fmt.Sprintf("%s has %d biological parents", p.FullName(), biological),
+		})
+	}
+	return issues
+}
+
+// cycleIssues finds persons who are their own ancestors. Each cycle is
+// reported once.
+func (g *FamilyGraph) cycleIssues() []Issue {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := map[string]int{}
+	var issues []Issue
+	var stack []string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = inProgress
+		stack = append(stack, id)
+		for _, parentID := range g.ParentIDs(id) {
+			switch state[parentID] {
+			case unvisited:
+				visit(parentID)
+			case inProgress:
+				// The cycle is the part of the stack from parentID up
+				start := len(stack) - 1
+				for stack[start] != parentID {
+					start--
+				}
+				cycle := append([]string{}, stack[start:]...)
+				name := parentID
+				if p, ok := g.Persons[parentID]; ok {
+					name = p.FullName()
+				}
+				issues = append(issues, Issue{
+					Rule:      RuleAncestryCycle,
+					Severity:  SeverityError,
+					PersonIDs: cycle,
+					Message:   fmt.Sprintf("%s is their own ancestor (%d generations)", name, len(cycle)),
+				})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+	for _, id := range g.sortedIDs() {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return issues
+}
+
+// danglingReferences finds edges and pending link requests that point at
+// persons who were deleted, never existed or belong to another tree, and
+// edges filed under another tree that reach into this one
+func danglingReferences(db *gorm.DB, familyTreeID string, g *FamilyGraph) ([]Issue, error) {
+	var edges []models.Relationship
+	treePersons := db.Model(&models.Person{}).Select("id").Where("family_tree_id = ?", familyTreeID)
+	if err := db.Where("family_tree_id = ? OR person_id IN (?) OR related_person_id IN (?)", familyTreeID, treePersons, treePersons).
+		Find(&edges).Error; err != nil {
+		return nil, err
+	}
+	var requests []models.LinkRequest
+	if err := db.Where("family_tree_id = ? AND status = ?", familyTreeID, models.LinkStatusPending).Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	missing := map[string]bool{}
+	for _, e := range edges {
+		if e.FamilyTreeID != familyTreeID {
+			continue
+		}
+		for _, id := range []string{e.PersonID, e.RelatedPersonID} {
+			if _, ok := g.Persons[id]; !ok {
+				missing[id] = true
+			}
+		}
+	}
+	for _, r := range requests {
+		if _, ok := g.Persons[r.PersonID]; !ok {
+			missing[r.PersonID] = true
+		}
+	}
+
+	// Why each missing person is missing, as a rule and a description
+	type reason struct{ rule, what string }
+	reasons := map[string]reason{}
+	if len(missing) > 0 {
+		ids := make([]string, 0, len(missing))
+		for id := range missing {
+			ids = append(ids, id)
+			reasons[id] = reason{RuleDeletedReference, "missing person " + id}
+		}
+		var found []models.Person
+		if err := db.Unscoped().Select("id", "first_name", "last_name", "family_tree_id", "deleted_at").
+			Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			if p.DeletedAt.Valid {
+				reasons[p.ID] = reason{RuleDeletedReference, "deleted person " + p.FullName()}
+			} else {
+				reasons[p.ID] = reason{RuleOneSidedRelationship, p.FullName() + " in another tree"}
+			}
+		}
+	}
+
+	var issues []Issue
+	for _, e := range edges {
+		if e.FamilyTreeID != familyTreeID {
+			issues = append(issues, Issue{
+				Rule:           RuleOneSidedRelationship,
+				Severity:       SeverityError,
+				PersonIDs:      []string{e.PersonID, e.RelatedPersonID},
+				RelationshipID: e.ID,
+				Message:        fmt.Sprintf("%s relationship belongs to another tree", e.Type),
+			})
+			continue
+		}
+		for _, id := range []string{e.PersonID, e.RelatedPersonID} {
+			if !missing[id] {
+				continue
+			}
+			issues = append(issues, Issue{
+				Rule:           reasons[id].rule,
+				Severity:       SeverityError,
+				PersonIDs:      []string{e.Other(id), id},
+				RelationshipID: e.ID,
+				Message:        fmt.Sprintf("%s relationship points at %s", e.Type, reasons[id].what),
+			})
+		}
+	}
+	for _, r := range requests {
+		if missing[r.PersonID] {
+			issues = append(issues, Issue{
+				Rule:       reasons[r.PersonID].rule,
+				Severity:   SeverityWarning,
+				PersonIDs:  []string{r.PersonID},
+				EntityType: "link_request",
+				EntityID:   r.ID,
+				Message:    "pending link request is for " + reasons[r.PersonID].what,
+			})
+		}
+	}
+	return issues, nil
+}
+
+func sortIssues(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return issues[i].Severity == SeverityError
+		}
+		return issues[i].Rule < issues[j].Rule
+	})
+}
+
+// notAfter reports whether a cannot be later than b: a's last possible day
+// is no later than b's first
+func notAfter(a, b *gendate.Date) bool {
+	latest, ok := a.Latest()
+	if !ok {
+		return false
+	}
+	earliest, ok := b.Earliest()
+	return ok && !latest.After(earliest)
+}
+
+// ageText is an age, or a range of ages for approximate dates
+func ageText(youngest, oldest int) string {
+	if youngest == oldest {
+		return strconv.Itoa(oldest)
+	}
+	return fmt.Sprintf("%d to %d", max(youngest, 0), oldest)
+}